@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// anthropicProvider relays Anthropic Messages requests to an
+// Anthropic-compatible upstream like passthrough, but with furiwake's own
+// credential: the client's Authorization and x-api-key headers are dropped
+// and the provider's auth is injected instead.
+type anthropicProvider struct {
+	passthroughProvider
+}
+
+func (anthropicProvider) Validate(name string, cfg ProviderConfig) error {
+	switch cfg.Auth.Type {
+	case AuthTypeAPIKey, AuthTypeBearer:
+		if cfg.Auth.TokenEnv == "" {
+			return fmt.Errorf("providers.%s.auth.token_env is required for type %s", name, cfg.Type)
+		}
+		return nil
+	default:
+		return fmt.Errorf("providers.%s.auth.type must be api_key or bearer for type %s", name, cfg.Type)
+	}
+}
+
+func (anthropicProvider) Send(ctx context.Context, call *ProviderCall, payload []byte) (*http.Response, error) {
+	return sendRelay(ctx, call, payload, stripClientCredentials)
+}
+
+func (p anthropicProvider) CountTokens(ctx context.Context, w http.ResponseWriter, call *ProviderCall) {
+	payload, err := p.TranslateRequest(call)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	relayCountTokens(ctx, w, call, p, payload)
+}
+
+func stripClientCredentials(h http.Header) {
+	h.Del("Authorization")
+	h.Del("x-api-key")
+}
+
+// applyAnthropicBeta rewrites the anthropic-beta header according to cfg.
+func applyAnthropicBeta(h http.Header, cfg AnthropicBetaConfig) {
+	if len(cfg.Set) > 0 {
+		h.Set("anthropic-beta", strings.Join(cfg.Set, ","))
+		return
+	}
+	if len(cfg.Allow) == 0 && len(cfg.Drop) == 0 {
+		return
+	}
+
+	allowed := stringSet(cfg.Allow)
+	dropped := stringSet(cfg.Drop)
+	var kept []string
+	for _, value := range h.Values("anthropic-beta") {
+		for _, beta := range strings.Split(value, ",") {
+			beta = strings.TrimSpace(beta)
+			if beta == "" || dropped["*"] || dropped[beta] {
+				continue
+			}
+			if len(allowed) > 0 && !allowed[beta] {
+				continue
+			}
+			kept = append(kept, beta)
+		}
+	}
+	h.Del("anthropic-beta")
+	if len(kept) > 0 {
+		h.Set("anthropic-beta", strings.Join(kept, ","))
+	}
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[strings.TrimSpace(v)] = true
+	}
+	return set
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicProvider_InjectsCredentialAndRewritesModel(t *testing.T) {
+	t.Setenv("SHARED_ANTHROPIC_KEY", "shared-key")
+
+	var seen http.Header
+	var seenBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Clone()
+		b, _ := io.ReadAll(r.Body)
+		seenBody = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"id":"msg_1","type":"message","role":"assistant","content":[],"usage":{"input_tokens":1,"output_tokens":1}}`)
+	}))
+	defer upstream.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "vendor",
+		Providers: map[string]ProviderConfig{
+			"vendor": {
+				Type:          ProviderTypeAnthropic,
+				URL:           upstream.URL,
+				Model:         "vendor-model-1",
+				Auth:          AuthConfig{Type: AuthTypeAPIKey, TokenEnv: "SHARED_ANTHROPIC_KEY"},
+				AnthropicBeta: AnthropicBetaConfig{Drop: []string{"context-1m-2025-08-07"}},
+			},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4-6","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "Bearer client-token")
+	req.Header.Set("x-api-key", "client-key")
+	req.Header.Set("anthropic-beta", "context-1m-2025-08-07, fine-grained-tool-streaming-2025-05-14")
+	rr := httptest.NewRecorder()
+	s.handleMessages(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if got := seen.Get("x-api-key"); got != "shared-key" {
+		t.Fatalf("expected injected x-api-key, got %q", got)
+	}
+	if got := seen.Get("Authorization"); got != "" {
+		t.Fatalf("client Authorization must be stripped, got %q", got)
+	}
+	if got := seen.Get("anthropic-beta"); got != "fine-grained-tool-streaming-2025-05-14" {
+		t.Fatalf("unexpected anthropic-beta: %q", got)
+	}
+	if !strings.Contains(seenBody, `"model":"vendor-model-1"`) || !strings.Contains(seenBody, `"max_tokens":16`) {
+		t.Fatalf("unexpected relayed body: %s", seenBody)
+	}
+}
+
+func TestApplyAnthropicBeta(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  AnthropicBetaConfig
+		in   []string
+		want string
+	}{
+		{"unchanged", AnthropicBetaConfig{}, []string{"a,b"}, "a,b"},
+		{"set", AnthropicBetaConfig{Set: []string{"x", "y"}}, []string{"a"}, "x,y"},
+		{"allow", AnthropicBetaConfig{Allow: []string{"b"}}, []string{"a, b", "c"}, "b"},
+		{"drop", AnthropicBetaConfig{Drop: []string{"a"}}, []string{"a,b"}, "b"},
+		{"drop all", AnthropicBetaConfig{Drop: []string{"*"}}, []string{"a,b"}, ""},
+	}
+	for _, tc := range cases {
+		h := http.Header{}
+		for _, v := range tc.in {
+			h.Add("anthropic-beta", v)
+		}
+		applyAnthropicBeta(h, tc.cfg)
+		if got := strings.Join(h.Values("anthropic-beta"), ","); got != tc.want {
+			t.Fatalf("%s: got %q want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAnthropicProviderValidate(t *testing.T) {
+	p := anthropicProvider{}
+	if err := p.Validate("vendor", ProviderConfig{Type: ProviderTypeAnthropic, Auth: AuthConfig{Type: AuthTypeNone}}); err == nil {
+		t.Fatalf("expected auth none to be rejected")
+	}
+	if err := p.Validate("vendor", ProviderConfig{Type: ProviderTypeAnthropic, Auth: AuthConfig{Type: AuthTypeAPIKey}}); err == nil {
+		t.Fatalf("expected missing token_env to be rejected")
+	}
+	if err := p.Validate("vendor", ProviderConfig{Type: ProviderTypeAnthropic, Auth: AuthConfig{Type: AuthTypeBearer, TokenEnv: "KEY"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AuditLog appends one JSON line per request to the file named by audit_log.
+// Lines can be fed back through `furiwake replay`.
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{file: f}, nil
+}
+
+// Write appends record as one redacted JSON line.
+func (a *AuditLog) Write(record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = secretPattern.ReplaceAll(line, []byte(redactedValue))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.file.Write(append(line, '\n'))
+	return err
+}
+
+func (a *AuditLog) Close() error {
+	return a.file.Close()
+}
+
+// AuditRecord is one line of the audit log.
+type AuditRecord struct {
+	Time      string     `json:"time"`
+	RequestID string     `json:"request_id"`
+	Endpoint  string     `json:"endpoint"`
+	Client    string     `json:"client,omitempty"`
+	Route     AuditRoute `json:"route"`
+	// Attempts lists every provider tried, including failed fallbacks.
+	Attempts []string `json:"attempts"`
+	// Request is the Anthropic Messages request; replay resends it.
+	Request json.RawMessage `json:"request"`
+	// UpstreamPayload is the body sent to the final provider after translation.
+	UpstreamPayload json.RawMessage           `json:"upstream_payload,omitempty"`
+	Status          int                       `json:"status"`
+	Response        *AnthropicMessageResponse `json:"response,omitempty"`
+	Error           string                    `json:"error,omitempty"`
+	Usage           AnthropicUsage            `json:"usage"`
+	Retries         int                       `json:"retries"`
+	Timings         AuditTimings              `json:"timings"`
+}
+
+// AuditRoute is the RouteResolution the request was served with.
+type AuditRoute struct {
+	Provider        string   `json:"provider"`
+	Type            string   `json:"type"`
+	URL             string   `json:"url"`
+	Model           string   `json:"model,omitempty"`
+	ReasoningEffort string   `json:"reasoning_effort,omitempty"`
+	ServiceTier     string   `json:"service_tier,omitempty"`
+	Preset          string   `json:"preset,omitempty"`
+	Rule            string   `json:"rule,omitempty"`
+	Split           string   `json:"split,omitempty"`
+	Arm             string   `json:"arm,omitempty"`
+	Fallback        []string `json:"fallback,omitempty"`
+}
+
+type AuditTimings struct {
+	TotalMS      int64 `json:"total_ms"`
+	UpstreamMS   int64 `json:"upstream_ms,omitempty"`
+	FirstTokenMS int64 `json:"first_token_ms,omitempty"`
+}
+
+// auditTrail collects what serveProvider did for one request.
+type auditTrail struct {
+	attempts []string
+	payload  []byte
+	upstream time.Duration
+	retries  int32
+}
+
+type auditTrailKey struct{}
+
+func withAuditTrail(ctx context.Context, trail *auditTrail) context.Context {
+	return context.WithValue(ctx, auditTrailKey{}, trail)
+}
+
+// countRetry notes an upstream retry on the request's audit trail, if any.
+func countRetry(ctx context.Context) {
+	if trail, ok := ctx.Value(auditTrailKey{}).(*auditTrail); ok {
+		atomic.AddInt32(&trail.retries, 1)
+	}
+}
+
+// writeAudit appends the finished request to the audit log when one is open.
+func (s *Server) writeAudit(call *ProviderCall, observed *observedWriter, trail *auditTrail) {
+	if s.audit == nil || call.Route == nil {
+		return
+	}
+	route := call.Route
+	record := AuditRecord{
+		Time:      observed.start.UTC().Format(time.RFC3339Nano),
+		RequestID: call.RequestID,
+		Route: AuditRoute{
+			Provider:        route.ProviderName,
+			Type:            route.Provider.Type,
+			URL:             redactURL(route.Provider.URL),
+			Model:           route.Model,
+			ReasoningEffort: route.ReasoningEffort,
+			ServiceTier:     route.ServiceTier,
+			Preset:          route.PresetName,
+			Rule:            route.Rule,
+			Split:           route.Split,
+			Arm:             route.Arm,
+			Fallback:        route.Fallback,
+		},
+		Attempts:        trail.attempts,
+		Request:         redactJSON(call.Body),
+		UpstreamPayload: redactJSON(trail.payload),
+		Status:          observed.status,
+		Retries:         int(atomic.LoadInt32(&trail.retries)),
+		Timings: AuditTimings{
+			TotalMS:      time.Since(observed.start).Milliseconds(),
+			UpstreamMS:   trail.upstream.Milliseconds(),
+			FirstTokenMS: observed.firstToken.Milliseconds(),
+		},
+	}
+	if call.Inbound != nil {
+		record.Endpoint = call.Inbound.URL.Path
+		record.Client = requestClient(call.Inbound)
+	}
+	if record.Status == 0 {
+		record.Status = 200
+	}
+
+	switch {
+	case record.Status >= 400:
+		record.Error = truncateForLog(observed.body.String(), 4000)
+	case observed.stream:
+		record.Response = observed.transcript.result()
+	default:
+		var resp AnthropicMessageResponse
+		if json.Unmarshal(observed.body.Bytes(), &resp) == nil {
+			record.Response = &resp
+		}
+	}
+	if record.Response != nil {
+		record.Usage = record.Response.Usage
+	}
+
+	if err := s.audit.Write(record); err != nil {
+		s.logger.Errorf("req=%s audit log write failed: %v", call.RequestID, err)
+	}
+}
+
+// messageTranscript reassembles an Anthropic message from its stream events.
+type messageTranscript struct {
+	message     AnthropicMessageResponse
+	partialJSON map[int]*strings.Builder
+}
+
+func newMessageTranscript() *messageTranscript {
+	return &messageTranscript{partialJSON: map[int]*strings.Builder{}}
+}
+
+func (t *messageTranscript) add(event AnthropicStreamEvent) {
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			t.message = *event.Message
+			t.message.Content = nil
+		}
+	case "content_block_start":
+		for len(t.message.Content) <= event.Index {
+			t.message.Content = append(t.message.Content, AnthropicContentBlock{})
+		}
+		if event.ContentBlock != nil {
+			t.message.Content[event.Index] = *event.ContentBlock
+		}
+	case "content_block_delta":
+		if event.Index >= len(t.message.Content) {
+			return
+		}
+		block := &t.message.Content[event.Index]
+		switch event.Delta.Type {
+		case "text_delta":
+			block.Text += event.Delta.Text
+		case "thinking_delta":
+			block.Thinking += event.Delta.Thinking
+		case "signature_delta":
+			block.Signature = event.Delta.Signature
+		case "input_json_delta":
+			b, ok := t.partialJSON[event.Index]
+			if !ok {
+				b = &strings.Builder{}
+				t.partialJSON[event.Index] = b
+			}
+			b.WriteString(event.Delta.PartialJSON)
+		}
+	case "message_delta":
+		if event.Delta.StopReason != "" {
+			t.message.StopReason = event.Delta.StopReason
+		}
+		if event.Usage != nil {
+			t.message.Usage.addDelta(*event.Usage)
+		}
+	}
+}
+
+func (t *messageTranscript) result() *AnthropicMessageResponse {
+	if t == nil {
+		return nil
+	}
+	for index, b := range t.partialJSON {
+		if raw := json.RawMessage(b.String()); json.Valid(raw) {
+			t.message.Content[index].Input = raw
+		}
+	}
+	return &t.message
+}
+
+const redactedValue = "[REDACTED]"
+
+// secretPattern matches credentials that may appear anywhere in a record:
+// API keys, bearer tokens and JWTs.
+var secretPattern = regexp.MustCompile(`sk-[A-Za-z0-9_\-]{16,}|(?i:bearer)\s+[A-Za-z0-9._\-]{16,}|eyJ[A-Za-z0-9_\-]{8,}\.[A-Za-z0-9_\-]{8,}\.[A-Za-z0-9_\-]+`)
+
+// secretKeys are JSON object keys whose values are always redacted.
+var secretKeys = map[string]bool{
+	"authorization": true,
+	"api_key":       true,
+	"apikey":        true,
+	"x-api-key":     true,
+	"access_token":  true,
+	"refresh_token": true,
+	"id_token":      true,
+	"client_secret": true,
+	"password":      true,
+}
+
+// redactJSON returns raw with the values of secretKeys replaced. Bodies that
+// are not JSON are kept as a string.
+func redactJSON(raw []byte) json.RawMessage {
+	if len(raw) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		out, _ := json.Marshal(string(raw))
+		return out
+	}
+	out, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for key, value := range t {
+			if secretKeys[strings.ToLower(key)] {
+				t[key] = redactedValue
+				continue
+			}
+			t[key] = redactValue(value)
+		}
+	case []interface{}:
+		for i, value := range t {
+			t[i] = redactValue(value)
+		}
+	}
+	return v
+}
+
+// redactURL drops user info and query values from a provider URL.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	if u.User != nil {
+		u.User = url.User(redactedValue)
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			query.Set(key, redactedValue)
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
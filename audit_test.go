@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newAuditTestServer(t *testing.T, upstreamURL string) (*Server, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "openai",
+		AuditLog:        path,
+		Providers: map[string]ProviderConfig{
+			"openai": {Type: ProviderTypeOpenAI, URL: upstreamURL + "?key=secret-value", Model: "gpt-5-mini"},
+		},
+	}
+	return NewServer(cfg, NewLogger()), path
+}
+
+func TestAuditLog_RecordsStreamedRequest(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hel\"}}]}\n\n")
+		_, _ = io.WriteString(w, "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"}}]}\n\n")
+		_, _ = io.WriteString(w, "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"read\",\"arguments\":\"{\\\"path\\\":\"}}]}}]}\n\n")
+		_, _ = io.WriteString(w, "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"\\\"a.go\\\"}\"}}]}}]}\n\n")
+		_, _ = io.WriteString(w, "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"tool_calls\"}],\"usage\":{\"prompt_tokens\":9,\"completion_tokens\":4}}\n\n")
+		_, _ = io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+	s, path := newAuditTestServer(t, upstream.URL)
+
+	body := []byte(`{"model":"claude","stream":true,"messages":[{"role":"user","content":"my key is sk-ant-REDACTED"}],"metadata":{"api_key":"plain"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body))
+	req.Header.Set("x-request-id", "req-1")
+	rr := httptest.NewRecorder()
+	s.handleMessages(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	if strings.Contains(string(raw), "abcdefghijklmnopqrstuvwxyz") || strings.Contains(string(raw), "plain") || strings.Contains(string(raw), "secret-value") {
+		t.Fatalf("audit log leaked a secret: %s", raw)
+	}
+
+	var record AuditRecord
+	if err := json.Unmarshal(bytes.TrimSpace(raw), &record); err != nil {
+		t.Fatalf("audit line is not JSON: %v\n%s", err, raw)
+	}
+	if record.RequestID != "req-1" || record.Endpoint != "/v1/messages" || record.Status != 200 {
+		t.Fatalf("unexpected record header: %+v", record)
+	}
+	if record.Route.Provider != "openai" || record.Route.Model != "gpt-5-mini" || len(record.Attempts) != 1 {
+		t.Fatalf("unexpected route: %+v attempts=%v", record.Route, record.Attempts)
+	}
+	if !strings.Contains(string(record.UpstreamPayload), `"model":"gpt-5-mini"`) {
+		t.Fatalf("upstream payload missing translated model: %s", record.UpstreamPayload)
+	}
+	if record.Response == nil || len(record.Response.Content) != 2 {
+		t.Fatalf("expected reassembled text and tool_use, got %+v", record.Response)
+	}
+	if record.Response.Content[0].Text != "hello" {
+		t.Fatalf("unexpected text: %q", record.Response.Content[0].Text)
+	}
+	if string(record.Response.Content[1].Input) != `{"path":"a.go"}` {
+		t.Fatalf("unexpected tool input: %s", record.Response.Content[1].Input)
+	}
+	if record.Response.StopReason != "tool_use" || record.Usage.OutputTokens != 4 {
+		t.Fatalf("unexpected stop reason or usage: %+v", record.Response)
+	}
+}
+
+func TestReplay_ResendsRecordedRequest(t *testing.T) {
+	var upstreamBodies []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		upstreamBodies = append(upstreamBodies, string(b))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","content":"replayed"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`)
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	auditPath := filepath.Join(dir, "audit.jsonl")
+	lines := `{"request_id":"first","request":{"model":"claude","messages":[{"role":"user","content":"one"}]}}
+{"request_id":"second","request":{"model":"claude","messages":[{"role":"user","content":"two"}]}}
+`
+	if err := os.WriteFile(auditPath, []byte(lines), 0o644); err != nil {
+		t.Fatalf("write audit log: %v", err)
+	}
+	configPath := writeTempConfig(t, `
+listen: ":0"
+spoof_model: "claude-test"
+default_provider: "anthropic"
+timeout_seconds: 30
+providers:
+  anthropic:
+    type: passthrough
+    url: "http://127.0.0.1:1"
+  openai:
+    type: openai
+    url: "`+upstream.URL+`"
+    model: "gpt-5-mini"
+audit_log: "`+auditPath+`"
+usage:
+  file: "`+filepath.Join(dir, "usage.json")+`"
+`)
+
+	var stdout, stderr bytes.Buffer
+	err := runReplay([]string{auditPath, "--line", "2", "--route", "openai", "--config", configPath}, &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("runReplay error: %v stderr=%s", err, stderr.String())
+	}
+	if len(upstreamBodies) != 1 || !strings.Contains(upstreamBodies[0], `"content":"two"`) {
+		t.Fatalf("expected line 2 to be resent, got %v", upstreamBodies)
+	}
+	if !strings.Contains(stdout.String(), `"text":"replayed"`) {
+		t.Fatalf("unexpected replay output: %s", stdout.String())
+	}
+	// The replayed request is neither audited nor billed.
+	if got, _ := os.ReadFile(auditPath); string(got) != lines {
+		t.Fatalf("expected the audit log to be left alone, got:\n%s", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "usage.json")); !os.IsNotExist(err) {
+		t.Fatalf("expected no usage file, got %v", err)
+	}
+
+	if err := runReplay([]string{auditPath, "--line", "3", "--config", configPath}, &stdout, &stderr); err == nil {
+		t.Fatalf("expected an error for a missing line")
+	}
+}
@@ -4,20 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 )
 
-const maxRetryCount = 5
-
-var retrySleep = time.Sleep
-
 func (s *Server) doProviderRequestWithRetry(
 	ctx context.Context,
 	method string,
@@ -31,12 +25,20 @@ func (s *Server) doProviderRequestWithRetry(
 	reasoningEffort string,
 	serviceTier string,
 ) (*http.Response, error) {
-	var lastErr error
-	for attempt := 0; attempt <= maxRetryCount; attempt++ {
-		if err := ctx.Err(); err != nil {
-			return nil, err
-		}
+	if strings.TrimSpace(routeName) == "" {
+		routeName = "-"
+	}
+	if strings.TrimSpace(modelName) == "" {
+		modelName = "-"
+	}
+	if strings.TrimSpace(reasoningEffort) == "" {
+		reasoningEffort = "-"
+	}
+	if strings.TrimSpace(serviceTier) == "" {
+		serviceTier = "-"
+	}
 
+	return s.sendWithRetry(ctx, provider, routeName, modelName, func() (*http.Request, error) {
 		req, err := http.NewRequestWithContext(ctx, method, targetURL, bytes.NewReader(payload))
 		if err != nil {
 			return nil, fmt.Errorf("failed to create upstream request: %w", err)
@@ -62,49 +64,39 @@ func (s *Server) doProviderRequestWithRetry(
 		if reqID == "" {
 			reqID = "-"
 		}
-		if strings.TrimSpace(routeName) == "" {
-			routeName = "-"
-		}
-		if strings.TrimSpace(modelName) == "" {
-			modelName = "-"
-		}
-		if strings.TrimSpace(reasoningEffort) == "" {
-			reasoningEffort = "-"
-		}
-		if strings.TrimSpace(serviceTier) == "" {
-			serviceTier = "-"
-		}
 		s.logger.Infof("[HTTP-OUT] req=%s route=%s model=%s reasoning=%s tier=%s %s %s", reqID, routeName, modelName, reasoningEffort, serviceTier, req.Method, req.URL.String())
-		resp, err := s.client.Do(req)
-		if err != nil {
-			lastErr = err
-			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
-				return nil, err
-			}
-			if attempt == maxRetryCount {
-				return nil, err
-			}
-			retrySleep(backoffDuration(attempt))
-			continue
-		}
+		return req, nil
+	})
+}
 
-		if isRetryableStatus(resp.StatusCode) && attempt < maxRetryCount {
-			lastErr = fmt.Errorf("upstream returned status %d", resp.StatusCode)
-			closeResponseBody(resp)
-			if err := ctx.Err(); err != nil {
-				return nil, err
-			}
-			retrySleep(backoffDuration(attempt))
-			continue
-		}
-		return resp, nil
+// isUsageLimitResponse reports whether resp is a Codex plan usage-limit
+// error. Such errors do not clear within the retry window, so they are
+// surfaced immediately (and trigger fallback) instead of being retried. The
+// start of the body is peeked and put back in front of the rest, and the
+// answer is kept with the body so later calls do not read it again.
+func isUsageLimitResponse(resp *http.Response) bool {
+	if resp == nil || resp.Body == nil || resp.StatusCode < 400 {
+		return false
+	}
+	if peeked, ok := resp.Body.(*peekedBody); ok {
+		return peeked.usageLimit
 	}
-	return nil, lastErr
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	body := string(raw)
+	peeked := &peekedBody{
+		Reader:     io.MultiReader(bytes.NewReader(raw), resp.Body),
+		Closer:     resp.Body,
+		usageLimit: err == nil && (strings.Contains(body, "usage_limit_reached") || strings.Contains(body, "usage_not_included")),
+	}
+	resp.Body = peeked
+	return peeked.usageLimit
 }
 
-func backoffDuration(attempt int) time.Duration {
-	base := 250 * time.Millisecond
-	return base * time.Duration(1<<attempt)
+// peekedBody is a response body whose start was read by isUsageLimitResponse.
+type peekedBody struct {
+	io.Reader
+	io.Closer
+	usageLimit bool
 }
 
 func ApplyProviderAuth(req *http.Request, provider ProviderConfig) error {
@@ -138,6 +130,17 @@ func ApplyProviderAuth(req *http.Request, provider ProviderConfig) error {
 		}
 		req.Header.Set("User-Agent", "codex-cli/1.0")
 		return nil
+	case AuthTypeAPIKey:
+		tokenEnv := provider.Auth.TokenEnv
+		if tokenEnv == "" {
+			return fmt.Errorf("api_key auth requires token_env")
+		}
+		key := strings.TrimSpace(os.Getenv(tokenEnv))
+		if key == "" {
+			return fmt.Errorf("api_key auth env %s is empty", tokenEnv)
+		}
+		req.Header.Set("x-api-key", key)
+		return nil
 	default:
 		return fmt.Errorf("unsupported auth type: %s", authType)
 	}
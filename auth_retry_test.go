@@ -38,7 +38,7 @@ func TestDoProviderRequestWithRetry_Retry429(t *testing.T) {
 	}
 
 	prevSleep := retrySleep
-	retrySleep = func(_ time.Duration) {}
+	retrySleep = func(context.Context, time.Duration) error { return nil }
 	defer func() { retrySleep = prevSleep }()
 
 	resp, err := s.doProviderRequestWithRetry(
@@ -85,7 +85,7 @@ func TestDoProviderRequestWithRetry_DoesNotRetryCanceledContext(t *testing.T) {
 
 	sleeps := 0
 	prevSleep := retrySleep
-	retrySleep = func(_ time.Duration) { sleeps++ }
+	retrySleep = func(context.Context, time.Duration) error { sleeps++; return nil }
 	defer func() { retrySleep = prevSleep }()
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -105,3 +105,121 @@ func TestDoProviderRequestWithRetry_DoesNotRetryCanceledContext(t *testing.T) {
 		t.Fatalf("expected no retries, got %d sleeps", sleeps)
 	}
 }
+
+func TestDoProviderRequestWithRetry_RetriesServerErrorsWithRetryAfter(t *testing.T) {
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(529)
+		case 2:
+			w.Header().Set("x-ratelimit-remaining-tokens", "0")
+			w.Header().Set("x-ratelimit-reset-tokens", "1.5s")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer upstream.Close()
+
+	var delays []time.Duration
+	prevSleep := retrySleep
+	retrySleep = func(_ context.Context, d time.Duration) error { delays = append(delays, d); return nil }
+	defer func() { retrySleep = prevSleep }()
+
+	s := &Server{client: upstream.Client(), logger: NewLogger()}
+	provider := ProviderConfig{Type: ProviderTypeOpenAI, URL: upstream.URL, Auth: AuthConfig{Type: AuthTypeNone}}
+	resp, err := s.doProviderRequestWithRetry(context.Background(), http.MethodPost, upstream.URL, []byte(`{}`), nil, provider, false, "", "", "", "")
+	if err != nil {
+		t.Fatalf("doProviderRequestWithRetry error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls != 3 {
+		t.Fatalf("expected 200 after 3 calls, got %d after %d", resp.StatusCode, calls)
+	}
+	if len(delays) != 2 || delays[0] != 7*time.Second || delays[1] != 1500*time.Millisecond {
+		t.Fatalf("expected upstream-requested delays, got %v", delays)
+	}
+}
+
+func TestDoProviderRequestWithRetry_PolicyLimits(t *testing.T) {
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	prevSleep := retrySleep
+	retrySleep = func(context.Context, time.Duration) error { return nil }
+	defer func() { retrySleep = prevSleep }()
+	s := &Server{client: upstream.Client(), logger: NewLogger()}
+
+	// Retry-After beyond the deadline returns the upstream error at once.
+	provider := ProviderConfig{Type: ProviderTypeOpenAI, URL: upstream.URL, Retry: RetryConfig{DeadlineSeconds: 10}}
+	resp, err := s.doProviderRequestWithRetry(context.Background(), http.MethodPost, upstream.URL, []byte(`{}`), nil, provider, false, "", "", "", "")
+	if err != nil || resp.StatusCode != http.StatusBadGateway || calls != 1 {
+		t.Fatalf("expected the 502 without retrying, got resp=%v err=%v calls=%d", resp, err, calls)
+	}
+	resp.Body.Close()
+
+	// Ignoring Retry-After, max_attempts bounds the calls.
+	calls = 0
+	noRetryAfter := false
+	provider.Retry = RetryConfig{MaxAttempts: 3, RetryAfter: &noRetryAfter}
+	resp, err = s.doProviderRequestWithRetry(context.Background(), http.MethodPost, upstream.URL, []byte(`{}`), nil, provider, false, "", "", "", "")
+	if err != nil || resp.StatusCode != http.StatusBadGateway || calls != 3 {
+		t.Fatalf("expected 3 attempts, got resp=%v err=%v calls=%d", resp, err, calls)
+	}
+	resp.Body.Close()
+
+	// Statuses outside the policy are not retried.
+	calls = 0
+	provider.Retry = RetryConfig{Statuses: []int{429}}
+	resp, _ = s.doProviderRequestWithRetry(context.Background(), http.MethodPost, upstream.URL, []byte(`{}`), nil, provider, false, "", "", "", "")
+	resp.Body.Close()
+	if calls != 1 {
+		t.Fatalf("expected 502 not to be retried, got %d calls", calls)
+	}
+}
+
+func TestRetrySleep_CancelledByContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go cancel()
+	start := time.Now()
+	if err := retrySleep(ctx, time.Minute); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("retrySleep did not return on cancel")
+	}
+}
+
+func TestRetryConfig_Backoff(t *testing.T) {
+	prevRand := retryRand
+	defer func() { retryRand = prevRand }()
+
+	retryRand = func() float64 { return 0.5 }
+	r := RetryConfig{BaseDelayMS: 100, MaxDelayMS: 1000}
+	for attempt, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		if got := r.backoff(attempt); got != want*time.Millisecond {
+			t.Fatalf("attempt %d: expected %v, got %v", attempt, want*time.Millisecond, got)
+		}
+	}
+	if got := r.backoff(100); got != time.Second {
+		t.Fatalf("expected large attempts to cap at max delay, got %v", got)
+	}
+
+	retryRand = func() float64 { return 0 }
+	if got := r.backoff(0); got != 80*time.Millisecond {
+		t.Fatalf("expected -20%% jitter, got %v", got)
+	}
+	none := 0.0
+	r.Jitter = &none
+	if got := r.backoff(0); got != 100*time.Millisecond {
+		t.Fatalf("expected no jitter, got %v", got)
+	}
+}
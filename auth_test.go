@@ -1,6 +1,7 @@
 package main
 
 import (
+	"io"
 	"net/http"
 	"strings"
 	"testing"
@@ -59,3 +60,31 @@ func TestSafeJSONRawMessage(t *testing.T) {
 		t.Fatalf("expected original json, got %s", got)
 	}
 }
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestIsUsageLimitResponse_KeepsWholeBody(t *testing.T) {
+	body := `{"error":{"type":"usage_limit_reached","message":"` + strings.Repeat("x", 100<<10) + `"}}`
+	original := &closeRecorder{Reader: strings.NewReader(body)}
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Body: original}
+
+	if !isUsageLimitResponse(resp) || !isUsageLimitResponse(resp) {
+		t.Fatal("expected a usage-limit response on every check")
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil || string(raw) != body {
+		t.Fatalf("expected the whole body after the check, got %d of %d bytes (%v)", len(raw), len(body), err)
+	}
+	_ = resp.Body.Close()
+	if !original.closed {
+		t.Fatal("expected Close to close the upstream body")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// normalizeClients resolves each client's key and checks that keys are unique
+// and that the providers and presets a client is limited to exist.
+func normalizeClients(cfg *Config) error {
+	seen := map[string]string{}
+	for name, client := range cfg.Clients {
+		field := "clients." + name
+		client.KeyEnv = strings.TrimSpace(client.KeyEnv)
+		switch {
+		case client.Key != "" && client.KeyEnv != "":
+			return fmt.Errorf("%s must set only one of key or key_env", field)
+		case client.KeyEnv != "":
+			client.key = strings.TrimSpace(os.Getenv(client.KeyEnv))
+			if client.key == "" {
+				return fmt.Errorf("%s.key_env %s is empty", field, client.KeyEnv)
+			}
+		default:
+			client.key = strings.TrimSpace(client.Key)
+			if client.key == "" {
+				return fmt.Errorf("%s.key or key_env is required", field)
+			}
+		}
+		if other, ok := seen[client.key]; ok {
+			return fmt.Errorf("%s uses the same key as clients.%s", field, other)
+		}
+		seen[client.key] = name
+
+		for _, provider := range client.Providers {
+			if _, ok := cfg.Providers[provider]; !ok {
+				return fmt.Errorf("%s.providers: %q is not defined in providers", field, provider)
+			}
+		}
+		for _, preset := range client.Presets {
+			if _, ok := cfg.Presets[preset]; !ok {
+				return fmt.Errorf("%s.presets: %q is not defined in presets", field, preset)
+			}
+		}
+		cfg.Clients[name] = client
+	}
+	return nil
+}
+
+// authenticateClient finds the client whose key the request carries in
+// x-api-key or as an Authorization bearer token. header is the header that
+// held the key.
+func (cfg *Config) authenticateClient(h http.Header) (name, header string, ok bool) {
+	candidates := []struct{ header, value string }{
+		{"x-api-key", strings.TrimSpace(h.Get("x-api-key"))},
+		{"Authorization", bearerToken(h.Get("Authorization"))},
+	}
+	for _, c := range candidates {
+		if c.value == "" {
+			continue
+		}
+		for clientName, client := range cfg.Clients {
+			if subtle.ConstantTimeCompare([]byte(c.value), []byte(client.key)) == 1 {
+				return clientName, c.header, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+func bearerToken(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) < 7 || !strings.EqualFold(v[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(v[7:])
+}
+
+type clientKey struct{}
+
+// requestClient returns the name of the client that sent r, or "" when
+// clients are not configured.
+func requestClient(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	name, _ := r.Context().Value(clientKey{}).(string)
+	return name
+}
+
+// requireClient wraps an API handler so that, when clients are configured,
+// only requests with a valid proxy key reach it. The key's header is removed
+// so relaying providers never forward it upstream. fail writes the rejection
+// in the endpoint's error format.
+func (s *Server) requireClient(next http.HandlerFunc, fail func(w http.ResponseWriter, status int, message string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := s.config()
+		if len(cfg.Clients) == 0 {
+			next(w, r)
+			return
+		}
+		name, header, ok := cfg.authenticateClient(r.Header)
+		if !ok {
+			s.logger.Warnf("rejected %s %s from %s: invalid or missing API key", r.Method, r.URL.Path, r.RemoteAddr)
+			fail(w, http.StatusUnauthorized, "invalid or missing furiwake API key")
+			return
+		}
+		r.Header.Del(header)
+		next(w, r.WithContext(context.WithValue(r.Context(), clientKey{}, name)))
+	}
+}
+
+// authorizeRoute checks that the client that sent r may use the resolved
+// route. Fallback providers the client may not use are dropped from the
+// route rather than failing the request.
+func authorizeRoute(cfg *Config, r *http.Request, route *RouteResolution) error {
+	name := requestClient(r)
+	client, ok := cfg.Clients[name]
+	if !ok {
+		return nil
+	}
+	if route.PresetName != "" && len(client.Presets) > 0 && !containsString(client.Presets, route.PresetName) {
+		return fmt.Errorf("client %s may not use preset %s", name, route.PresetName)
+	}
+	if len(client.Providers) == 0 {
+		return nil
+	}
+	if !containsString(client.Providers, route.ProviderName) {
+		return fmt.Errorf("client %s may not use provider %s", name, route.ProviderName)
+	}
+	var fallback []string
+	for _, provider := range route.Fallback {
+		if containsString(client.Providers, provider) {
+			fallback = append(fallback, provider)
+		}
+	}
+	route.Fallback = fallback
+	return nil
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const clientsConfigBase = `listen: ":0"
+spoof_model: claude-spoof
+default_provider: anthropic
+timeout_seconds: 30
+providers:
+  anthropic:
+    type: passthrough
+    url: "https://api.anthropic.com"
+  openai:
+    type: openai
+    url: "https://api.openai.com/v1/chat/completions"
+    model: gpt-5-mini
+presets:
+  fast:
+    provider: openai
+`
+
+func TestLoadConfig_Clients(t *testing.T) {
+	t.Setenv("BOB_KEY", " bob-secret ")
+	cfg, err := LoadConfig(writeTempConfig(t, clientsConfigBase+`clients:
+  alice:
+    key: alice-secret
+    providers: [openai]
+  bob:
+    key_env: BOB_KEY
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig error: %v", err)
+	}
+	if cfg.Clients["bob"].key != "bob-secret" {
+		t.Fatalf("expected key from env, got %q", cfg.Clients["bob"].key)
+	}
+
+	cases := map[string]string{
+		"missing key":      "  a:\n    providers: [openai]\n",
+		"both keys":        "  a:\n    key: x\n    key_env: BOB_KEY\n",
+		"empty env":        "  a:\n    key_env: FURIWAKE_TEST_UNSET\n",
+		"duplicate key":    "  a:\n    key: same\n  b:\n    key: same\n",
+		"unknown provider": "  a:\n    key: x\n    providers: [nope]\n",
+		"unknown preset":   "  a:\n    key: x\n    presets: [nope]\n",
+	}
+	for name, clients := range cases {
+		if _, err := LoadConfig(writeTempConfig(t, clientsConfigBase+"clients:\n"+clients)); err == nil {
+			t.Fatalf("%s: expected LoadConfig to fail", name)
+		}
+	}
+}
+
+func TestAuthenticateClient(t *testing.T) {
+	cfg := &Config{Clients: map[string]ClientConfig{
+		"alice": {key: "alice-secret"},
+		"bob":   {key: "bob-secret"},
+	}}
+	cases := []struct {
+		header, value, client, matched string
+	}{
+		{"x-api-key", "alice-secret", "alice", "x-api-key"},
+		{"Authorization", "Bearer bob-secret", "bob", "Authorization"},
+		{"Authorization", "bearer  bob-secret ", "bob", "Authorization"},
+		{"Authorization", "bob-secret", "", ""},
+		{"x-api-key", "mallory", "", ""},
+	}
+	for _, c := range cases {
+		h := http.Header{}
+		h.Set(c.header, c.value)
+		name, header, ok := cfg.authenticateClient(h)
+		if name != c.client || header != c.matched || ok != (c.client != "") {
+			t.Fatalf("%s: %q: got client=%q header=%q ok=%t", c.header, c.value, name, header, ok)
+		}
+	}
+}
+
+func TestRequireClient_PassthroughDoesNotForwardProxyKey(t *testing.T) {
+	var seen http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[]}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "anthropic",
+		Providers: map[string]ProviderConfig{
+			"anthropic": {Type: ProviderTypePassthrough, URL: upstream.URL},
+		},
+		Clients: map[string]ClientConfig{"alice": {key: "alice-secret"}},
+	}
+	s := NewServer(cfg, NewLogger())
+	body := []byte(`{"model":"claude","messages":[{"role":"user","content":"hi"}]}`)
+
+	rr := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body)))
+	if rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), AnthropicErrAuthentication) {
+		t.Fatalf("expected 401 without a key, got %d %s", rr.Code, rr.Body.String())
+	}
+	if seen != nil {
+		t.Fatal("unauthenticated request reached upstream")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body))
+	req.Header.Set("x-api-key", "alice-secret")
+	req.Header.Set("Authorization", "Bearer user-oauth-token")
+	rr = httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rr.Code, rr.Body.String())
+	}
+	if seen.Get("x-api-key") != "" {
+		t.Fatalf("proxy key was forwarded upstream: %q", seen.Get("x-api-key"))
+	}
+	if seen.Get("Authorization") != "Bearer user-oauth-token" {
+		t.Fatalf("expected the client's own credential to be relayed, got %q", seen.Get("Authorization"))
+	}
+
+	// /health stays open; /status and /metrics need a key.
+	rr = httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected /health to be open, got %d", rr.Code)
+	}
+	for _, path := range []string{"/status", "/metrics"} {
+		rr = httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401 for %s without a key, got %d", path, rr.Code)
+		}
+		req = httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("x-api-key", "alice-secret")
+		rr = httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected %s with a key to succeed, got %d", path, rr.Code)
+		}
+	}
+}
+
+func TestRequireClient_RestrictsRoutes(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "anthropic",
+		Providers: map[string]ProviderConfig{
+			"anthropic": {Type: ProviderTypePassthrough, URL: upstream.URL},
+			"openai":    {Type: ProviderTypeOpenAI, URL: upstream.URL, Model: "gpt-5-mini", Retry: RetryConfig{MaxAttempts: 1}},
+		},
+		Presets: map[string]PresetConfig{
+			"fast": {Provider: "openai"},
+			"slow": {Provider: "openai"},
+		},
+		Clients: map[string]ClientConfig{
+			"ci": {key: "ci-secret", Providers: []string{"openai"}, Presets: []string{"fast"}},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+
+	send := func(path, system string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{
+			"model":    "claude",
+			"system":   system,
+			"messages": []map[string]string{{"role": "user", "content": "hi"}},
+		})
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer ci-secret")
+		rr := httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send("/v1/messages", "plain"); rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "may not use provider anthropic") {
+		t.Fatalf("expected default route to be forbidden, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := send("/v1/messages", "@slow"); rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "may not use preset slow") {
+		t.Fatalf("expected preset to be forbidden, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := send("/v1/messages/count_tokens", "plain"); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected count_tokens to be forbidden, got %d %s", rr.Code, rr.Body.String())
+	}
+	// An allowed route reaches the upstream (which fails here).
+	if rr := send("/v1/messages", "@fast"); rr.Code == http.StatusForbidden {
+		t.Fatalf("expected allowed preset to pass, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr := send("/v1/chat/completions", "@route:anthropic")
+	var resp struct {
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusForbidden || resp.Error.Type != AnthropicErrPermission {
+		t.Fatalf("expected OpenAI-style 403, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAuthorizeRoute_DropsForbiddenFallbacks(t *testing.T) {
+	cfg := &Config{Clients: map[string]ClientConfig{"ci": {Providers: []string{"a", "c"}}}}
+	r := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	var gotClient string
+	s := &Server{logger: NewLogger()}
+	s.cfg.Store(&Config{Clients: map[string]ClientConfig{"ci": {key: "k"}}})
+	r.Header.Set("x-api-key", "k")
+	s.requireClient(func(w http.ResponseWriter, r *http.Request) {
+		gotClient = requestClient(r)
+		route := &RouteResolution{ProviderName: "a", Fallback: []string{"b", "c"}}
+		if err := authorizeRoute(cfg, r, route); err != nil {
+			t.Fatalf("authorizeRoute error: %v", err)
+		}
+		if len(route.Fallback) != 1 || route.Fallback[0] != "c" {
+			t.Fatalf("expected only fallback c, got %v", route.Fallback)
+		}
+	}, writeJSONError)(httptest.NewRecorder(), r)
+	if gotClient != "ci" {
+		t.Fatalf("expected client ci, got %q", gotClient)
+	}
+}
@@ -54,14 +54,12 @@ func LoadConfig(path string) (*Config, error) {
 		if p.URL == "" {
 			return nil, fmt.Errorf("providers.%s.url is required", name)
 		}
-		switch p.Type {
-		case ProviderTypePassthrough, ProviderTypeOpenAI, ProviderTypeChatGPT:
-		default:
-			return nil, fmt.Errorf("providers.%s.type must be one of passthrough/openai/chatgpt", name)
+		impl, ok := LookupProvider(p.Type)
+		if !ok {
+			return nil, fmt.Errorf("providers.%s.type must be one of %s", name, strings.Join(RegisteredProviderTypes(), "/"))
 		}
-
-		if p.Type != ProviderTypePassthrough && p.Model == "" {
-			return nil, fmt.Errorf("providers.%s.model is required for type %s", name, p.Type)
+		if err := impl.Validate(name, p); err != nil {
+			return nil, err
 		}
 		if p.ReasoningEffort != "" && !IsValidReasoningEffort(p.ReasoningEffort) {
 			return nil, fmt.Errorf("providers.%s.reasoning_effort must be one of none/minimal/low/medium/high/xhigh", name)
@@ -71,10 +69,25 @@ func LoadConfig(path string) (*Config, error) {
 			return nil, fmt.Errorf("providers.%s.service_tier must be one of priority/flex", name)
 		}
 
+		if err := normalizeRetry("providers."+name, p.Retry); err != nil {
+			return nil, err
+		}
+		if err := normalizeLimits("providers."+name, p.Limits); err != nil {
+			return nil, err
+		}
+		if p.Circuit.CooldownSeconds < 0 {
+			return nil, fmt.Errorf("providers.%s.circuit.cooldown_seconds must be >= 0", name)
+		}
+		timeouts, err := normalizeTimeouts("providers."+name, p.Timeouts, cfg.TimeoutSeconds)
+		if err != nil {
+			return nil, err
+		}
+		p.Timeouts = timeouts
+
 		switch p.Auth.Type {
-		case "", AuthTypeNone, AuthTypeBearer, AuthTypeCodex:
+		case "", AuthTypeNone, AuthTypeBearer, AuthTypeCodex, AuthTypeAPIKey:
 		default:
-			return nil, fmt.Errorf("providers.%s.auth.type must be none/bearer/codex", name)
+			return nil, fmt.Errorf("providers.%s.auth.type must be none/bearer/codex/api_key", name)
 		}
 
 		cfg.Providers[name] = p
@@ -84,6 +97,20 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("default_provider %q is not defined in providers", cfg.DefaultProvider)
 	}
 
+	for name, provider := range cfg.Providers {
+		fallback, err := normalizeFallback(cfg, "providers."+name, name, provider.Fallback)
+		if err != nil {
+			return nil, err
+		}
+		provider.Fallback = fallback
+		split, err := normalizeSplit(cfg, "providers."+name, provider.Split)
+		if err != nil {
+			return nil, err
+		}
+		provider.Split = split
+		cfg.Providers[name] = provider
+	}
+
 	if cfg.Presets == nil {
 		cfg.Presets = map[string]PresetConfig{}
 	}
@@ -100,8 +127,51 @@ func LoadConfig(path string) (*Config, error) {
 		if preset.ServiceTier != "" && !IsValidServiceTier(preset.ServiceTier) {
 			return nil, fmt.Errorf("presets.%s.service_tier must be one of priority/flex", name)
 		}
+		fallback, err := normalizeFallback(cfg, "presets."+name, preset.Provider, preset.Fallback)
+		if err != nil {
+			return nil, err
+		}
+		preset.Fallback = fallback
+		split, err := normalizeSplit(cfg, "presets."+name, preset.Split)
+		if err != nil {
+			return nil, err
+		}
+		preset.Split = split
 		cfg.Presets[name] = preset
 	}
 
+	if err := compileRules(cfg); err != nil {
+		return nil, err
+	}
+	if err := normalizeClients(cfg); err != nil {
+		return nil, err
+	}
+	if err := normalizeUsage(cfg); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
+
+// normalizeFallback trims a fallback list and checks that every entry names a
+// defined provider other than the one it falls back from.
+func normalizeFallback(cfg *Config, field, self string, fallback []string) ([]string, error) {
+	if len(fallback) == 0 {
+		return nil, nil
+	}
+	out := make([]string, 0, len(fallback))
+	for _, name := range fallback {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := cfg.Providers[name]; !ok {
+			return nil, fmt.Errorf("%s.fallback %q is not defined in providers", field, name)
+		}
+		if name == self {
+			return nil, fmt.Errorf("%s.fallback must not contain the provider itself", field)
+		}
+		out = append(out, name)
+	}
+	return out, nil
+}
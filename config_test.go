@@ -233,3 +233,79 @@ providers:
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestLoadConfig_Fallback(t *testing.T) {
+	path := writeTempConfig(t, `
+listen: ":9999"
+spoof_model: "claude-test"
+default_provider: codex
+timeout_seconds: 300
+providers:
+  codex:
+    type: chatgpt
+    url: "https://chatgpt.com/backend-api/codex/responses"
+    model: "gpt-5-codex"
+    fallback: [" openai ", anthropic]
+  openai:
+    type: openai
+    url: "https://api.openai.com/v1/chat/completions"
+    model: "gpt-5-mini"
+  anthropic:
+    type: passthrough
+    url: "https://api.anthropic.com"
+presets:
+  fast:
+    provider: codex
+    fallback: [anthropic]
+`)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig error: %v", err)
+	}
+	got := cfg.Providers["codex"].Fallback
+	if len(got) != 2 || got[0] != "openai" || got[1] != "anthropic" {
+		t.Fatalf("unexpected fallback normalization: %v", got)
+	}
+	if got := cfg.Presets["fast"].Fallback; len(got) != 1 || got[0] != "anthropic" {
+		t.Fatalf("unexpected preset fallback: %v", got)
+	}
+}
+
+func TestLoadConfig_InvalidFallback(t *testing.T) {
+	path := writeTempConfig(t, `
+listen: ":9999"
+spoof_model: "claude-test"
+default_provider: codex
+timeout_seconds: 300
+providers:
+  codex:
+    type: chatgpt
+    url: "https://chatgpt.com/backend-api/codex/responses"
+    model: "gpt-5-codex"
+    fallback: [missing]
+`)
+
+	_, err := LoadConfig(path)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if !strings.Contains(err.Error(), `providers.codex.fallback "missing" is not defined`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadConfig_InvalidRetry(t *testing.T) {
+	cases := map[string]string{
+		"negative attempts": "max_attempts: -1",
+		"base above max":    "base_delay_ms: 500\n      max_delay_ms: 100",
+		"jitter":            "jitter: 1.5",
+		"status":            "statuses: [200]",
+	}
+	for name, retry := range cases {
+		cfg := "listen: \":0\"\nspoof_model: m\ndefault_provider: p\ntimeout_seconds: 30\nproviders:\n  p:\n    type: passthrough\n    url: \"https://api.anthropic.com\"\n    retry:\n      " + retry + "\n"
+		if _, err := LoadConfig(writeTempConfig(t, cfg)); err == nil {
+			t.Fatalf("%s: expected LoadConfig to fail", name)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Anthropic error types, as reported in the error.type field.
+const (
+	AnthropicErrInvalidRequest  = "invalid_request_error"
+	AnthropicErrAuthentication  = "authentication_error"
+	AnthropicErrPermission      = "permission_error"
+	AnthropicErrNotFound        = "not_found_error"
+	AnthropicErrRequestTooLarge = "request_too_large"
+	AnthropicErrRateLimit       = "rate_limit_error"
+	AnthropicErrAPI             = "api_error"
+	AnthropicErrOverloaded      = "overloaded_error"
+)
+
+// statusOverloaded is Anthropic's non-standard "overloaded" status code.
+const statusOverloaded = 529
+
+// anthropicErrorType maps an HTTP status to the Anthropic error type clients
+// expect for it.
+func anthropicErrorType(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return AnthropicErrAuthentication
+	case status == http.StatusForbidden:
+		return AnthropicErrPermission
+	case status == http.StatusNotFound:
+		return AnthropicErrNotFound
+	case status == http.StatusRequestEntityTooLarge:
+		return AnthropicErrRequestTooLarge
+	case status == http.StatusTooManyRequests:
+		return AnthropicErrRateLimit
+	case status == http.StatusServiceUnavailable || status == statusOverloaded:
+		return AnthropicErrOverloaded
+	case status >= 500:
+		return AnthropicErrAPI
+	case status >= 400:
+		return AnthropicErrInvalidRequest
+	default:
+		return AnthropicErrAPI
+	}
+}
+
+func anthropicErrorBody(errType, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "error",
+		"error": map[string]interface{}{
+			"type":    errType,
+			"message": message,
+		},
+	}
+}
+
+func writeAnthropicError(w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(w, status, anthropicErrorBody(errType, message))
+}
+
+// writeAnthropicStreamError emits an Anthropic "error" SSE event. It is used
+// once the stream has started and an HTTP status can no longer be sent.
+func writeAnthropicStreamError(w io.Writer, errType, message string) error {
+	return writeAnthropicSSEEvent(w, "error", anthropicErrorBody(errType, message))
+}
+
+// upstreamError is an OpenAI or Responses API error classified into its
+// Anthropic equivalent.
+type upstreamError struct {
+	Status  int
+	Type    string
+	Message string
+}
+
+func (e *upstreamError) Error() string {
+	return fmt.Sprintf("%s (status %d): %s", e.Type, e.Status, e.Message)
+}
+
+// classifyUpstreamError maps an OpenAI-style error (HTTP status plus the
+// error code/type/message from the body) onto an Anthropic error type and
+// status. Context-length failures are reported the way Anthropic does so that
+// Claude Code triggers compaction.
+func classifyUpstreamError(status int, code, errType, message string) *upstreamError {
+	key := strings.ToLower(code + " " + errType)
+	lowerMsg := strings.ToLower(message)
+	if strings.TrimSpace(message) == "" {
+		message = http.StatusText(status)
+		if message == "" {
+			message = "upstream error"
+		}
+	}
+
+	switch {
+	case strings.Contains(key, "context_length_exceeded") ||
+		strings.Contains(lowerMsg, "maximum context length") ||
+		strings.Contains(lowerMsg, "context window"):
+		return &upstreamError{Status: http.StatusBadRequest, Type: AnthropicErrInvalidRequest, Message: "prompt is too long: " + message}
+	case strings.Contains(key, "usage_limit_reached") ||
+		strings.Contains(key, "usage_not_included") ||
+		strings.Contains(key, "rate_limit") ||
+		strings.Contains(key, "insufficient_quota"):
+		return &upstreamError{Status: http.StatusTooManyRequests, Type: AnthropicErrRateLimit, Message: message}
+	case strings.Contains(key, "server_is_overloaded") || strings.Contains(key, "overloaded"):
+		return &upstreamError{Status: statusOverloaded, Type: AnthropicErrOverloaded, Message: message}
+	case strings.Contains(key, "invalid_api_key") || strings.Contains(key, "authentication"):
+		return &upstreamError{Status: http.StatusUnauthorized, Type: AnthropicErrAuthentication, Message: message}
+	}
+
+	if status < 400 {
+		// Mid-stream failures carry no HTTP status of their own.
+		if strings.Contains(key, "invalid") {
+			status = http.StatusBadRequest
+		} else {
+			status = http.StatusInternalServerError
+		}
+	}
+	if status == http.StatusUnprocessableEntity {
+		status = http.StatusBadRequest
+	}
+	return &upstreamError{Status: status, Type: anthropicErrorType(status), Message: message}
+}
+
+// parseUpstreamErrorBody extracts code, type and message from an OpenAI-style
+// error payload. Both {"error":{...}} and flat {"code":..,"message":..} shapes
+// are accepted, as well as FastAPI-style {"detail":"..."}.
+func parseUpstreamErrorBody(raw []byte) (code, errType, message string) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return "", "", strings.TrimSpace(string(raw))
+	}
+	return parseUpstreamErrorObject(payload)
+}
+
+func parseUpstreamErrorObject(payload map[string]interface{}) (code, errType, message string) {
+	obj := payload
+	switch v := payload["error"].(type) {
+	case map[string]interface{}:
+		obj = v
+	case string:
+		return "", "", v
+	}
+	code = stringifyErrorField(obj["code"])
+	errType, _ = obj["type"].(string)
+	message, _ = obj["message"].(string)
+	if message == "" {
+		message, _ = payload["detail"].(string)
+	}
+	return code, errType, message
+}
+
+func stringifyErrorField(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return fmt.Sprintf("%d", int(t))
+	default:
+		return ""
+	}
+}
+
+// writeAnthropicUpstreamError reads a translated provider's error response
+// and writes it to the client as an Anthropic error envelope.
+func writeAnthropicUpstreamError(w http.ResponseWriter, resp *http.Response) {
+	raw, _ := readResponseBody(resp)
+	code, errType, message := parseUpstreamErrorBody(raw)
+	classified := classifyUpstreamError(resp.StatusCode, code, errType, message)
+	writeAnthropicError(w, classified.Status, classified.Type, classified.Message)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnthropicErrorType(t *testing.T) {
+	cases := map[int]string{
+		400: AnthropicErrInvalidRequest,
+		401: AnthropicErrAuthentication,
+		403: AnthropicErrPermission,
+		404: AnthropicErrNotFound,
+		413: AnthropicErrRequestTooLarge,
+		429: AnthropicErrRateLimit,
+		500: AnthropicErrAPI,
+		502: AnthropicErrAPI,
+		503: AnthropicErrOverloaded,
+		529: AnthropicErrOverloaded,
+	}
+	for status, want := range cases {
+		if got := anthropicErrorType(status); got != want {
+			t.Fatalf("status %d: expected %s, got %s", status, want, got)
+		}
+	}
+}
+
+func TestClassifyUpstreamError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		code       string
+		errType    string
+		message    string
+		wantStatus int
+		wantType   string
+	}{
+		{"context length", 400, "context_length_exceeded", "invalid_request_error", "too many tokens", 400, AnthropicErrInvalidRequest},
+		{"codex usage limit", 429, "", "usage_limit_reached", "limit hit", 429, AnthropicErrRateLimit},
+		{"quota on 403", 403, "insufficient_quota", "", "no credit", 429, AnthropicErrRateLimit},
+		{"bad key", 401, "invalid_api_key", "", "bad key", 401, AnthropicErrAuthentication},
+		{"unprocessable", 422, "", "", "bad schema", 400, AnthropicErrInvalidRequest},
+		{"mid-stream server error", 0, "", "server_error", "boom", 500, AnthropicErrAPI},
+		{"mid-stream overloaded", 0, "server_is_overloaded", "", "busy", 529, AnthropicErrOverloaded},
+	}
+	for _, tt := range tests {
+		got := classifyUpstreamError(tt.status, tt.code, tt.errType, tt.message)
+		if got.Status != tt.wantStatus || got.Type != tt.wantType {
+			t.Fatalf("%s: unexpected classification %+v", tt.name, got)
+		}
+	}
+
+	got := classifyUpstreamError(400, "context_length_exceeded", "", "maximum context length is 128k")
+	if got.Message != "prompt is too long: maximum context length is 128k" {
+		t.Fatalf("unexpected context length message: %q", got.Message)
+	}
+}
+
+func TestParseUpstreamErrorBody(t *testing.T) {
+	code, errType, message := parseUpstreamErrorBody([]byte(`{"error":{"code":429,"type":"rate_limit","message":"slow down"}}`))
+	if code != "429" || errType != "rate_limit" || message != "slow down" {
+		t.Fatalf("unexpected nested parse: %q %q %q", code, errType, message)
+	}
+	_, _, message = parseUpstreamErrorBody([]byte(`{"detail":"not allowed"}`))
+	if message != "not allowed" {
+		t.Fatalf("unexpected detail parse: %q", message)
+	}
+	_, _, message = parseUpstreamErrorBody([]byte("plain text failure\n"))
+	if message != "plain text failure" {
+		t.Fatalf("unexpected plain parse: %q", message)
+	}
+}
+
+func TestWriteJSONError_AnthropicEnvelope(t *testing.T) {
+	rr := httptest.NewRecorder()
+	writeJSONError(rr, http.StatusNotFound, "missing")
+
+	var out struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if out.Type != "error" || out.Error.Type != AnthropicErrNotFound || out.Error.Message != "missing" {
+		t.Fatalf("unexpected envelope: %+v", out)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitCooldown         = 30 * time.Second
+)
+
+func (c CircuitConfig) enabled() bool {
+	return c.FailureThreshold >= 0
+}
+
+func (c CircuitConfig) threshold() int {
+	if c.FailureThreshold > 0 {
+		return c.FailureThreshold
+	}
+	return defaultCircuitFailureThreshold
+}
+
+func (c CircuitConfig) cooldown() time.Duration {
+	if c.CooldownSeconds > 0 {
+		return time.Duration(c.CooldownSeconds) * time.Second
+	}
+	return defaultCircuitCooldown
+}
+
+// circuitOpenError rejects a request to a provider whose circuit is open.
+type circuitOpenError struct {
+	provider string
+	retryAt  time.Time
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("provider %s is unavailable (circuit open until %s)", e.provider, e.retryAt.UTC().Format(time.RFC3339))
+}
+
+// ProviderStatus is the passive health of one provider as shown by /status.
+type ProviderStatus struct {
+	Type                string     `json:"type"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Successes           int64      `json:"successes"`
+	Failures            int64      `json:"failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+}
+
+type providerHealth struct {
+	status  ProviderStatus
+	probing bool
+}
+
+// healthTracker keeps a circuit breaker per provider, fed by the outcome of
+// every upstream request. Providers are tracked by name, so state survives
+// config reloads.
+type healthTracker struct {
+	mu        sync.Mutex
+	providers map[string]*providerHealth
+	now       func() time.Time
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{providers: map[string]*providerHealth{}, now: time.Now}
+}
+
+func (h *healthTracker) get(name string) *providerHealth {
+	p, ok := h.providers[name]
+	if !ok {
+		p = &providerHealth{status: ProviderStatus{State: circuitClosed}}
+		h.providers[name] = p
+	}
+	return p
+}
+
+// allow reports whether a request may be sent to the provider. Once an open
+// circuit has cooled down, a single probe request is let through.
+func (h *healthTracker) allow(name string, c CircuitConfig) error {
+	if h == nil || !c.enabled() {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	p := h.get(name)
+	switch p.status.State {
+	case circuitOpen:
+		retryAt := p.status.OpenedAt.Add(c.cooldown())
+		if h.now().Before(retryAt) {
+			return &circuitOpenError{provider: name, retryAt: retryAt}
+		}
+		p.status.State = circuitHalfOpen
+		p.probing = true
+	case circuitHalfOpen:
+		if p.probing {
+			return &circuitOpenError{provider: name, retryAt: h.now()}
+		}
+		p.probing = true
+	}
+	return nil
+}
+
+// isOpen reports whether another request has opened the provider's circuit.
+func (h *healthTracker) isOpen(name string) bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	p, ok := h.providers[name]
+	return ok && p.status.State == circuitOpen
+}
+
+// record notes the outcome of a request, failure being nil on success, and
+// reports whether it opened the circuit.
+func (h *healthTracker) record(name string, c CircuitConfig, failure error) bool {
+	if h == nil || !c.enabled() {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	p := h.get(name)
+	now := h.now()
+	p.probing = false
+	if failure == nil {
+		p.status.Successes++
+		p.status.ConsecutiveFailures = 0
+		p.status.LastSuccess = &now
+		p.status.State = circuitClosed
+		p.status.OpenedAt = nil
+		return false
+	}
+	p.status.Failures++
+	p.status.ConsecutiveFailures++
+	p.status.LastFailure = &now
+	p.status.LastError = truncateForLog(failure.Error(), 300)
+	if p.status.State == circuitOpen || (p.status.State == circuitClosed && p.status.ConsecutiveFailures < c.threshold()) {
+		return false
+	}
+	p.status.State = circuitOpen
+	p.status.OpenedAt = &now
+	return true
+}
+
+// release gives up a probe slot without an outcome, e.g. when the client
+// disconnected.
+func (h *healthTracker) release(name string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if p, ok := h.providers[name]; ok {
+		p.probing = false
+	}
+}
+
+// snapshot returns the status of every configured provider.
+func (h *healthTracker) snapshot(cfg *Config) map[string]ProviderStatus {
+	out := make(map[string]ProviderStatus, len(cfg.Providers))
+	if h != nil {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+	}
+	for name, provider := range cfg.Providers {
+		status := ProviderStatus{State: circuitClosed}
+		if h != nil {
+			if p, ok := h.providers[name]; ok {
+				status = p.status
+			}
+		}
+		status.Type = provider.Type
+		if !provider.Circuit.enabled() {
+			status.State = "disabled"
+		}
+		if status.State == circuitOpen && status.OpenedAt != nil {
+			retryAt := status.OpenedAt.Add(provider.Circuit.cooldown())
+			status.RetryAt = &retryAt
+		}
+		out[name] = status
+	}
+	return out
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"providers": s.health.snapshot(s.config()),
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthTracker_CircuitStates(t *testing.T) {
+	h := newHealthTracker()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return now }
+	circuit := CircuitConfig{FailureThreshold: 2, CooldownSeconds: 10}
+	down := errors.New("connection refused")
+
+	if h.record("openrouter", circuit, down) {
+		t.Fatal("one failure must not open the circuit")
+	}
+	if !h.record("openrouter", circuit, down) {
+		t.Fatal("expected the second failure to open the circuit")
+	}
+	var open *circuitOpenError
+	if err := h.allow("openrouter", circuit); !errors.As(err, &open) {
+		t.Fatalf("expected open circuit to reject, got %v", err)
+	}
+
+	// After the cooldown one probe goes through; others wait for its result.
+	now = now.Add(11 * time.Second)
+	if err := h.allow("openrouter", circuit); err != nil {
+		t.Fatalf("expected a probe after cooldown, got %v", err)
+	}
+	if err := h.allow("openrouter", circuit); err == nil {
+		t.Fatal("expected only one half-open probe")
+	}
+	if !h.record("openrouter", circuit, down) {
+		t.Fatal("a failed probe should reopen the circuit")
+	}
+
+	now = now.Add(11 * time.Second)
+	if err := h.allow("openrouter", circuit); err != nil {
+		t.Fatalf("expected a probe after cooldown, got %v", err)
+	}
+	h.record("openrouter", circuit, nil)
+	status := h.snapshot(&Config{Providers: map[string]ProviderConfig{"openrouter": {Type: ProviderTypeOpenAI}}})["openrouter"]
+	if status.State != circuitClosed || status.ConsecutiveFailures != 0 || status.Failures != 3 || status.Successes != 1 {
+		t.Fatalf("unexpected status after recovery: %+v", status)
+	}
+
+	disabled := CircuitConfig{FailureThreshold: -1}
+	for i := 0; i < 10; i++ {
+		h.record("ollama", disabled, down)
+	}
+	if err := h.allow("ollama", disabled); err != nil {
+		t.Fatalf("disabled breaker must not reject, got %v", err)
+	}
+}
+
+func TestServeProvider_OpenCircuitFallsBackWithoutCalling(t *testing.T) {
+	primaryCalls := 0
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(OpenAIChatResponse{
+			Choices: []OpenAIChoice{{Message: OpenAIMessage{Role: "assistant", Content: "from fallback"}, FinishReason: "stop"}},
+		})
+	}))
+	defer secondary.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "primary",
+		Providers: map[string]ProviderConfig{
+			"primary": {
+				Type: ProviderTypeOpenAI, URL: primary.URL, Model: "a", Fallback: []string{"secondary"},
+				Retry:   RetryConfig{MaxAttempts: 1},
+				Circuit: CircuitConfig{FailureThreshold: 2, CooldownSeconds: 60},
+			},
+			"secondary": {Type: ProviderTypeOpenAI, URL: secondary.URL, Model: "b"},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+
+	body := []byte(`{"model":"claude","messages":[{"role":"user","content":"hi"}]}`)
+	for i := 0; i < 4; i++ {
+		rr := httptest.NewRecorder()
+		s.handleMessages(rr, httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body)))
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "from fallback") {
+			t.Fatalf("request %d: expected fallback response, got %d %s", i, rr.Code, rr.Body.String())
+		}
+	}
+	if primaryCalls != 2 {
+		t.Fatalf("expected the open circuit to stop calls after 2 failures, got %d", primaryCalls)
+	}
+
+	rr := httptest.NewRecorder()
+	s.handleStatus(rr, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var status struct {
+		Providers map[string]ProviderStatus `json:"providers"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+		t.Fatalf("invalid /status body: %v", err)
+	}
+	p := status.Providers["primary"]
+	if p.State != circuitOpen || p.ConsecutiveFailures != 2 || p.RetryAt == nil || !strings.Contains(p.LastError, "502") {
+		t.Fatalf("unexpected primary status: %+v", p)
+	}
+	if status.Providers["secondary"].State != circuitClosed || status.Providers["secondary"].Successes != 4 {
+		t.Fatalf("unexpected secondary status: %+v", status.Providers["secondary"])
+	}
+}
+
+func TestServeProvider_OpenCircuitWithoutFallbackFailsFast(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "openai",
+		Providers: map[string]ProviderConfig{
+			"openai": {Type: ProviderTypeOpenAI, URL: upstream.URL, Model: "a", Retry: RetryConfig{MaxAttempts: 1}, Circuit: CircuitConfig{FailureThreshold: 1}},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+	body := []byte(`{"model":"claude","messages":[{"role":"user","content":"hi"}]}`)
+
+	rr := httptest.NewRecorder()
+	s.handleMessages(rr, httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body)))
+	rr = httptest.NewRecorder()
+	s.handleMessages(rr, httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body)))
+	if rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "circuit open") {
+		t.Fatalf("expected a fast 503, got %d %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+// defaultAnthropicVersion is sent to relaying providers when a translated
+// inbound request did not carry an anthropic-version header.
+const defaultAnthropicVersion = "2023-06-01"
+
+// newTranslatedCall builds the ProviderCall for an inbound request that was
+// translated to Anthropic Messages from another client API. Relaying providers
+// see it as a POST to /v1/messages carrying the translated body. Routing
+// markers are stripped first unless strip_markers is off.
+func (s *Server) newTranslatedCall(cfg *Config, requestID string, route *RouteResolution, req AnthropicMessageRequest, r *http.Request) (*ProviderCall, error) {
+	if cfg.StripMarkersEnabled() {
+		_, _, _ = StripRoutingMarkers(&req, nil, configPresetNames(cfg))
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	inbound := r.Clone(r.Context())
+	inbound.Method = http.MethodPost
+	inbound.URL.Path = "/v1/messages"
+	inbound.URL.RawQuery = ""
+	inbound.Header.Set("Content-Type", "application/json")
+	// The translated stream is parsed, so it must not arrive compressed.
+	inbound.Header.Del("Accept-Encoding")
+	if inbound.Header.Get("anthropic-version") == "" {
+		inbound.Header.Set("anthropic-version", defaultAnthropicVersion)
+	}
+
+	return &ProviderCall{
+		Server:    s,
+		Config:    cfg,
+		RequestID: requestID,
+		Route:     route,
+		Request:   req,
+		Body:      body,
+		Inbound:   inbound,
+	}, nil
+}
+
+// anthropicResponseSink is the http.ResponseWriter handed to serveProvider by
+// inbound endpoints that speak another API. Successful streams are split into
+// SSE events and passed to onEvent as they complete; error responses and
+// non-stream bodies are buffered for the endpoint to re-encode.
+type anthropicResponseSink struct {
+	header http.Header
+	status int
+	stream bool
+	events sseEventSplitter
+	body   bytes.Buffer
+	err    error
+}
+
+func newAnthropicResponseSink(stream bool, onEvent func(eventName, data string) error) *anthropicResponseSink {
+	return &anthropicResponseSink{header: http.Header{}, stream: stream, events: sseEventSplitter{onEvent: onEvent}}
+}
+
+func (s *anthropicResponseSink) Header() http.Header {
+	return s.header
+}
+
+func (s *anthropicResponseSink) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+}
+
+func (s *anthropicResponseSink) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.WriteHeader(http.StatusOK)
+	}
+	if !s.streaming() {
+		return s.body.Write(p)
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	if err := s.events.Write(p); err != nil {
+		s.err = err
+		return len(p), err
+	}
+	return len(p), nil
+}
+
+// Flush satisfies http.Flusher; events are forwarded as soon as they are
+// complete, so there is nothing to flush here.
+func (s *anthropicResponseSink) Flush() {}
+
+func (s *anthropicResponseSink) streaming() bool {
+	return s.stream && s.status < 400
+}
+
+// failed reports whether the provider answered with an error status (or wrote
+// nothing at all).
+func (s *anthropicResponseSink) failed() bool {
+	return s.status == 0 || s.status >= 400
+}
+
+// anthropicError extracts the error type and message from a buffered Anthropic
+// error envelope.
+func (s *anthropicResponseSink) anthropicError() (status int, errType, message string) {
+	status = s.status
+	if status == 0 {
+		status = http.StatusBadGateway
+	}
+	_, errType, message = parseUpstreamErrorBody(s.body.Bytes())
+	if errType == "" {
+		errType = anthropicErrorType(status)
+	}
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return status, errType, message
+}
@@ -0,0 +1,587 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultInboundMaxTokens is used when an OpenAI client omits max_tokens,
+// which Anthropic Messages requires.
+const defaultInboundMaxTokens = 8192
+
+// handleChatCompletions serves OpenAI Chat Completions clients. The request is
+// translated to Anthropic Messages, routed like /v1/messages, and the Anthropic
+// response is translated back to Chat Completions.
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, AnthropicErrInvalidRequest, "method not allowed")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 16<<20))
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, AnthropicErrInvalidRequest, "invalid request body")
+		return
+	}
+
+	var chatReq ChatCompletionsRequest
+	if err := json.Unmarshal(body, &chatReq); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, AnthropicErrInvalidRequest, "invalid JSON")
+		return
+	}
+	anthropicReq, err := TranslateChatCompletionsToAnthropic(chatReq)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, AnthropicErrInvalidRequest, err.Error())
+		return
+	}
+
+	cfg := s.config()
+	resolved, err := ResolveAll(anthropicReq.System, anthropicReq.Messages, cfg, NewRuleInput(anthropicReq, r))
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, AnthropicErrInvalidRequest, err.Error())
+		return
+	}
+	if err := authorizeRoute(cfg, r, resolved); err != nil {
+		writeOpenAIError(w, http.StatusForbidden, AnthropicErrPermission, err.Error())
+		return
+	}
+	requestID := inboundRequestID(r)
+	s.logResolvedRoute(r, requestID, resolved, chatReq.Stream)
+
+	call, err := s.newTranslatedCall(cfg, requestID, resolved, anthropicReq, r)
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, AnthropicErrAPI, err.Error())
+		return
+	}
+
+	model := chatReq.Model
+	if model == "" {
+		model = resolved.Model
+	}
+	encoder := newChatCompletionsStreamEncoder(w, model)
+	encoder.includeUsage = chatReq.StreamOptions != nil && chatReq.StreamOptions.IncludeUsage
+	sink := newAnthropicResponseSink(chatReq.Stream, encoder.onEvent)
+	s.serveProvider(r.Context(), sink, call)
+
+	if sink.failed() {
+		status, errType, message := sink.anthropicError()
+		if encoder.started {
+			_ = encoder.writeError(errType, message)
+			return
+		}
+		writeOpenAIError(w, status, errType, message)
+		return
+	}
+	if chatReq.Stream {
+		if err := encoder.finish(); err != nil {
+			s.logger.Errorf("req=%s chat completions stream failed: %v", requestID, err)
+		}
+		return
+	}
+
+	var anthropicResp AnthropicMessageResponse
+	if err := json.Unmarshal(sink.body.Bytes(), &anthropicResp); err != nil {
+		writeOpenAIError(w, http.StatusBadGateway, AnthropicErrAPI, "invalid upstream response: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, convertAnthropicToChatCompletion(anthropicResp, model))
+}
+
+// TranslateChatCompletionsToAnthropic converts an inbound Chat Completions
+// request to Anthropic Messages. System and developer messages become the
+// system prompt, so routing markers placed there are honoured.
+func TranslateChatCompletionsToAnthropic(req ChatCompletionsRequest) (AnthropicMessageRequest, error) {
+	maxTokens := req.MaxCompletionTokens
+	if maxTokens <= 0 {
+		maxTokens = req.MaxTokens
+	}
+	if maxTokens <= 0 {
+		maxTokens = defaultInboundMaxTokens
+	}
+
+	out := AnthropicMessageRequest{
+		Model:     req.Model,
+		MaxTokens: maxTokens,
+		Stream:    req.Stream,
+	}
+
+	systemParts := make([]string, 0, 1)
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case "system", "developer":
+			if text := openAIContentText(msg.Content); text != "" {
+				systemParts = append(systemParts, text)
+			}
+		case "user":
+			out.Messages = appendAnthropicMessage(out.Messages, "user", translateChatContentToAnthropic(msg.Content))
+		case "assistant":
+			blocks := translateChatContentToAnthropic(msg.Content)
+			for _, call := range msg.ToolCalls {
+				blocks = append(blocks, AnthropicContentBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: toolArgumentsToInput(call.Function.Arguments),
+				})
+			}
+			if len(blocks) == 0 {
+				continue
+			}
+			out.Messages = appendAnthropicMessage(out.Messages, "assistant", blocks)
+		case "tool":
+			out.Messages = appendAnthropicMessage(out.Messages, "user", []AnthropicContentBlock{{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   openAIContentText(msg.Content),
+			}})
+		default:
+			return AnthropicMessageRequest{}, fmt.Errorf("unsupported message role %q", msg.Role)
+		}
+	}
+	if len(systemParts) > 0 {
+		out.System = strings.Join(systemParts, "\n\n")
+	}
+	if len(out.Messages) == 0 {
+		return AnthropicMessageRequest{}, fmt.Errorf("messages must contain at least one user or assistant message")
+	}
+
+	for _, tool := range req.Tools {
+		schema := tool.Function.Parameters
+		if len(schema) == 0 || string(schema) == "null" {
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		out.Tools = append(out.Tools, AnthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	if req.ToolChoice != nil {
+		out.ToolChoice = translateToolChoiceToAnthropic(req.ToolChoice)
+	}
+	return out, nil
+}
+
+// appendAnthropicMessage appends blocks as a message with role, merging into
+// the previous message when it has the same role; Anthropic expects user and
+// assistant turns to alternate, while OpenAI sends one message per tool result.
+func appendAnthropicMessage(messages []AnthropicMessage, role string, blocks []AnthropicContentBlock) []AnthropicMessage {
+	if n := len(messages); n > 0 && messages[n-1].Role == role {
+		if prev, ok := messages[n-1].Content.([]AnthropicContentBlock); ok {
+			messages[n-1].Content = append(prev, blocks...)
+			return messages
+		}
+	}
+	return append(messages, AnthropicMessage{Role: role, Content: blocks})
+}
+
+// translateChatContentToAnthropic converts Chat Completions message content (a
+// string or a list of parts) to Anthropic content blocks.
+func translateChatContentToAnthropic(content interface{}) []AnthropicContentBlock {
+	switch v := content.(type) {
+	case nil:
+		return nil
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []AnthropicContentBlock{{Type: "text", Text: v}}
+	case []interface{}:
+		blocks := make([]AnthropicContentBlock, 0, len(v))
+		for _, raw := range v {
+			part, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if block, ok := translateChatPartToAnthropic(part); ok {
+				blocks = append(blocks, block)
+			}
+		}
+		return blocks
+	default:
+		return nil
+	}
+}
+
+func translateChatPartToAnthropic(part map[string]interface{}) (AnthropicContentBlock, bool) {
+	partType, _ := part["type"].(string)
+	switch partType {
+	case "text", "input_text":
+		text, _ := part["text"].(string)
+		if text == "" {
+			return AnthropicContentBlock{}, false
+		}
+		return AnthropicContentBlock{Type: "text", Text: text}, true
+	case "image_url":
+		url, _ := part["image_url"].(string)
+		if obj, ok := part["image_url"].(map[string]interface{}); ok {
+			url, _ = obj["url"].(string)
+		}
+		if url == "" {
+			return AnthropicContentBlock{}, false
+		}
+		return AnthropicContentBlock{Type: "image", Source: sourceFromURL(url, "image/png")}, true
+	case "file":
+		obj, _ := part["file"].(map[string]interface{})
+		data, _ := obj["file_data"].(string)
+		filename, _ := obj["filename"].(string)
+		if data == "" {
+			return AnthropicContentBlock{Type: "text", Text: fmt.Sprintf("[file %s omitted]", filename)}, true
+		}
+		block := AnthropicContentBlock{Type: "document", Source: sourceFromURL(data, "application/pdf")}
+		if block.Source.Type == "url" {
+			// Bare file_data is base64 without the data: prefix.
+			block.Source = &AnthropicSource{Type: "base64", MediaType: "application/pdf", Data: data}
+		}
+		block.Title = filename
+		return block, true
+	default:
+		return AnthropicContentBlock{Type: "text", Text: fmt.Sprintf("[%s content omitted]", partType)}, true
+	}
+}
+
+// sourceFromURL converts a data: URL to a base64 source and anything else to
+// a url source. defaultMediaType is used when the data: URL omits it.
+func sourceFromURL(url, defaultMediaType string) *AnthropicSource {
+	if !strings.HasPrefix(url, "data:") {
+		return &AnthropicSource{Type: "url", URL: url}
+	}
+	meta, data, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	if !ok {
+		return &AnthropicSource{Type: "url", URL: url}
+	}
+	mediaType := strings.TrimSuffix(meta, ";base64")
+	if mediaType == "" {
+		mediaType = defaultMediaType
+	}
+	return &AnthropicSource{Type: "base64", MediaType: mediaType, Data: data}
+}
+
+// toolArgumentsToInput returns the tool call arguments as a JSON object,
+// falling back to {} when the model produced invalid JSON.
+func toolArgumentsToInput(arguments string) json.RawMessage {
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(arguments), &obj); err != nil || obj == nil {
+		return json.RawMessage(`{}`)
+	}
+	return json.RawMessage(arguments)
+}
+
+func translateToolChoiceToAnthropic(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		switch t {
+		case "required":
+			return map[string]interface{}{"type": "any"}
+		case "none":
+			return map[string]interface{}{"type": "none"}
+		default:
+			return map[string]interface{}{"type": "auto"}
+		}
+	case map[string]interface{}:
+		// Chat Completions nests the name under "function"; the Responses
+		// API puts it at the top level.
+		name, _ := t["name"].(string)
+		if fn, ok := t["function"].(map[string]interface{}); ok {
+			name, _ = fn["name"].(string)
+		}
+		if name != "" {
+			return map[string]interface{}{"type": "tool", "name": name}
+		}
+	}
+	return map[string]interface{}{"type": "auto"}
+}
+
+// mapStopReasonToFinishReason is the inverse of mapFinishReason.
+func mapStopReasonToFinishReason(v string) string {
+	switch v {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+func convertAnthropicToChatCompletion(resp AnthropicMessageResponse, model string) OpenAIChatResponse {
+	message := OpenAIMessage{Role: "assistant"}
+	var text strings.Builder
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			arguments := string(block.Input)
+			if arguments == "" {
+				arguments = "{}"
+			}
+			message.ToolCalls = append(message.ToolCalls, OpenAIToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: OpenAIToolFunction{Name: block.Name, Arguments: arguments},
+			})
+		}
+	}
+	if text.Len() > 0 || len(message.ToolCalls) == 0 {
+		message.Content = text.String()
+	}
+
+	return OpenAIChatResponse{
+		ID:      chatCompletionID(resp.ID),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []OpenAIChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: mapStopReasonToFinishReason(resp.StopReason),
+		}},
+		Usage: openAIUsageFromAnthropic(resp.Usage),
+	}
+}
+
+// openAIUsageFromAnthropic maps Anthropic usage back to Chat Completions
+// usage, where prompt_tokens includes cached tokens.
+func openAIUsageFromAnthropic(u AnthropicUsage) OpenAIUsage {
+	out := OpenAIUsage{
+		PromptTokens:     u.promptTokens(),
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      u.promptTokens() + u.OutputTokens,
+	}
+	if u.CacheReadInputTokens > 0 {
+		out.PromptTokensDetails = &OpenAIPromptTokensDetails{CachedTokens: u.CacheReadInputTokens}
+	}
+	return out
+}
+
+func chatCompletionID(messageID string) string {
+	if messageID == "" {
+		return fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	}
+	return "chatcmpl-" + strings.TrimPrefix(messageID, "msg_")
+}
+
+// chatCompletionsStreamEncoder re-encodes an Anthropic SSE stream as Chat
+// Completions chunks. Response headers are written with the first chunk so an
+// upstream error that arrives before any event can still set the status.
+type chatCompletionsStreamEncoder struct {
+	w            http.ResponseWriter
+	model        string
+	id           string
+	created      int64
+	includeUsage bool
+	started      bool
+	done         bool
+	// toolIndex maps Anthropic content block indexes to tool_calls indexes.
+	toolIndex map[int]int
+	usage     AnthropicUsage
+}
+
+func newChatCompletionsStreamEncoder(w http.ResponseWriter, model string) *chatCompletionsStreamEncoder {
+	return &chatCompletionsStreamEncoder{
+		w:         w,
+		model:     model,
+		id:        chatCompletionID(""),
+		created:   time.Now().Unix(),
+		toolIndex: map[int]int{},
+	}
+}
+
+func (e *chatCompletionsStreamEncoder) onEvent(_ string, data string) error {
+	if e.done {
+		return nil
+	}
+	var event AnthropicStreamEvent
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return nil
+	}
+
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			if event.Message.ID != "" {
+				e.id = chatCompletionID(event.Message.ID)
+			}
+			e.usage = event.Message.Usage
+		}
+		return e.writeChunk(map[string]interface{}{"role": "assistant", "content": ""}, nil)
+	case "content_block_start":
+		if event.ContentBlock == nil || event.ContentBlock.Type != "tool_use" {
+			return nil
+		}
+		index := len(e.toolIndex)
+		e.toolIndex[event.Index] = index
+		return e.writeChunk(map[string]interface{}{
+			"tool_calls": []interface{}{map[string]interface{}{
+				"index": index,
+				"id":    event.ContentBlock.ID,
+				"type":  "function",
+				"function": map[string]interface{}{
+					"name":      event.ContentBlock.Name,
+					"arguments": "",
+				},
+			}},
+		}, nil)
+	case "content_block_delta":
+		switch event.Delta.Type {
+		case "text_delta":
+			if event.Delta.Text == "" {
+				return nil
+			}
+			return e.writeChunk(map[string]interface{}{"content": event.Delta.Text}, nil)
+		case "input_json_delta":
+			index, ok := e.toolIndex[event.Index]
+			if !ok || event.Delta.PartialJSON == "" {
+				return nil
+			}
+			return e.writeChunk(map[string]interface{}{
+				"tool_calls": []interface{}{map[string]interface{}{
+					"index":    index,
+					"function": map[string]interface{}{"arguments": event.Delta.PartialJSON},
+				}},
+			}, nil)
+		}
+		return nil
+	case "message_delta":
+		if event.Usage != nil {
+			e.usage.addDelta(*event.Usage)
+		}
+		if event.Delta.StopReason == "" {
+			return nil
+		}
+		return e.writeChunk(map[string]interface{}{}, mapStopReasonToFinishReason(event.Delta.StopReason))
+	case "message_stop":
+		return e.finish()
+	case "ping":
+		return e.writePing()
+	case "error":
+		errType, message := AnthropicErrAPI, "upstream stream failed"
+		if event.Error != nil {
+			errType, message = event.Error.Type, event.Error.Message
+		}
+		return e.writeError(errType, message)
+	default:
+		return nil
+	}
+}
+
+func (e *chatCompletionsStreamEncoder) start() {
+	if e.started {
+		return
+	}
+	e.started = true
+	e.w.Header().Set("Content-Type", "text/event-stream")
+	e.w.Header().Set("Cache-Control", "no-cache")
+	e.w.Header().Set("Connection", "keep-alive")
+	e.w.WriteHeader(http.StatusOK)
+}
+
+func (e *chatCompletionsStreamEncoder) writeChunk(delta map[string]interface{}, finishReason interface{}) error {
+	return e.writeData(map[string]interface{}{
+		"id":      e.id,
+		"object":  "chat.completion.chunk",
+		"created": e.created,
+		"model":   e.model,
+		"choices": []interface{}{map[string]interface{}{
+			"index":         0,
+			"delta":         delta,
+			"finish_reason": finishReason,
+		}},
+	})
+}
+
+func (e *chatCompletionsStreamEncoder) writeData(payload interface{}) error {
+	e.start()
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(e.w, "data: %s\n\n", b); err != nil {
+		return err
+	}
+	if flusher, ok := e.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// writePing forwards a keepalive ping as an SSE comment, which OpenAI clients
+// ignore.
+func (e *chatCompletionsStreamEncoder) writePing() error {
+	e.start()
+	if _, err := io.WriteString(e.w, ": ping\n\n"); err != nil {
+		return err
+	}
+	if flusher, ok := e.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// writeError ends the stream with an OpenAI-style error chunk.
+func (e *chatCompletionsStreamEncoder) writeError(errType, message string) error {
+	e.done = true
+	return e.writeData(map[string]interface{}{"error": openAIErrorObject(errType, message)})
+}
+
+// finish writes the usage chunk (when requested) and the [DONE] sentinel.
+func (e *chatCompletionsStreamEncoder) finish() error {
+	if e.done {
+		return nil
+	}
+	e.done = true
+	if e.includeUsage {
+		if err := e.writeData(map[string]interface{}{
+			"id":      e.id,
+			"object":  "chat.completion.chunk",
+			"created": e.created,
+			"model":   e.model,
+			"choices": []interface{}{},
+			"usage":   openAIUsageFromAnthropic(e.usage),
+		}); err != nil {
+			return err
+		}
+	}
+	e.start()
+	if _, err := io.WriteString(e.w, "data: [DONE]\n\n"); err != nil {
+		return err
+	}
+	if flusher, ok := e.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// openAIErrorObject converts an Anthropic error type and message to the
+// OpenAI error object, setting the codes OpenAI clients act on.
+func openAIErrorObject(errType, message string) OpenAIError {
+	out := OpenAIError{Message: message, Type: errType}
+	switch {
+	case strings.HasPrefix(message, "prompt is too long"):
+		out.Code = "context_length_exceeded"
+	case errType == AnthropicErrRateLimit:
+		out.Code = "rate_limit_exceeded"
+	case errType == AnthropicErrAuthentication:
+		out.Code = "invalid_api_key"
+	case errType == AnthropicErrAPI || errType == AnthropicErrOverloaded:
+		out.Type = "server_error"
+	}
+	return out
+}
+
+func writeOpenAIError(w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(w, status, map[string]interface{}{"error": openAIErrorObject(errType, message)})
+}
+
+// writeOpenAIStatusError writes an OpenAI error envelope whose type follows
+// from status.
+func writeOpenAIStatusError(w http.ResponseWriter, status int, message string) {
+	writeOpenAIError(w, status, anthropicErrorType(status), message)
+}
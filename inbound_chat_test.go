@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTranslateChatCompletionsToAnthropic(t *testing.T) {
+	raw := []byte(`{
+		"model": "gpt-4o",
+		"max_tokens": 512,
+		"messages": [
+			{"role": "system", "content": "@route:anthropic be terse"},
+			{"role": "user", "content": [
+				{"type": "text", "text": "what is this?"},
+				{"type": "image_url", "image_url": {"url": "data:image/jpeg;base64,QUJD"}}
+			]},
+			{"role": "assistant", "content": null, "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "lookup", "arguments": "{\"q\":\"x\"}"}},
+				{"id": "call_2", "type": "function", "function": {"name": "lookup", "arguments": "{\"q\":\"y\"}"}}
+			]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "one"},
+			{"role": "tool", "tool_call_id": "call_2", "content": "two"}
+		],
+		"tools": [{"type": "function", "function": {"name": "lookup", "parameters": {"type": "object"}}}],
+		"tool_choice": "required"
+	}`)
+	var req ChatCompletionsRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	out, err := TranslateChatCompletionsToAnthropic(req)
+	if err != nil {
+		t.Fatalf("translate error: %v", err)
+	}
+	if out.System != "@route:anthropic be terse" || out.MaxTokens != 512 {
+		t.Fatalf("unexpected system/max_tokens: %+v", out)
+	}
+	if len(out.Messages) != 3 {
+		t.Fatalf("expected user/assistant/user, got %+v", out.Messages)
+	}
+	user := out.Messages[0].Content.([]AnthropicContentBlock)
+	if user[1].Type != "image" || user[1].Source.Type != "base64" || user[1].Source.MediaType != "image/jpeg" || user[1].Source.Data != "QUJD" {
+		t.Fatalf("unexpected image block: %+v", user[1])
+	}
+	assistant := out.Messages[1].Content.([]AnthropicContentBlock)
+	if len(assistant) != 2 || assistant[0].Type != "tool_use" || string(assistant[0].Input) != `{"q":"x"}` {
+		t.Fatalf("unexpected assistant blocks: %+v", assistant)
+	}
+	results := out.Messages[2].Content.([]AnthropicContentBlock)
+	if len(results) != 2 || results[1].ToolUseID != "call_2" || results[1].Content != "two" {
+		t.Fatalf("tool results should merge into one user turn: %+v", results)
+	}
+	if choice, _ := out.ToolChoice.(map[string]interface{}); choice["type"] != "any" {
+		t.Fatalf("unexpected tool_choice: %+v", out.ToolChoice)
+	}
+}
+
+func TestHandleChatCompletions_PassthroughStream(t *testing.T) {
+	var seenPath string
+	var seen AnthropicMessageRequest
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&seen)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, strings.Join([]string{
+			`event: message_start`,
+			`data: {"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":9,"output_tokens":0}}}`,
+			``,
+			`event: content_block_start`,
+			`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			``,
+			`event: content_block_delta`,
+			`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}`,
+			``,
+			`event: content_block_start`,
+			`data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"lookup","input":{}}}`,
+			``,
+			`event: content_block_delta`,
+			`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"q\":1}"}}`,
+			``,
+			`event: message_delta`,
+			`data: {"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":4}}`,
+			``,
+			`event: message_stop`,
+			`data: {"type":"message_stop"}`,
+			``,
+			``,
+		}, "\n"))
+	}))
+	defer upstream.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "anthropic",
+		Providers: map[string]ProviderConfig{
+			"anthropic": {Type: ProviderTypePassthrough, URL: upstream.URL},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+
+	body := []byte(`{"model":"claude-sonnet-4-6","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`)
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+	s.handleChatCompletions(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if seenPath != "/v1/messages" || seen.MaxTokens != defaultInboundMaxTokens || seen.Model != "claude-sonnet-4-6" {
+		t.Fatalf("unexpected upstream request: path=%s body=%+v", seenPath, seen)
+	}
+	out := rr.Body.String()
+	for _, want := range []string{
+		`"id":"chatcmpl-1"`,
+		`"delta":{"content":"hi"}`,
+		`"id":"toolu_1"`,
+		`"arguments":"{\"q\":1}"`,
+		`"finish_reason":"tool_calls"`,
+		`"usage":{"prompt_tokens":9,"completion_tokens":4,"total_tokens":13}`,
+		"data: [DONE]",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %s in stream: %s", want, out)
+		}
+	}
+}
+
+func TestHandleChatCompletions_OpenAINonStream(t *testing.T) {
+	var seenModel string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenAIChatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		seenModel = req.Model
+		_ = json.NewEncoder(w).Encode(OpenAIChatResponse{
+			ID:    "chatcmpl_up",
+			Model: req.Model,
+			Choices: []OpenAIChoice{{
+				Message:      OpenAIMessage{Role: "assistant", Content: "routed"},
+				FinishReason: "stop",
+			}},
+			Usage: OpenAIUsage{PromptTokens: 3, CompletionTokens: 2},
+		})
+	}))
+	defer upstream.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "anthropic",
+		Providers: map[string]ProviderConfig{
+			"anthropic": {Type: ProviderTypePassthrough, URL: "http://127.0.0.1:1"},
+			"openai":    {Type: ProviderTypeOpenAI, URL: upstream.URL, Model: "gpt-5-mini"},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+
+	body := []byte(`{"model":"aider","messages":[{"role":"system","content":"@route:openai"},{"role":"user","content":"hi"}]}`)
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+	s.handleChatCompletions(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if seenModel != "gpt-5-mini" {
+		t.Fatalf("unexpected upstream model: %s", seenModel)
+	}
+	var out OpenAIChatResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if out.Object != "chat.completion" || out.Model != "aider" || out.Choices[0].Message.Content != "routed" || out.Choices[0].FinishReason != "stop" {
+		t.Fatalf("unexpected chat completion: %+v", out)
+	}
+	if out.Usage.TotalTokens != 5 {
+		t.Fatalf("unexpected usage: %+v", out.Usage)
+	}
+}
+
+func TestHandleChatCompletions_UpstreamError(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(w, `{"error":{"code":"context_length_exceeded","message":"maximum context length exceeded"}}`)
+	}))
+	defer upstream.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "openai",
+		Providers: map[string]ProviderConfig{
+			"openai": {Type: ProviderTypeOpenAI, URL: upstream.URL, Model: "gpt-5-mini"},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+
+	body := []byte(`{"model":"x","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+	s.handleChatCompletions(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), `"code":"context_length_exceeded"`) {
+		t.Fatalf("expected OpenAI error envelope: %s", rr.Body.String())
+	}
+}
+
+func TestOpenAIUsageFromAnthropic_IncludesCachedTokens(t *testing.T) {
+	got := openAIUsageFromAnthropic(AnthropicUsage{InputTokens: 20, OutputTokens: 5, CacheCreationInputTokens: 10, CacheReadInputTokens: 30})
+	if got.PromptTokens != 60 || got.CompletionTokens != 5 || got.TotalTokens != 65 {
+		t.Fatalf("unexpected usage: %+v", got)
+	}
+	if got.PromptTokensDetails == nil || got.PromptTokensDetails.CachedTokens != 30 {
+		t.Fatalf("expected cached tokens in prompt_tokens_details: %+v", got.PromptTokensDetails)
+	}
+	if got := openAIUsageFromAnthropic(AnthropicUsage{InputTokens: 3}); got.PromptTokensDetails != nil {
+		t.Fatalf("expected no details without cache reads: %+v", got)
+	}
+}
@@ -0,0 +1,777 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// handleResponses serves Responses API clients such as Codex CLI. Routing
+// markers are read from instructions and input like /v1/messages reads them
+// from the system prompt. Requests routed to a chatgpt provider are forwarded
+// natively; any other provider is reached through Anthropic Messages and the
+// result is translated back into response.* events.
+func (s *Server) handleResponses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, AnthropicErrInvalidRequest, "method not allowed")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 16<<20))
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, AnthropicErrInvalidRequest, "invalid request body")
+		return
+	}
+
+	var responsesReq ResponsesRequest
+	if err := json.Unmarshal(body, &responsesReq); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, AnthropicErrInvalidRequest, "invalid JSON")
+		return
+	}
+	anthropicReq, err := TranslateResponsesToAnthropic(responsesReq)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, AnthropicErrInvalidRequest, err.Error())
+		return
+	}
+
+	cfg := s.config()
+	resolved, err := ResolveAll(anthropicReq.System, anthropicReq.Messages, cfg, NewRuleInput(anthropicReq, r))
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, AnthropicErrInvalidRequest, err.Error())
+		return
+	}
+	if err := authorizeRoute(cfg, r, resolved); err != nil {
+		writeOpenAIError(w, http.StatusForbidden, AnthropicErrPermission, err.Error())
+		return
+	}
+	requestID := inboundRequestID(r)
+	s.logResolvedRoute(r, requestID, resolved, responsesReq.Stream)
+
+	model := responsesReq.Model
+	if model == "" {
+		model = resolved.Model
+	}
+
+	if resolved.Provider.Type == ProviderTypeChatGPT {
+		var raw map[string]interface{}
+		if err := json.Unmarshal(body, &raw); err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, AnthropicErrInvalidRequest, "invalid JSON")
+			return
+		}
+		// The native request is built from raw; Body carries the Anthropic
+		// translation so audit records stay replayable.
+		translated, err := json.Marshal(anthropicReq)
+		if err != nil {
+			writeOpenAIError(w, http.StatusInternalServerError, AnthropicErrAPI, err.Error())
+			return
+		}
+		// Each chatgpt route in the chain is forwarded natively; the first
+		// other provider takes the translated path below.
+		for resolved.Provider.Type == ProviderTypeChatGPT {
+			call := &ProviderCall{Server: s, Config: cfg, RequestID: requestID, Route: resolved, Request: anthropicReq, Body: translated, Inbound: r}
+			route, err := s.budgetRoute(call)
+			switch {
+			case err != nil && len(resolved.Fallback) == 0:
+				writeOpenAIStatusError(w, mapTransportError(err), err.Error())
+				return
+			case err != nil:
+				s.logger.Warnf("req=%s route=%s failed (%s), falling back to %s", requestID, resolved.ProviderName, err, resolved.Fallback[0])
+			case route.Provider.Type != ProviderTypeChatGPT:
+				// A budget moved the request to a provider that is reached
+				// through the translated path.
+				resolved = route
+				continue
+			default:
+				call.Route, resolved = route, route
+				observed := newObservedWriter(w, responsesReq.Stream)
+				observed.responses = true
+				trail := &auditTrail{attempts: []string{route.ProviderName}}
+				ctx := r.Context()
+				if s.audit != nil {
+					ctx = withAuditTrail(ctx, trail)
+				}
+				if s.forwardResponsesNative(ctx, observed, call, raw, responsesReq.Stream, trail) {
+					observed.record(s.metrics, call.Route)
+					s.recordUsage(call, observed)
+					s.writeAudit(call, observed, trail)
+					return
+				}
+			}
+			// The attempt failed or was refused before responding; move on
+			// to the next route in the fallback chain.
+			next, err := ResolveFallback(resolved.Fallback[0], resolved, cfg)
+			if err != nil {
+				writeOpenAIStatusError(w, http.StatusBadGateway, err.Error())
+				return
+			}
+			next.Fallback = resolved.Fallback[1:]
+			resolved = next
+		}
+	}
+
+	call, err := s.newTranslatedCall(cfg, requestID, resolved, anthropicReq, r)
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, AnthropicErrAPI, err.Error())
+		return
+	}
+	encoder := newResponsesStreamEncoder(w, model)
+	sink := newAnthropicResponseSink(responsesReq.Stream, encoder.onEvent)
+	s.serveProvider(r.Context(), sink, call)
+
+	if sink.failed() {
+		status, errType, message := sink.anthropicError()
+		if encoder.started {
+			_ = encoder.writeFailed(errType, message)
+			return
+		}
+		writeOpenAIError(w, status, errType, message)
+		return
+	}
+	if responsesReq.Stream {
+		if err := encoder.finish(); err != nil {
+			s.logger.Errorf("req=%s responses stream failed: %v", requestID, err)
+		}
+		return
+	}
+
+	var anthropicResp AnthropicMessageResponse
+	if err := json.Unmarshal(sink.body.Bytes(), &anthropicResp); err != nil {
+		writeOpenAIError(w, http.StatusBadGateway, AnthropicErrAPI, "invalid upstream response: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, convertAnthropicToResponsesObject(anthropicResp, model))
+}
+
+// forwardResponsesNative relays a Responses request to a chatgpt provider
+// without translation. The resolved model, reasoning effort and service tier
+// replace the client's values, as they do on /v1/messages. It reports false,
+// having written nothing, when the upstream failed in a way the route's
+// fallback chain should handle instead.
+func (s *Server) forwardResponsesNative(ctx context.Context, w http.ResponseWriter, call *ProviderCall, raw map[string]interface{}, clientStream bool, trail *auditTrail) bool {
+	raw["model"] = call.Route.Model
+	if call.Config.StripMarkersEnabled() {
+		stripResponsesMarkers(raw, configPresetNames(call.Config))
+	}
+	// Codex requires stream:true and store:false.
+	raw["stream"] = true
+	if _, ok := raw["store"]; !ok {
+		raw["store"] = false
+	}
+	if effort := call.Route.ReasoningEffort; effort != "" {
+		reasoning, _ := raw["reasoning"].(map[string]interface{})
+		if reasoning == nil {
+			reasoning = map[string]interface{}{}
+		}
+		reasoning["effort"] = effort
+		raw["reasoning"] = reasoning
+	}
+	if tier := call.Route.ServiceTier; tier != "" {
+		raw["service_tier"] = tier
+	}
+	payload, err := json.Marshal(raw)
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, AnthropicErrAPI, "failed to encode upstream request")
+		return true
+	}
+
+	release, err := s.acquireProvider(ctx, call)
+	if err != nil {
+		if len(call.Route.Fallback) > 0 && shouldFallback(ctx, nil, err) {
+			s.logger.Warnf("req=%s route=%s failed (%s), falling back to %s", call.RequestID, call.Route.ProviderName, err, call.Route.Fallback[0])
+			return false
+		}
+		writeOpenAIStatusError(w, mapTransportError(err), err.Error())
+		return true
+	}
+	defer release()
+
+	trail.payload = payload
+	sendStart := time.Now()
+	resp, err := chatGPTProvider{}.Send(ctx, call, payload)
+	trail.upstream = time.Since(sendStart)
+	if len(call.Route.Fallback) > 0 && shouldFallback(ctx, resp, err) {
+		s.logger.Warnf("req=%s route=%s failed (%s), falling back to %s", call.RequestID, call.Route.ProviderName, describeUpstreamFailure(resp, err), call.Route.Fallback[0])
+		closeResponseBody(resp)
+		return false
+	}
+	if err != nil {
+		writeOpenAIStatusError(w, mapTransportError(err), err.Error())
+		return true
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		relayResponse(w, resp)
+		return true
+	}
+	if clientStream {
+		if err := relayStream(w, resp); err != nil {
+			s.logger.Errorf("req=%s responses relay failed: %v", call.RequestID, err)
+		}
+		return true
+	}
+
+	responseJSON, err := collectResponsesStreamAsJSON(resp.Body, s.logger)
+	if err != nil {
+		var failure *upstreamError
+		if errors.As(err, &failure) {
+			writeOpenAIError(w, failure.Status, failure.Type, failure.Message)
+			return true
+		}
+		writeOpenAIError(w, http.StatusBadGateway, AnthropicErrAPI, "failed to collect upstream stream: "+err.Error())
+		return true
+	}
+	writeJSON(w, http.StatusOK, json.RawMessage(responseJSON))
+	return true
+}
+
+// TranslateResponsesToAnthropic converts an inbound Responses request to
+// Anthropic Messages. Instructions and system/developer messages become the
+// system prompt.
+func TranslateResponsesToAnthropic(req ResponsesRequest) (AnthropicMessageRequest, error) {
+	items, err := parseResponsesInput(req.Input)
+	if err != nil {
+		return AnthropicMessageRequest{}, err
+	}
+
+	maxTokens := req.MaxOutputTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultInboundMaxTokens
+	}
+	out := AnthropicMessageRequest{
+		Model:     req.Model,
+		MaxTokens: maxTokens,
+		Stream:    req.Stream,
+	}
+
+	systemParts := make([]string, 0, 1)
+	if text := strings.TrimSpace(req.Instructions); text != "" {
+		systemParts = append(systemParts, text)
+	}
+	for _, item := range items {
+		switch item.Type {
+		case "message", "":
+			switch item.Role {
+			case "system", "developer":
+				if text := normalizeContentToText(translateResponsesContentToAnthropic(item.Content)); text != "" {
+					systemParts = append(systemParts, text)
+				}
+			case "user", "assistant":
+				blocks := translateResponsesContentToAnthropic(item.Content)
+				if len(blocks) > 0 {
+					out.Messages = appendAnthropicMessage(out.Messages, item.Role, blocks)
+				}
+			}
+		case "function_call":
+			out.Messages = appendAnthropicMessage(out.Messages, "assistant", []AnthropicContentBlock{{
+				Type:  "tool_use",
+				ID:    item.CallID,
+				Name:  item.Name,
+				Input: toolArgumentsToInput(item.Arguments),
+			}})
+		case "function_call_output":
+			out.Messages = appendAnthropicMessage(out.Messages, "user", []AnthropicContentBlock{{
+				Type:      "tool_result",
+				ToolUseID: item.CallID,
+				Content:   item.Output,
+			}})
+		}
+		// Reasoning items carry encrypted state only the Responses API can
+		// read, so they are dropped along with other item types.
+	}
+	if len(systemParts) > 0 {
+		out.System = strings.Join(systemParts, "\n\n")
+	}
+	if len(out.Messages) == 0 {
+		return AnthropicMessageRequest{}, fmt.Errorf("input must contain at least one user or assistant message")
+	}
+
+	for _, tool := range req.Tools {
+		if tool.Type != "function" {
+			continue
+		}
+		schema := tool.Parameters
+		if len(schema) == 0 || string(schema) == "null" {
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		out.Tools = append(out.Tools, AnthropicTool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: schema,
+		})
+	}
+	if req.ToolChoice != nil {
+		out.ToolChoice = translateToolChoiceToAnthropic(req.ToolChoice)
+	}
+	return out, nil
+}
+
+// parseResponsesInput accepts the string and item-list forms of input.
+func parseResponsesInput(raw json.RawMessage) ([]ResponsesInputItem, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []ResponsesInputItem{{Type: "message", Role: "user", Content: text}}, nil
+	}
+	var items []ResponsesInputItem
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, fmt.Errorf("input must be a string or a list of items")
+	}
+	return items, nil
+}
+
+func translateResponsesContentToAnthropic(content interface{}) []AnthropicContentBlock {
+	parts, ok := content.([]interface{})
+	if !ok {
+		return translateChatContentToAnthropic(content)
+	}
+
+	blocks := make([]AnthropicContentBlock, 0, len(parts))
+	for _, raw := range parts {
+		part, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		partType, _ := part["type"].(string)
+		switch partType {
+		case "input_text", "output_text", "text", "refusal":
+			text, _ := part["text"].(string)
+			if partType == "refusal" {
+				text, _ = part["refusal"].(string)
+			}
+			if text != "" {
+				blocks = append(blocks, AnthropicContentBlock{Type: "text", Text: text})
+			}
+		case "input_image":
+			if url, _ := part["image_url"].(string); url != "" {
+				blocks = append(blocks, AnthropicContentBlock{Type: "image", Source: sourceFromURL(url, "image/png")})
+			}
+		case "input_file":
+			filename, _ := part["filename"].(string)
+			block := AnthropicContentBlock{Type: "document", Title: filename}
+			if data, _ := part["file_data"].(string); data != "" {
+				block.Source = sourceFromURL(data, "application/pdf")
+				if block.Source.Type == "url" {
+					block.Source = &AnthropicSource{Type: "base64", MediaType: "application/pdf", Data: data}
+				}
+			} else if url, _ := part["file_url"].(string); url != "" {
+				block.Source = &AnthropicSource{Type: "url", URL: url}
+			} else {
+				block = AnthropicContentBlock{Type: "text", Text: fmt.Sprintf("[file %s omitted]", filename)}
+			}
+			blocks = append(blocks, block)
+		default:
+			blocks = append(blocks, AnthropicContentBlock{Type: "text", Text: fmt.Sprintf("[%s content omitted]", partType)})
+		}
+	}
+	return blocks
+}
+
+// responsesOutputItem accumulates one Responses output item built from an
+// Anthropic content block.
+type responsesOutputItem struct {
+	itemType    string
+	id          string
+	outputIndex int
+	callID      string
+	name        string
+	// text holds the message text, call arguments or reasoning summary.
+	text strings.Builder
+}
+
+func (it *responsesOutputItem) toJSON(status string) map[string]interface{} {
+	switch it.itemType {
+	case "function_call":
+		arguments := it.text.String()
+		if arguments == "" && status == "completed" {
+			arguments = "{}"
+		}
+		return map[string]interface{}{
+			"type":      "function_call",
+			"id":        it.id,
+			"status":    status,
+			"call_id":   it.callID,
+			"name":      it.name,
+			"arguments": arguments,
+		}
+	case "reasoning":
+		summary := []interface{}{}
+		if it.text.Len() > 0 {
+			summary = append(summary, map[string]interface{}{"type": "summary_text", "text": it.text.String()})
+		}
+		return map[string]interface{}{
+			"type":    "reasoning",
+			"id":      it.id,
+			"summary": summary,
+		}
+	default:
+		content := []interface{}{}
+		if status == "completed" {
+			content = append(content, outputTextPart(it.text.String()))
+		}
+		return map[string]interface{}{
+			"type":    "message",
+			"id":      it.id,
+			"status":  status,
+			"role":    "assistant",
+			"content": content,
+		}
+	}
+}
+
+func outputTextPart(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "output_text", "text": text, "annotations": []interface{}{}}
+}
+
+// responsesStreamEncoder re-encodes an Anthropic SSE stream as Responses API
+// response.* events, and also builds the final response object.
+type responsesStreamEncoder struct {
+	w         http.ResponseWriter
+	model     string
+	id        string
+	createdAt int64
+	started   bool
+	done      bool
+	sequence  int
+	items     []*responsesOutputItem
+	// blockItems maps Anthropic content block indexes to output items.
+	blockItems map[int]*responsesOutputItem
+	stopReason string
+	usage      AnthropicUsage
+}
+
+func newResponsesStreamEncoder(w http.ResponseWriter, model string) *responsesStreamEncoder {
+	return &responsesStreamEncoder{
+		w:          w,
+		model:      model,
+		id:         responsesObjectID(""),
+		createdAt:  time.Now().Unix(),
+		blockItems: map[int]*responsesOutputItem{},
+	}
+}
+
+func responsesObjectID(messageID string) string {
+	if messageID == "" {
+		return fmt.Sprintf("resp_%d", time.Now().UnixNano())
+	}
+	return "resp_" + strings.TrimPrefix(messageID, "msg_")
+}
+
+func (e *responsesStreamEncoder) addItem(block AnthropicContentBlock) *responsesOutputItem {
+	it := &responsesOutputItem{outputIndex: len(e.items)}
+	suffix := fmt.Sprintf("%s_%d", strings.TrimPrefix(e.id, "resp_"), it.outputIndex)
+	switch block.Type {
+	case "text":
+		it.itemType, it.id = "message", "msg_"+suffix
+	case "tool_use":
+		it.itemType, it.id, it.callID, it.name = "function_call", "fc_"+suffix, block.ID, block.Name
+	case "thinking":
+		it.itemType, it.id = "reasoning", "rs_"+suffix
+	default:
+		return nil
+	}
+	e.items = append(e.items, it)
+	return it
+}
+
+func (e *responsesStreamEncoder) onEvent(_ string, data string) error {
+	if e.done {
+		return nil
+	}
+	var event AnthropicStreamEvent
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return nil
+	}
+
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			if event.Message.ID != "" {
+				e.id = responsesObjectID(event.Message.ID)
+			}
+			e.usage = event.Message.Usage
+		}
+		return e.writeEvent("response.created", map[string]interface{}{"response": e.responseObject("in_progress")})
+	case "content_block_start":
+		if event.ContentBlock == nil {
+			return nil
+		}
+		it := e.addItem(*event.ContentBlock)
+		if it == nil {
+			return nil
+		}
+		e.blockItems[event.Index] = it
+		if err := e.writeEvent("response.output_item.added", map[string]interface{}{
+			"output_index": it.outputIndex,
+			"item":         it.toJSON("in_progress"),
+		}); err != nil {
+			return err
+		}
+		switch it.itemType {
+		case "message":
+			return e.writeEvent("response.content_part.added", map[string]interface{}{
+				"item_id":       it.id,
+				"output_index":  it.outputIndex,
+				"content_index": 0,
+				"part":          outputTextPart(""),
+			})
+		case "reasoning":
+			return e.writeEvent("response.reasoning_summary_part.added", map[string]interface{}{
+				"item_id":       it.id,
+				"output_index":  it.outputIndex,
+				"summary_index": 0,
+				"part":          map[string]interface{}{"type": "summary_text", "text": ""},
+			})
+		}
+		return nil
+	case "content_block_delta":
+		it, ok := e.blockItems[event.Index]
+		if !ok {
+			return nil
+		}
+		switch event.Delta.Type {
+		case "text_delta":
+			it.text.WriteString(event.Delta.Text)
+			return e.writeEvent("response.output_text.delta", map[string]interface{}{
+				"item_id":       it.id,
+				"output_index":  it.outputIndex,
+				"content_index": 0,
+				"delta":         event.Delta.Text,
+			})
+		case "input_json_delta":
+			it.text.WriteString(event.Delta.PartialJSON)
+			return e.writeEvent("response.function_call_arguments.delta", map[string]interface{}{
+				"item_id":      it.id,
+				"output_index": it.outputIndex,
+				"delta":        event.Delta.PartialJSON,
+			})
+		case "thinking_delta":
+			it.text.WriteString(event.Delta.Thinking)
+			return e.writeEvent("response.reasoning_summary_text.delta", map[string]interface{}{
+				"item_id":       it.id,
+				"output_index":  it.outputIndex,
+				"summary_index": 0,
+				"delta":         event.Delta.Thinking,
+			})
+		}
+		return nil
+	case "content_block_stop":
+		it, ok := e.blockItems[event.Index]
+		if !ok {
+			return nil
+		}
+		delete(e.blockItems, event.Index)
+		return e.closeItem(it)
+	case "message_delta":
+		if event.Usage != nil {
+			e.usage.addDelta(*event.Usage)
+		}
+		if event.Delta.StopReason != "" {
+			e.stopReason = event.Delta.StopReason
+		}
+		return nil
+	case "message_stop":
+		return e.finish()
+	case "ping":
+		return e.writePing()
+	case "error":
+		errType, message := AnthropicErrAPI, "upstream stream failed"
+		if event.Error != nil {
+			errType, message = event.Error.Type, event.Error.Message
+		}
+		return e.writeFailed(errType, message)
+	default:
+		return nil
+	}
+}
+
+func (e *responsesStreamEncoder) closeItem(it *responsesOutputItem) error {
+	text := it.text.String()
+	switch it.itemType {
+	case "message":
+		if err := e.writeEvent("response.output_text.done", map[string]interface{}{
+			"item_id":       it.id,
+			"output_index":  it.outputIndex,
+			"content_index": 0,
+			"text":          text,
+		}); err != nil {
+			return err
+		}
+		if err := e.writeEvent("response.content_part.done", map[string]interface{}{
+			"item_id":       it.id,
+			"output_index":  it.outputIndex,
+			"content_index": 0,
+			"part":          outputTextPart(text),
+		}); err != nil {
+			return err
+		}
+	case "function_call":
+		if err := e.writeEvent("response.function_call_arguments.done", map[string]interface{}{
+			"item_id":      it.id,
+			"output_index": it.outputIndex,
+			"arguments":    it.toJSON("completed")["arguments"],
+		}); err != nil {
+			return err
+		}
+	case "reasoning":
+		if err := e.writeEvent("response.reasoning_summary_text.done", map[string]interface{}{
+			"item_id":       it.id,
+			"output_index":  it.outputIndex,
+			"summary_index": 0,
+			"text":          text,
+		}); err != nil {
+			return err
+		}
+	}
+	return e.writeEvent("response.output_item.done", map[string]interface{}{
+		"output_index": it.outputIndex,
+		"item":         it.toJSON("completed"),
+	})
+}
+
+func (e *responsesStreamEncoder) status() string {
+	if e.stopReason == "max_tokens" {
+		return "incomplete"
+	}
+	return "completed"
+}
+
+func (e *responsesStreamEncoder) responseObject(status string) map[string]interface{} {
+	output := make([]interface{}, 0, len(e.items))
+	if status != "in_progress" {
+		for _, it := range e.items {
+			output = append(output, it.toJSON("completed"))
+		}
+	}
+	obj := map[string]interface{}{
+		"id":         e.id,
+		"object":     "response",
+		"created_at": e.createdAt,
+		"status":     status,
+		"model":      e.model,
+		"output":     output,
+	}
+	if status != "in_progress" {
+		// Responses counts cached tokens inside input_tokens.
+		obj["usage"] = map[string]interface{}{
+			"input_tokens":         e.usage.promptTokens(),
+			"input_tokens_details": map[string]int{"cached_tokens": e.usage.CacheReadInputTokens},
+			"output_tokens":        e.usage.OutputTokens,
+			"total_tokens":         e.usage.promptTokens() + e.usage.OutputTokens,
+		}
+	}
+	if status == "incomplete" {
+		obj["incomplete_details"] = map[string]interface{}{"reason": "max_output_tokens"}
+	}
+	return obj
+}
+
+func (e *responsesStreamEncoder) start() {
+	if e.started {
+		return
+	}
+	e.started = true
+	e.w.Header().Set("Content-Type", "text/event-stream")
+	e.w.Header().Set("Cache-Control", "no-cache")
+	e.w.Header().Set("Connection", "keep-alive")
+	e.w.WriteHeader(http.StatusOK)
+}
+
+func (e *responsesStreamEncoder) writeEvent(eventType string, payload map[string]interface{}) error {
+	e.start()
+	payload["type"] = eventType
+	payload["sequence_number"] = e.sequence
+	e.sequence++
+	if err := writeAnthropicSSEEvent(e.w, eventType, payload); err != nil {
+		return err
+	}
+	if flusher, ok := e.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// writePing forwards a keepalive ping as an SSE comment. The Responses API
+// has no ping event, and clients skip comments.
+func (e *responsesStreamEncoder) writePing() error {
+	e.start()
+	if _, err := io.WriteString(e.w, ": ping\n\n"); err != nil {
+		return err
+	}
+	if flusher, ok := e.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// writeFailed ends the stream with response.failed.
+func (e *responsesStreamEncoder) writeFailed(errType, message string) error {
+	e.done = true
+	obj := e.responseObject("failed")
+	errObj := openAIErrorObject(errType, message)
+	code := errObj.Code
+	if code == nil {
+		code = errObj.Type
+	}
+	obj["error"] = map[string]interface{}{"code": code, "message": message}
+	return e.writeEvent("response.failed", map[string]interface{}{"response": obj})
+}
+
+// finish closes any items left open and writes response.completed.
+func (e *responsesStreamEncoder) finish() error {
+	if e.done {
+		return nil
+	}
+	e.done = true
+	open := map[*responsesOutputItem]bool{}
+	for _, it := range e.blockItems {
+		open[it] = true
+	}
+	e.blockItems = map[int]*responsesOutputItem{}
+	for _, it := range e.items {
+		if open[it] {
+			if err := e.closeItem(it); err != nil {
+				return err
+			}
+		}
+	}
+	status := e.status()
+	eventType := "response.completed"
+	if status == "incomplete" {
+		eventType = "response.incomplete"
+	}
+	return e.writeEvent(eventType, map[string]interface{}{"response": e.responseObject(status)})
+}
+
+// convertAnthropicToResponsesObject builds a non-streaming Responses API
+// response object from an Anthropic message.
+func convertAnthropicToResponsesObject(resp AnthropicMessageResponse, model string) map[string]interface{} {
+	e := newResponsesStreamEncoder(nil, model)
+	if resp.ID != "" {
+		e.id = responsesObjectID(resp.ID)
+	}
+	for _, block := range resp.Content {
+		it := e.addItem(block)
+		if it == nil {
+			continue
+		}
+		switch block.Type {
+		case "text":
+			it.text.WriteString(block.Text)
+		case "tool_use":
+			it.text.Write(block.Input)
+		case "thinking":
+			it.text.WriteString(block.Thinking)
+		}
+	}
+	e.stopReason = resp.StopReason
+	e.usage = resp.Usage
+	return e.responseObject(e.status())
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTranslateResponsesToAnthropic(t *testing.T) {
+	raw := []byte(`{
+		"model": "gpt-5-codex",
+		"instructions": "You are Codex.",
+		"input": [
+			{"type": "message", "role": "developer", "content": [{"type": "input_text", "text": "@route:anthropic"}]},
+			{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "list files"}]},
+			{"type": "reasoning", "summary": [], "encrypted_content": "gAAA"},
+			{"type": "function_call", "call_id": "call_1", "name": "shell", "arguments": "{\"command\":[\"ls\"]}"},
+			{"type": "function_call_output", "call_id": "call_1", "output": "a.go"}
+		],
+		"tools": [
+			{"type": "function", "name": "shell", "parameters": {"type": "object"}},
+			{"type": "web_search"}
+		],
+		"tool_choice": {"type": "function", "name": "shell"}
+	}`)
+	var req ResponsesRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	out, err := TranslateResponsesToAnthropic(req)
+	if err != nil {
+		t.Fatalf("translate error: %v", err)
+	}
+	if out.System != "You are Codex.\n\n@route:anthropic" {
+		t.Fatalf("unexpected system: %q", out.System)
+	}
+	if len(out.Messages) != 3 || out.Messages[1].Role != "assistant" || out.Messages[2].Role != "user" {
+		t.Fatalf("unexpected messages: %+v", out.Messages)
+	}
+	toolUse := out.Messages[1].Content.([]AnthropicContentBlock)[0]
+	if toolUse.Type != "tool_use" || toolUse.ID != "call_1" || string(toolUse.Input) != `{"command":["ls"]}` {
+		t.Fatalf("unexpected tool_use: %+v", toolUse)
+	}
+	if result := out.Messages[2].Content.([]AnthropicContentBlock)[0]; result.ToolUseID != "call_1" || result.Content != "a.go" {
+		t.Fatalf("unexpected tool_result: %+v", result)
+	}
+	if len(out.Tools) != 1 || out.Tools[0].Name != "shell" {
+		t.Fatalf("only function tools should translate: %+v", out.Tools)
+	}
+	if choice, _ := out.ToolChoice.(map[string]interface{}); choice["type"] != "tool" || choice["name"] != "shell" {
+		t.Fatalf("unexpected tool_choice: %+v", out.ToolChoice)
+	}
+}
+
+func TestHandleResponses_NativeChatGPT(t *testing.T) {
+	var seen map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&seen)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "event: response.output_text.delta\n")
+		_, _ = io.WriteString(w, `data: {"type":"response.output_text.delta","delta":"native"}`+"\n\n")
+	}))
+	defer upstream.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "codex",
+		Providers: map[string]ProviderConfig{
+			"codex": {Type: ProviderTypeChatGPT, URL: upstream.URL, Model: "gpt-5-codex", ReasoningEffort: "medium"},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+
+	body := []byte(`{"model":"gpt-5","instructions":"@reasoning:high","input":"hi","stream":true,"prompt_cache_key":"abc","reasoning":{"summary":"auto"}}`)
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewReader(body))
+	s.handleResponses(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if seen["model"] != "gpt-5-codex" || seen["prompt_cache_key"] != "abc" || seen["store"] != false {
+		t.Fatalf("unexpected forwarded body: %+v", seen)
+	}
+	if reasoning, _ := seen["reasoning"].(map[string]interface{}); reasoning["effort"] != "high" || reasoning["summary"] != "auto" {
+		t.Fatalf("unexpected reasoning: %+v", seen["reasoning"])
+	}
+	if input, _ := seen["input"].(string); input != "hi" {
+		t.Fatalf("input should be forwarded untouched: %+v", seen["input"])
+	}
+	if !strings.Contains(rr.Body.String(), `"delta":"native"`) {
+		t.Fatalf("upstream stream should be relayed: %s", rr.Body.String())
+	}
+}
+
+func TestHandleResponses_TranslatedOpenAIStream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"content\":\"hello\"}}]}\n\n")
+		_, _ = io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_9\",\"type\":\"function\",\"function\":{\"name\":\"shell\",\"arguments\":\"{}\"}}]}}]}\n\n")
+		_, _ = io.WriteString(w, "data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"tool_calls\"}],\"usage\":{\"prompt_tokens\":4,\"completion_tokens\":6}}\n\n")
+		_, _ = io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "openai",
+		Providers: map[string]ProviderConfig{
+			"openai": {Type: ProviderTypeOpenAI, URL: upstream.URL, Model: "gpt-5-mini"},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+
+	body := []byte(`{"model":"gpt-5-codex","input":[{"type":"message","role":"user","content":"hi"}],"stream":true}`)
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewReader(body))
+	s.handleResponses(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	out := rr.Body.String()
+	for _, want := range []string{
+		"event: response.created",
+		"event: response.output_text.delta",
+		`"delta":"hello"`,
+		`"call_id":"call_9"`,
+		"event: response.function_call_arguments.done",
+		"event: response.completed",
+		`"output_tokens":6`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %s in stream: %s", want, out)
+		}
+	}
+	if strings.Index(out, "response.created") > strings.Index(out, "response.output_item.added") {
+		t.Fatalf("response.created must come first: %s", out)
+	}
+}
+
+func TestHandleResponses_NativeFallbackToTranslated(t *testing.T) {
+	codex := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = io.WriteString(w, `{"error":{"type":"usage_limit_reached","message":"The usage limit has been reached"}}`)
+	}))
+	defer codex.Close()
+	openai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(OpenAIChatResponse{
+			Choices: []OpenAIChoice{{Message: OpenAIMessage{Role: "assistant", Content: "from fallback"}, FinishReason: "stop"}},
+			Usage:   OpenAIUsage{PromptTokens: 1, CompletionTokens: 2},
+		})
+	}))
+	defer openai.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "codex",
+		Providers: map[string]ProviderConfig{
+			"codex":  {Type: ProviderTypeChatGPT, URL: codex.URL, Model: "gpt-5-codex", Fallback: []string{"openai"}},
+			"openai": {Type: ProviderTypeOpenAI, URL: openai.URL, Model: "gpt-5-mini"},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+
+	body := []byte(`{"model":"gpt-5-codex","input":"hi"}`)
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewReader(body))
+	s.handleResponses(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	var out struct {
+		Object string `json:"object"`
+		Status string `json:"status"`
+		Output []struct {
+			Type    string `json:"type"`
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"output"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if out.Object != "response" || out.Status != "completed" || len(out.Output) != 1 || out.Output[0].Content[0].Text != "from fallback" {
+		t.Fatalf("unexpected response object: %s", rr.Body.String())
+	}
+}
+
+func TestHandleResponses_NativeFallbackToChatGPT(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	var forwarded map[string]interface{}
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&forwarded)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",\"object\":\"response\",\"status\":\"completed\",\"output\":[]}}\n\n")
+	}))
+	defer backup.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "codex",
+		Providers: map[string]ProviderConfig{
+			"codex":  {Type: ProviderTypeChatGPT, URL: primary.URL, Model: "gpt-5-codex", Fallback: []string{"backup"}, Retry: RetryConfig{MaxAttempts: 1}},
+			"backup": {Type: ProviderTypeChatGPT, URL: backup.URL, Model: "gpt-5"},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+
+	body := []byte(`{"model":"gpt-5-codex","input":"hi","stream":true,"prompt_cache_key":"abc"}`)
+	rr := httptest.NewRecorder()
+	s.handleResponses(rr, httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewReader(body)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	// Only the native path keeps the client's own fields.
+	if forwarded["prompt_cache_key"] != "abc" || forwarded["model"] != "gpt-5" {
+		t.Fatalf("expected the chatgpt fallback to be forwarded natively, got %v", forwarded)
+	}
+}
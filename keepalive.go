@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultPingInterval = 15 * time.Second
+
+// PingInterval is how long a translated stream may stay silent before a ping
+// event is sent. ping_interval_seconds defaults to 15; a negative value
+// disables pings.
+func (c *Config) PingInterval() time.Duration {
+	switch {
+	case c.PingIntervalSeconds < 0:
+		return 0
+	case c.PingIntervalSeconds == 0:
+		return defaultPingInterval
+	}
+	return time.Duration(c.PingIntervalSeconds) * time.Second
+}
+
+// keepaliveWriter serializes writes to a translated SSE stream and writes an
+// Anthropic ping event whenever nothing else has been written for the
+// interval, so proxies do not drop the connection while the upstream is
+// still reasoning. Each Write must carry whole events.
+type keepaliveWriter struct {
+	http.ResponseWriter
+	interval time.Duration
+
+	mu      sync.Mutex
+	started bool
+	last    time.Time
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// startKeepalive wraps w with a pinging writer. The returned stop function
+// must be called before the handler returns.
+func startKeepalive(w http.ResponseWriter, interval time.Duration) (http.ResponseWriter, func()) {
+	if interval <= 0 {
+		return w, func() {}
+	}
+	k := &keepaliveWriter{
+		ResponseWriter: w,
+		interval:       interval,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	go k.run()
+	return k, func() {
+		close(k.stop)
+		<-k.done
+	}
+}
+
+func (k *keepaliveWriter) run() {
+	defer close(k.done)
+	ticker := time.NewTicker(k.interval / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-k.stop:
+			return
+		case <-ticker.C:
+		}
+		k.mu.Lock()
+		if k.started && time.Since(k.last) >= k.interval {
+			if err := writeAnthropicSSEEvent(k.ResponseWriter, "ping", map[string]string{"type": "ping"}); err == nil {
+				k.flushLocked()
+			}
+			k.last = time.Now()
+		}
+		k.mu.Unlock()
+	}
+}
+
+func (k *keepaliveWriter) WriteHeader(status int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.ResponseWriter.WriteHeader(status)
+}
+
+func (k *keepaliveWriter) Write(p []byte) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.started = true
+	k.last = time.Now()
+	return k.ResponseWriter.Write(p)
+}
+
+func (k *keepaliveWriter) Flush() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.flushLocked()
+}
+
+func (k *keepaliveWriter) flushLocked() {
+	if flusher, ok := k.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartKeepalive_PingsWhileIdle(t *testing.T) {
+	rr := httptest.NewRecorder()
+	w, stop := startKeepalive(rr, 40*time.Millisecond)
+	if err := writeAnthropicSSEEvent(w, "message_start", map[string]string{"type": "message_start"}); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	stop()
+
+	body := rr.Body.String()
+	if !strings.HasPrefix(body, "event: message_start\n") {
+		t.Fatalf("expected the stream to start with message_start, got %q", body)
+	}
+	if !strings.Contains(body, "event: ping\ndata: {\"type\":\"ping\"}\n\n") {
+		t.Fatalf("expected ping events while idle, got %q", body)
+	}
+}
+
+func TestStartKeepalive_WaitsForFirstWrite(t *testing.T) {
+	rr := httptest.NewRecorder()
+	_, stop := startKeepalive(rr, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	stop()
+	if rr.Body.Len() != 0 {
+		t.Fatalf("expected no pings before the stream starts, got %q", rr.Body.String())
+	}
+}
+
+// inspectingReader runs check before returning its first byte.
+type inspectingReader struct {
+	check func()
+	r     io.Reader
+}
+
+func (i *inspectingReader) Read(p []byte) (int, error) {
+	if i.check != nil {
+		i.check()
+		i.check = nil
+	}
+	return i.r.Read(p)
+}
+
+func TestConvertResponsesStream_MessageStartBeforeUpstreamData(t *testing.T) {
+	rr := httptest.NewRecorder()
+	sawStart := false
+	src := &inspectingReader{
+		check: func() { sawStart = strings.Contains(rr.Body.String(), "event: message_start") },
+		r: strings.NewReader(strings.Join([]string{
+			`data: {"type":"response.output_text.delta","item_id":"m1","content_index":0,"delta":"hi"}`,
+			`data: {"type":"response.completed","response":{"usage":{"output_tokens":1}}}`,
+			"",
+		}, "\n\n")),
+	}
+	if err := convertResponsesStreamToAnthropic(rr, src, "claude-spoof", NewLogger()); err != nil {
+		t.Fatalf("convertResponsesStreamToAnthropic error: %v", err)
+	}
+	if !sawStart {
+		t.Fatal("expected message_start before reading the upstream stream")
+	}
+	if strings.Count(rr.Body.String(), "event: message_start") != 1 {
+		t.Fatalf("expected exactly one message_start, got %s", rr.Body.String())
+	}
+}
+
+func TestConfig_PingInterval(t *testing.T) {
+	cases := map[int]time.Duration{0: 15 * time.Second, 5: 5 * time.Second, -1: 0}
+	for seconds, want := range cases {
+		cfg := &Config{PingIntervalSeconds: seconds}
+		if got := cfg.PingInterval(); got != want {
+			t.Fatalf("ping_interval_seconds=%d: expected %s, got %s", seconds, want, got)
+		}
+	}
+}
+
+func TestInboundStreamEncoders_ForwardPings(t *testing.T) {
+	ping := `{"type":"ping"}`
+	rr := httptest.NewRecorder()
+	if err := newChatCompletionsStreamEncoder(rr, "gpt-5").onEvent("ping", ping); err != nil || rr.Body.String() != ": ping\n\n" {
+		t.Fatalf("chat completions: expected a ping comment, got %q %v", rr.Body.String(), err)
+	}
+	rr = httptest.NewRecorder()
+	if err := newResponsesStreamEncoder(rr, "gpt-5").onEvent("ping", ping); err != nil || rr.Body.String() != ": ping\n\n" {
+		t.Fatalf("responses: expected a ping comment, got %q %v", rr.Body.String(), err)
+	}
+}
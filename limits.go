@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultQueueSize    = 64
+	defaultQueueTimeout = 60 * time.Second
+)
+
+func (l LimitConfig) enabled() bool {
+	return l.MaxConcurrent > 0 || l.RequestsPerMinute > 0 || l.TokensPerMinute > 0
+}
+
+func (l LimitConfig) queueSize() int {
+	if l.QueueSize > 0 {
+		return l.QueueSize
+	}
+	return defaultQueueSize
+}
+
+func (l LimitConfig) queueTimeout() time.Duration {
+	if l.QueueTimeoutSeconds > 0 {
+		return time.Duration(l.QueueTimeoutSeconds) * time.Second
+	}
+	return defaultQueueTimeout
+}
+
+// normalizeLimits validates the limits of the provider at field.
+func normalizeLimits(field string, l LimitConfig) error {
+	if l.MaxConcurrent < 0 || l.QueueSize < 0 || l.QueueTimeoutSeconds < 0 || l.RequestsPerMinute < 0 || l.TokensPerMinute < 0 {
+		return fmt.Errorf("%s.limits must be >= 0", field)
+	}
+	return nil
+}
+
+// queueRejectedError is returned when a request cannot get a provider slot or
+// rate budget in time. It maps to 429 so clients back off.
+type queueRejectedError struct {
+	provider string
+	reason   string
+}
+
+func (e *queueRejectedError) Error() string {
+	return fmt.Sprintf("provider %s is busy: %s", e.provider, e.reason)
+}
+
+// rateBucket is a per-minute token bucket that hands out reservations: a
+// request may take more than is available and waits until the bucket has
+// refilled, so waiters are served in the order they reserved.
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *rateBucket) reserve(n float64, perMinute int, now time.Time) time.Duration {
+	if perMinute <= 0 {
+		return 0
+	}
+	capacity := float64(perMinute)
+	if b.last.IsZero() {
+		b.tokens = capacity
+	} else {
+		b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Minutes()*capacity)
+	}
+	b.last = now
+	if n > capacity {
+		n = capacity
+	}
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / capacity * float64(time.Minute))
+}
+
+func (b *rateBucket) refund(n float64, perMinute int) {
+	if perMinute <= 0 {
+		return
+	}
+	if n > float64(perMinute) {
+		n = float64(perMinute)
+	}
+	b.tokens += n
+}
+
+// providerLimiter caps one provider's in-flight requests and request/token
+// rate. Requests beyond max_concurrent wait in a FIFO queue.
+type providerLimiter struct {
+	mu      sync.Mutex
+	active  int
+	waiters []chan struct{}
+	// waiting counts requests queued for a slot and throttled those
+	// sleeping until the request or token budget allows them.
+	waiting   int
+	throttled int
+	requests  rateBucket
+	tokens    rateBucket
+}
+
+// releaseLocked hands the slot to the oldest waiter, or frees it.
+func (l *providerLimiter) releaseLocked() {
+	if len(l.waiters) > 0 {
+		next := l.waiters[0]
+		l.waiters = l.waiters[1:]
+		close(next)
+		return
+	}
+	l.active--
+}
+
+func (l *providerLimiter) removeWaiterLocked(ready chan struct{}) bool {
+	for i, w := range l.waiters {
+		if w == ready {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// providerLimits holds a limiter per provider name, so queues and budgets
+// survive config reloads.
+type providerLimits struct {
+	mu       sync.Mutex
+	limiters map[string]*providerLimiter
+	metrics  *Metrics
+}
+
+func newProviderLimits(metrics *Metrics) *providerLimits {
+	return &providerLimits{limiters: map[string]*providerLimiter{}, metrics: metrics}
+}
+
+func (p *providerLimits) get(name string) *providerLimiter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	l, ok := p.limiters[name]
+	if !ok {
+		l = &providerLimiter{}
+		p.limiters[name] = l
+	}
+	return l
+}
+
+// providerSlot is a granted place on a provider. release must be called once
+// the response has been written.
+type providerSlot struct {
+	release func()
+	// waited is the time spent queued and depth the queue length on joining.
+	waited time.Duration
+	depth  int
+}
+
+// acquire waits for a slot and rate budget on the named provider. tokens is
+// the request's estimated input size.
+func (p *providerLimits) acquire(ctx context.Context, name string, limits LimitConfig, tokens int) (providerSlot, error) {
+	if p == nil || !limits.enabled() {
+		return providerSlot{release: func() {}}, nil
+	}
+	l := p.get(name)
+	start := time.Now()
+	deadline := start.Add(limits.queueTimeout())
+	timer := time.NewTimer(limits.queueTimeout())
+	defer timer.Stop()
+
+	setDepth := func() {
+		p.metrics.setQueueDepth(name, l.waiting)
+		p.metrics.setThrottled(name, l.throttled)
+	}
+	depth := 0
+	reject := func(reason string) (providerSlot, error) {
+		p.metrics.addQueueRejected(name, reason)
+		return providerSlot{}, &queueRejectedError{provider: name, reason: reason}
+	}
+
+	// 1. A concurrency slot, first come first served.
+	if limits.MaxConcurrent > 0 {
+		l.mu.Lock()
+		if l.active < limits.MaxConcurrent && len(l.waiters) == 0 {
+			l.active++
+			l.mu.Unlock()
+		} else {
+			if l.waiting >= limits.queueSize() {
+				l.mu.Unlock()
+				return reject("queue full")
+			}
+			ready := make(chan struct{})
+			l.waiters = append(l.waiters, ready)
+			l.waiting++
+			depth = l.waiting
+			setDepth()
+			l.mu.Unlock()
+
+			var err error
+			select {
+			case <-ready:
+			case <-ctx.Done():
+				err = ctx.Err()
+			case <-timer.C:
+				err = errQueueTimeout
+			}
+			l.mu.Lock()
+			l.waiting--
+			setDepth()
+			if err != nil && !l.removeWaiterLocked(ready) {
+				// The slot was handed over as we gave up; pass it on.
+				l.releaseLocked()
+			}
+			l.mu.Unlock()
+			if err == errQueueTimeout {
+				return reject(fmt.Sprintf("no slot within %s", limits.queueTimeout()))
+			}
+			if err != nil {
+				return providerSlot{}, err
+			}
+		}
+	}
+	var once sync.Once
+	releaseSlot := func() {
+		once.Do(func() {
+			if limits.MaxConcurrent > 0 {
+				l.mu.Lock()
+				l.releaseLocked()
+				l.mu.Unlock()
+			}
+		})
+	}
+
+	// 2. Request and token budget.
+	if limits.RequestsPerMinute > 0 || limits.TokensPerMinute > 0 {
+		l.mu.Lock()
+		now := time.Now()
+		wait := l.requests.reserve(1, limits.RequestsPerMinute, now)
+		if tokenWait := l.tokens.reserve(float64(tokens), limits.TokensPerMinute, now); tokenWait > wait {
+			wait = tokenWait
+		}
+		refund := func() {
+			l.requests.refund(1, limits.RequestsPerMinute)
+			l.tokens.refund(float64(tokens), limits.TokensPerMinute)
+		}
+		if wait > 0 && now.Add(wait).After(deadline) {
+			refund()
+			l.mu.Unlock()
+			releaseSlot()
+			return reject("rate limit")
+		}
+		if wait > 0 {
+			l.throttled++
+			if l.throttled > depth {
+				depth = l.throttled
+			}
+			setDepth()
+		}
+		l.mu.Unlock()
+
+		if wait > 0 {
+			var err error
+			rateTimer := time.NewTimer(wait)
+			select {
+			case <-rateTimer.C:
+			case <-ctx.Done():
+				rateTimer.Stop()
+				err = ctx.Err()
+			}
+			l.mu.Lock()
+			l.throttled--
+			setDepth()
+			if err != nil {
+				refund()
+			}
+			l.mu.Unlock()
+			if err != nil {
+				releaseSlot()
+				return providerSlot{}, err
+			}
+		}
+	}
+
+	waited := time.Since(start)
+	p.metrics.observeQueueWait(name, waited)
+	return providerSlot{release: releaseSlot, waited: waited, depth: depth}, nil
+}
+
+var errQueueTimeout = errors.New("queue timeout")
+
+// acquireProvider takes a slot on the call's provider, logging any wait.
+func (s *Server) acquireProvider(ctx context.Context, call *ProviderCall) (func(), error) {
+	limits := call.Route.Provider.Limits
+	if !limits.enabled() {
+		return func() {}, nil
+	}
+	tokens := estimateInputTokens(call.Request.System, call.Request.Messages)
+	slot, err := s.limits.acquire(ctx, call.Route.ProviderName, limits, tokens)
+	if err != nil {
+		return nil, err
+	}
+	if slot.depth > 0 {
+		s.logger.Infof("req=%s route=%s queued at depth %d, waited %s", call.RequestID, call.Route.ProviderName, slot.depth, slot.waited.Round(time.Millisecond))
+	}
+	return slot.release, nil
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProviderLimits_FIFOQueue(t *testing.T) {
+	p := newProviderLimits(NewMetrics())
+	limits := LimitConfig{MaxConcurrent: 1, QueueSize: 2}
+	ctx := context.Background()
+
+	first, err := p.acquire(ctx, "openrouter", limits, 1)
+	if err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+
+	order := make(chan int, 2)
+	slots := make(chan providerSlot, 2)
+	for i := 1; i <= 2; i++ {
+		i := i
+		go func() {
+			slot, err := p.acquire(ctx, "openrouter", limits, 1)
+			if err != nil {
+				t.Errorf("waiter %d: %v", i, err)
+				return
+			}
+			order <- i
+			slots <- slot
+		}()
+		waitForQueue(t, p, "openrouter", i)
+	}
+
+	// The queue is full, so a fourth request is turned away at once.
+	var rejected *queueRejectedError
+	if _, err := p.acquire(ctx, "openrouter", limits, 1); !errors.As(err, &rejected) || rejected.reason != "queue full" {
+		t.Fatalf("expected queue full, got %v", err)
+	}
+
+	first.release()
+	first.release() // releasing twice must not free a second slot
+	if got := <-order; got != 1 {
+		t.Fatalf("expected waiter 1 first, got %d", got)
+	}
+	select {
+	case got := <-order:
+		t.Fatalf("waiter %d ran while the slot was taken", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+	(<-slots).release()
+	if got := <-order; got != 2 {
+		t.Fatalf("expected waiter 2 second, got %d", got)
+	}
+	slot := <-slots
+	if slot.depth != 2 {
+		t.Fatalf("expected waiter 2 to report depth 2, got %d", slot.depth)
+	}
+	slot.release()
+}
+
+func TestProviderLimits_QueueTimeoutAndCancel(t *testing.T) {
+	m := NewMetrics()
+	p := newProviderLimits(m)
+	limits := LimitConfig{MaxConcurrent: 1, QueueTimeoutSeconds: 1}
+	held, err := p.acquire(context.Background(), "ollama", limits, 1)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		waitForQueue(t, p, "ollama", 1)
+		cancel()
+	}()
+	if _, err := p.acquire(ctx, "ollama", limits, 1); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	var rejected *queueRejectedError
+	_, err = p.acquire(context.Background(), "ollama", limits, 1)
+	if !errors.As(err, &rejected) || !strings.HasPrefix(rejected.reason, "no slot within") {
+		t.Fatalf("expected queue timeout, got %v", err)
+	}
+	if got := mapTransportError(err); got != 429 {
+		t.Fatalf("expected 429, got %d", got)
+	}
+
+	// Given-up waiters leave no trace: the slot is still free after release.
+	held.release()
+	slot, err := p.acquire(context.Background(), "ollama", limits, 1)
+	if err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+	slot.release()
+
+	out := metricsOutput(m)
+	for _, want := range []string{
+		`furiwake_queue_depth{route="ollama"} 0`,
+		`furiwake_queue_rejected_total{route="ollama",reason="no slot within 1s"} 1`,
+		`furiwake_queue_wait_seconds_count{route="ollama"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in metrics:\n%s", want, out)
+		}
+	}
+}
+
+func TestRateBucket_Reserve(t *testing.T) {
+	var b rateBucket
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if wait := b.reserve(60, 60, now); wait != 0 {
+		t.Fatalf("expected a full bucket to start, got wait %v", wait)
+	}
+	if wait := b.reserve(1, 60, now); wait != time.Second {
+		t.Fatalf("expected a one second wait, got %v", wait)
+	}
+	// Later reservations queue behind earlier ones.
+	if wait := b.reserve(1, 60, now); wait != 2*time.Second {
+		t.Fatalf("expected a two second wait, got %v", wait)
+	}
+	b.refund(2, 60)
+	if wait := b.reserve(30, 60, now.Add(30*time.Second)); wait != 0 {
+		t.Fatalf("expected the bucket to refill, got wait %v", wait)
+	}
+	if wait := b.reserve(1000, 0, now); wait != 0 {
+		t.Fatalf("expected no limit, got wait %v", wait)
+	}
+}
+
+func TestProviderLimits_RateLimit(t *testing.T) {
+	p := newProviderLimits(NewMetrics())
+	limits := LimitConfig{RequestsPerMinute: 1, QueueTimeoutSeconds: 1}
+	slot, err := p.acquire(context.Background(), "openrouter", limits, 10)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	slot.release()
+
+	// The next request would wait a minute, past the queue timeout.
+	var rejected *queueRejectedError
+	if _, err := p.acquire(context.Background(), "openrouter", limits, 10); !errors.As(err, &rejected) || rejected.reason != "rate limit" {
+		t.Fatalf("expected rate limit rejection, got %v", err)
+	}
+
+	tokens := LimitConfig{TokensPerMinute: 6000}
+	if _, err := p.acquire(context.Background(), "ollama", tokens, 6000); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := p.acquire(ctx, "ollama", tokens, 100); err != context.DeadlineExceeded {
+		t.Fatalf("expected to wait for token budget, got %v", err)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Fatal("expected the request to wait for token budget")
+	}
+}
+
+func TestNormalizeLimits(t *testing.T) {
+	if err := normalizeLimits("providers.x", LimitConfig{MaxConcurrent: 2, RequestsPerMinute: 60}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := normalizeLimits("providers.x", LimitConfig{QueueSize: -1}); err == nil || !strings.Contains(err.Error(), "providers.x.limits") {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if got := (LimitConfig{}).queueTimeout(); got != time.Minute {
+		t.Fatalf("expected default queue timeout, got %v", got)
+	}
+}
+
+func TestProviderLimits_ThrottledRequestsDoNotFillQueue(t *testing.T) {
+	m := NewMetrics()
+	p := newProviderLimits(m)
+	limits := LimitConfig{MaxConcurrent: 1, QueueSize: 1, TokensPerMinute: 6000}
+	slot, err := p.acquire(context.Background(), "x", limits, 6000)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	slot.release()
+
+	// The next request takes the slot and sleeps for token budget.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.acquire(ctx, "x", limits, 100)
+		done <- err
+	}()
+	l := p.get("x")
+	for i := 0; ; i++ {
+		l.mu.Lock()
+		throttled := l.throttled
+		l.mu.Unlock()
+		if throttled == 1 {
+			break
+		}
+		if i == 1000 {
+			t.Fatal("expected a throttled request")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A request for the slot still fits in the queue.
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer waitCancel()
+	if _, err := p.acquire(waitCtx, "x", limits, 1); err != context.DeadlineExceeded {
+		t.Fatalf("expected to wait in the queue, got %v", err)
+	}
+	out := metricsOutput(m)
+	for _, want := range []string{`furiwake_queue_depth{route="x"} 0`, `furiwake_rate_limited_requests{route="x"} 1`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in metrics:\n%s", want, out)
+		}
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected the throttled request to be cancelled, got %v", err)
+	}
+}
+
+// waitForQueue blocks until n requests are queued on the named provider.
+func waitForQueue(t *testing.T, p *providerLimits, name string, n int) {
+	t.Helper()
+	l := p.get(name)
+	for i := 0; i < 1000; i++ {
+		l.mu.Lock()
+		waiting := l.waiting
+		l.mu.Unlock()
+		if waiting >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d queued requests on %s", n, name)
+}
+
+func metricsOutput(m *Metrics) string {
+	var out strings.Builder
+	_, _ = m.WriteTo(&out)
+	return out.String()
+}
+
+func TestServeProvider_QueueRejectionFallsBack(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenAIChatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		_ = json.NewEncoder(w).Encode(OpenAIChatResponse{
+			Choices: []OpenAIChoice{{Message: OpenAIMessage{Role: "assistant", Content: "from " + req.Model}, FinishReason: "stop"}},
+		})
+	}))
+	defer upstream.Close()
+
+	limits := LimitConfig{RequestsPerMinute: 1, QueueTimeoutSeconds: 1}
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "primary",
+		Providers: map[string]ProviderConfig{
+			"primary":   {Type: ProviderTypeOpenAI, URL: upstream.URL, Model: "a", Fallback: []string{"secondary"}, Limits: limits},
+			"secondary": {Type: ProviderTypeOpenAI, URL: upstream.URL, Model: "b", Limits: limits},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+	body := []byte(`{"model":"claude","messages":[{"role":"user","content":"hi"}]}`)
+
+	// primary, then secondary once primary's budget is spent, then 429.
+	for i, want := range []string{"from a", "from b"} {
+		rr := httptest.NewRecorder()
+		s.handleMessages(rr, httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body)))
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), want) {
+			t.Fatalf("request %d: expected %q, got %d %s", i, want, rr.Code, rr.Body.String())
+		}
+	}
+	rr := httptest.NewRecorder()
+	s.handleMessages(rr, httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body)))
+	if rr.Code != http.StatusTooManyRequests || !strings.Contains(rr.Body.String(), "rate_limit_error") {
+		t.Fatalf("expected 429, got %d %s", rr.Code, rr.Body.String())
+	}
+}
@@ -29,6 +29,12 @@ func NewLogger() *Logger {
 	return l
 }
 
+// NewConsoleLogger returns a logger that writes to the console only, for
+// commands that must not truncate a running server's debug log.
+func NewConsoleLogger() *Logger {
+	return &Logger{}
+}
+
 func (l *Logger) Infof(format string, args ...interface{}) {
 	l.log(colorGreen, "INFO", format, args...)
 }
@@ -13,7 +13,21 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplay(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			log.Fatalf("replay: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "usage" {
+		if err := runUsage(os.Args[2:], time.Now(), os.Stdout, os.Stderr); err != nil {
+			log.Fatalf("usage: %v", err)
+		}
+		return
+	}
+
 	configPath := flag.String("config", "furiwake.yaml", "path to config yaml")
+	watch := flag.Bool("watch", false, "reload the config automatically when the file changes")
 	flag.Parse()
 
 	cfg, err := LoadConfig(*configPath)
@@ -32,10 +46,22 @@ func main() {
 		}
 	}()
 
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	if *watch {
+		srv.WatchConfig(watchCtx, *configPath, 2*time.Second)
+	}
+
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	sig := <-sigCh
+	for sig == syscall.SIGHUP {
+		logger.Infof("received SIGHUP, reloading %s", *configPath)
+		_ = srv.ReloadConfig(*configPath)
+		sig = <-sigCh
+	}
 	logger.Warnf("received signal %s, shutting down", sig.String())
+	stopWatch()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// markerCommentPattern matches the HTML comments routing markers are usually
+// written in, e.g. <!-- @route:codex @model:gpt-5.3-codex -->.
+var markerCommentPattern = regexp.MustCompile(`(?s)<!--(.*?)-->`)
+
+// valueMarkerPatterns match the @name:value markers, including the spaces that
+// follow them so removal does not leave gaps behind.
+var valueMarkerPatterns = []*regexp.Regexp{
+	regexp.MustCompile(routeMarkerPattern.String() + `[ \t]*`),
+	regexp.MustCompile(modelMarkerPattern.String() + `[ \t]*`),
+	regexp.MustCompile(reasoningMarkerPattern.String() + `[ \t]*`),
+	regexp.MustCompile(tierMarkerPattern.String() + `[ \t]*`),
+}
+
+// removedMarker stands in for a removed marker until the whitespace around it
+// is tidied; U+FDD0 is a Unicode noncharacter, so prompts do not contain it.
+const removedMarker = "\uFDD0"
+
+// removedMarkerRun matches one or more adjacent removed markers with the
+// whitespace around them.
+var removedMarkerRun = regexp.MustCompile(`\s*` + removedMarker + `(?:\s*` + removedMarker + `)*\s*`)
+
+// StripMarkersEnabled reports whether routing markers are removed before
+// requests are forwarded. It defaults to true.
+func (c *Config) StripMarkersEnabled() bool {
+	return c.StripMarkers == nil || *c.StripMarkers
+}
+
+func configPresetNames(cfg *Config) []string {
+	names := make([]string, 0, len(cfg.Presets))
+	for name := range cfg.Presets {
+		names = append(names, name)
+	}
+	return names
+}
+
+// StripRoutingMarkers removes the markers ResolveAll recognizes from the system
+// prompt and message text of req. If body is the raw request it was decoded
+// from, a re-encoded body is returned as well; fields furiwake does not model
+// and messages without markers are kept byte for byte. The returned bool
+// reports whether anything was removed.
+func StripRoutingMarkers(req *AnthropicMessageRequest, body []byte, presetNames []string) ([]byte, bool, error) {
+	system, systemChanged := stripMarkersFromContent(req.System, presetNames)
+	changedMessages := map[int]bool{}
+	for i, msg := range req.Messages {
+		content, changed := stripMarkersFromContent(msg.Content, presetNames)
+		if changed {
+			req.Messages[i].Content = content
+			changedMessages[i] = true
+		}
+	}
+	if !systemChanged && len(changedMessages) == 0 {
+		return body, false, nil
+	}
+	if systemChanged {
+		req.System = system
+	}
+	if body == nil {
+		return nil, true, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, true, err
+	}
+	if systemChanged {
+		raw, err := json.Marshal(req.System)
+		if err != nil {
+			return nil, true, err
+		}
+		fields["system"] = raw
+	}
+	if len(changedMessages) > 0 {
+		var messages []json.RawMessage
+		if err := json.Unmarshal(fields["messages"], &messages); err != nil {
+			return nil, true, err
+		}
+		for i := range changedMessages {
+			raw, err := json.Marshal(req.Messages[i])
+			if err != nil {
+				return nil, true, err
+			}
+			messages[i] = raw
+		}
+		raw, err := json.Marshal(messages)
+		if err != nil {
+			return nil, true, err
+		}
+		fields["messages"] = raw
+	}
+	out, err := json.Marshal(fields)
+	return out, true, err
+}
+
+// stripResponsesMarkers strips markers from the instructions and input
+// messages of a raw Responses API request forwarded natively.
+func stripResponsesMarkers(raw map[string]interface{}, presetNames []string) {
+	if instructions, changed := stripMarkersFromContent(raw["instructions"], presetNames); changed {
+		raw["instructions"] = instructions
+	}
+	input, changed := stripMarkersFromContent(raw["input"], presetNames)
+	if changed {
+		raw["input"] = input
+		return
+	}
+	items, _ := raw["input"].([]interface{})
+	for _, item := range items {
+		message, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if content, changed := stripMarkersFromContent(message["content"], presetNames); changed {
+			message["content"] = content
+		}
+	}
+}
+
+// stripMarkersFromContent strips markers from a string or from the text parts
+// of a content block list. Text blocks left empty are dropped; content that
+// would end up empty is returned unchanged, since providers reject it.
+func stripMarkersFromContent(content interface{}, presetNames []string) (interface{}, bool) {
+	switch v := content.(type) {
+	case string:
+		text, changed := stripMarkersFromText(v, presetNames)
+		if !changed || text == "" {
+			return content, false
+		}
+		return text, true
+
+	case []AnthropicContentBlock:
+		out := make([]AnthropicContentBlock, 0, len(v))
+		changed := false
+		for _, block := range v {
+			if block.Type == "text" {
+				text, blockChanged := stripMarkersFromText(block.Text, presetNames)
+				if blockChanged {
+					changed = true
+					if text == "" {
+						continue
+					}
+					block.Text = text
+				}
+			}
+			out = append(out, block)
+		}
+		if !changed || len(out) == 0 {
+			return content, false
+		}
+		return out, true
+
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		changed := false
+		for _, item := range v {
+			part, ok := item.(map[string]interface{})
+			if !ok || !isTextPart(part) {
+				out = append(out, item)
+				continue
+			}
+			text, _ := part["text"].(string)
+			stripped, partChanged := stripMarkersFromText(text, presetNames)
+			if !partChanged {
+				out = append(out, item)
+				continue
+			}
+			changed = true
+			if stripped == "" {
+				continue
+			}
+			copied := make(map[string]interface{}, len(part))
+			for key, value := range part {
+				copied[key] = value
+			}
+			copied["text"] = stripped
+			out = append(out, copied)
+		}
+		if !changed || len(out) == 0 {
+			return content, false
+		}
+		return out, true
+	}
+	return content, false
+}
+
+// isTextPart reports whether a decoded content part carries prompt text, in
+// either Anthropic (text) or Responses (input_text) form.
+func isTextPart(part map[string]interface{}) bool {
+	switch part["type"] {
+	case "text", "input_text":
+		_, ok := part["text"].(string)
+		return ok
+	}
+	return false
+}
+
+// stripMarkersFromText removes routing markers from text, together with any
+// HTML comment that held nothing else. Only the whitespace around a removed
+// marker is tidied; the rest of the text is left as it was.
+func stripMarkersFromText(text string, presetNames []string) (string, bool) {
+	if !strings.Contains(text, "@") {
+		return text, false
+	}
+	out := markerCommentPattern.ReplaceAllStringFunc(text, func(comment string) string {
+		inner := comment[len("<!--") : len(comment)-len("-->")]
+		stripped := removeMarkers(inner, presetNames, "")
+		if stripped == inner {
+			return comment
+		}
+		if strings.TrimSpace(stripped) == "" {
+			return removedMarker
+		}
+		return "<!--" + stripped + "-->"
+	})
+	out = removeMarkers(out, presetNames, removedMarker)
+	if out == text {
+		return text, false
+	}
+	return tidyRemovedMarkers(out), true
+}
+
+// tidyRemovedMarkers drops the removedMarker placeholders in text. A marker
+// on a line of its own takes the line with it, one between words leaves a
+// single space, and one at either end of the text takes the surrounding
+// whitespace with it.
+func tidyRemovedMarkers(text string) string {
+	var b strings.Builder
+	prev := 0
+	for _, loc := range removedMarkerRun.FindAllStringIndex(text, -1) {
+		b.WriteString(text[prev:loc[0]])
+		prev = loc[1]
+		run := text[loc[0]:loc[1]]
+		first := strings.Index(run, removedMarker)
+		last := strings.LastIndex(run, removedMarker) + len(removedMarker)
+		before, after := run[:first], run[last:]
+		// Keep the indentation of the line that follows.
+		indent := ""
+		if i := strings.LastIndex(after, "\n"); i >= 0 {
+			indent = after[i+1:]
+		}
+		atStart, atEnd := loc[0] == 0, loc[1] == len(text)
+		newlines := strings.Count(before, "\n")
+		if n := strings.Count(after, "\n"); n > newlines {
+			newlines = n
+		}
+		switch {
+		case atEnd:
+		case atStart:
+			b.WriteString(indent)
+		case newlines > 0:
+			b.WriteString(strings.Repeat("\n", newlines) + indent)
+		case before != "" || after != "":
+			b.WriteString(" ")
+		}
+	}
+	b.WriteString(text[prev:])
+	return b.String()
+}
+
+// removeMarkers replaces the markers in text with replacement.
+func removeMarkers(text string, presetNames []string, replacement string) string {
+	for _, pattern := range valueMarkerPatterns {
+		text = pattern.ReplaceAllLiteralString(text, replacement)
+	}
+	for _, name := range presetNames {
+		text = removePresetMarker(text, "@"+name, replacement)
+	}
+	return text
+}
+
+// removePresetMarker replaces marker wherever ExtractPresetName would match
+// it: at the end of text or followed by whitespace, '-' or '<'.
+func removePresetMarker(text, marker, replacement string) string {
+	var b strings.Builder
+	for {
+		idx := strings.Index(text, marker)
+		if idx < 0 {
+			b.WriteString(text)
+			return b.String()
+		}
+		end := idx + len(marker)
+		if end < len(text) && !isPresetMarkerBoundary(text[end]) {
+			b.WriteString(text[:end])
+			text = text[end:]
+			continue
+		}
+		b.WriteString(text[:idx])
+		b.WriteString(replacement)
+		text = strings.TrimLeft(text[end:], " \t")
+	}
+}
+
+func isPresetMarkerBoundary(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == '-' || ch == '<'
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStripMarkersFromText(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"comment", "<!-- @route:codex @model:gpt-5.3-codex @reasoning:high -->\n\nYou are a coder.", "You are a coder."},
+		{"inline", "Be brief. @route:openai @tier:priority", "Be brief."},
+		{"preset", "<!-- @fast -->\nHello @fast-->", "Hello -->"},
+		{"comment with other text", "<!-- note @route:codex -->\nHi", "<!-- note -->\nHi"},
+		{"preset prefix is not a marker", "@faster things", "@faster things"},
+		{"unrelated comment", "<!-- keep me -->", "<!-- keep me -->"},
+		{"marker line", "Intro.\n\n<!-- @route:codex -->\n\n    code()\n", "Intro.\n\n    code()\n"},
+		{"marker between words", "Use @model:gpt-5 the fast one", "Use the fast one"},
+		{"other text untouched", "  a\n\n\n\nb  @route:codex\n\n\n\nc  ", "  a\n\n\n\nb\n\n\n\nc  "},
+	}
+	for _, tc := range cases {
+		got, _ := stripMarkersFromText(tc.in, []string{"fast"})
+		if got != tc.want {
+			t.Fatalf("%s: got %q want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestStripRoutingMarkers_ReencodesBody(t *testing.T) {
+	body := []byte(`{"model":"claude","temperature":0.25,"system":[{"type":"text","text":"<!-- @route:codex -->","cache_control":{"type":"ephemeral"}},{"type":"text","text":"Be helpful."}],"messages":[{"role":"user","content":"plain"},{"role":"user","content":[{"type":"text","text":"hi @model:gpt-5-mini"}]}]}`)
+	var req AnthropicMessageRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	out, changed, err := StripRoutingMarkers(&req, body, nil)
+	if err != nil || !changed {
+		t.Fatalf("expected markers to be stripped, changed=%v err=%v", changed, err)
+	}
+	got := string(out)
+	if strings.Contains(got, "@route") || strings.Contains(got, "@model") {
+		t.Fatalf("markers remain in body: %s", got)
+	}
+	for _, want := range []string{`"temperature":0.25`, `"system":[{"text":"Be helpful.","type":"text"}]`, `{"role":"user","content":"plain"}`, `"text":"hi"`} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %s in %s", want, got)
+		}
+	}
+
+	unchanged := []byte(`{"model":"claude","messages":[{"role":"user","content":"hi"}]}`)
+	req = AnthropicMessageRequest{}
+	_ = json.Unmarshal(unchanged, &req)
+	out, changed, _ = StripRoutingMarkers(&req, unchanged, nil)
+	if changed || !bytes.Equal(out, unchanged) {
+		t.Fatalf("body without markers must be relayed as received: %s", out)
+	}
+}
+
+func TestHandleMessages_StripsMarkersForPassthrough(t *testing.T) {
+	var forwarded string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		forwarded = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"id":"msg_1","type":"message","role":"assistant","content":[],"usage":{"input_tokens":1,"output_tokens":1}}`)
+	}))
+	defer upstream.Close()
+
+	disabled := false
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "openai",
+		Providers: map[string]ProviderConfig{
+			"anthropic": {Type: ProviderTypePassthrough, URL: upstream.URL},
+			"openai":    {Type: ProviderTypeOpenAI, URL: upstream.URL, Model: "gpt-5-mini"},
+		},
+	}
+	body := `{"model":"claude","system":"<!-- @route:anthropic -->\nYou review code.","messages":[{"role":"user","content":"hi"}]}`
+
+	s := NewServer(cfg, NewLogger())
+	rr := httptest.NewRecorder()
+	s.handleMessages(rr, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(forwarded, "@route") || !strings.Contains(forwarded, `"system":"You review code."`) {
+		t.Fatalf("markers were forwarded: %s", forwarded)
+	}
+
+	cfg.StripMarkers = &disabled
+	s = NewServer(cfg, NewLogger())
+	s.handleMessages(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body)))
+	if forwarded != body {
+		t.Fatalf("with strip_markers off the body must be relayed as received: %s", forwarded)
+	}
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// routeLabels are the labels shared by the per-route metrics.
+var routeLabels = []string{"route", "provider_type", "model", "preset"}
+
+// latencyBuckets covers fast first tokens through long agent streams (seconds).
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Metrics holds the counters and histograms served on /metrics in the
+// Prometheus text exposition format.
+type Metrics struct {
+	requests          *metricVec
+	retries           *metricVec
+	upstreamLatency   *metricVec
+	timeToFirstToken  *metricVec
+	streamDuration    *metricVec
+	tokens            *metricVec
+	translationErrors *metricVec
+	splitArms         *metricVec
+	queueDepth        *metricVec
+	throttled         *metricVec
+	queueWait         *metricVec
+	queueRejected     *metricVec
+	all               []*metricVec
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		requests:          newCounterVec("furiwake_requests_total", "Requests served, by final route and HTTP status.", append(routeLabels, "status")),
+		retries:           newCounterVec("furiwake_upstream_retries_total", "Upstream requests retried after a transport error, 429, 5xx or 529.", []string{"route", "provider_type", "model"}),
+		upstreamLatency:   newHistogramVec("furiwake_upstream_latency_seconds", "Time until the upstream returned response headers, including retries.", routeLabels, latencyBuckets),
+		timeToFirstToken:  newHistogramVec("furiwake_time_to_first_token_seconds", "Time until the first content delta was streamed to the client.", routeLabels, latencyBuckets),
+		streamDuration:    newHistogramVec("furiwake_stream_duration_seconds", "Duration of streamed responses.", routeLabels, latencyBuckets),
+		tokens:            newCounterVec("furiwake_tokens_total", "Tokens reported in the translated usage, by direction (input/output).", append(routeLabels, "direction")),
+		translationErrors: newCounterVec("furiwake_translation_errors_total", "Requests or responses that failed to translate.", routeLabels),
+		splitArms:         newCounterVec("furiwake_split_requests_total", "Requests routed by a weighted split, by split and chosen provider/model arm.", []string{"split", "arm"}),
+		queueDepth:        newGaugeVec("furiwake_queue_depth", "Requests waiting for a provider slot.", []string{"route"}),
+		throttled:         newGaugeVec("furiwake_rate_limited_requests", "Requests waiting for request or token budget.", []string{"route"}),
+		queueWait:         newHistogramVec("furiwake_queue_wait_seconds", "Time requests spent waiting for a provider slot or rate budget.", []string{"route"}, latencyBuckets),
+		queueRejected:     newCounterVec("furiwake_queue_rejected_total", "Requests rejected by a provider queue, by reason.", []string{"route", "reason"}),
+	}
+	m.all = []*metricVec{m.requests, m.retries, m.upstreamLatency, m.timeToFirstToken, m.streamDuration, m.tokens, m.translationErrors, m.splitArms, m.queueDepth, m.throttled, m.queueWait, m.queueRejected}
+	return m
+}
+
+// WriteTo writes every metric in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	if m == nil {
+		return 0, nil
+	}
+	var buf bytes.Buffer
+	for _, v := range m.all {
+		v.write(&buf)
+	}
+	return buf.WriteTo(w)
+}
+
+func (m *Metrics) addRetry(routeName, providerType, model string) {
+	if m == nil {
+		return
+	}
+	m.retries.Add(1, routeName, providerType, model)
+}
+
+func (m *Metrics) observeUpstreamLatency(route *RouteResolution, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.upstreamLatency.Observe(d.Seconds(), routeLabelValues(route)...)
+}
+
+func (m *Metrics) addTranslationError(route *RouteResolution) {
+	if m == nil {
+		return
+	}
+	m.translationErrors.Add(1, routeLabelValues(route)...)
+}
+
+func (m *Metrics) addSplitArm(split, arm string) {
+	if m == nil {
+		return
+	}
+	m.splitArms.Add(1, split, arm)
+}
+
+func (m *Metrics) setQueueDepth(route string, depth int) {
+	if m == nil {
+		return
+	}
+	m.queueDepth.Set(float64(depth), route)
+}
+
+func (m *Metrics) setThrottled(route string, n int) {
+	if m == nil {
+		return
+	}
+	m.throttled.Set(float64(n), route)
+}
+
+func (m *Metrics) observeQueueWait(route string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.queueWait.Observe(d.Seconds(), route)
+}
+
+func (m *Metrics) addQueueRejected(route, reason string) {
+	if m == nil {
+		return
+	}
+	m.queueRejected.Add(1, route, reason)
+}
+
+func routeLabelValues(route *RouteResolution) []string {
+	return []string{route.ProviderName, route.Provider.Type, route.Model, route.PresetName}
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = s.metrics.WriteTo(w)
+}
+
+// observedWriter wraps the client ResponseWriter for one request to record
+// its status, time to first token and the Anthropic usage it carries.
+type observedWriter struct {
+	http.ResponseWriter
+	start      time.Time
+	stream     bool
+	status     int
+	firstToken time.Duration
+	// usage is the Anthropic usage the response carried; non-stream bodies
+	// are parsed once the response is complete.
+	usage      AnthropicUsage
+	usageFinal bool
+	events     sseEventSplitter
+	body       bytes.Buffer
+	// transcript reassembles the streamed message when the audit log is on.
+	transcript *messageTranscript
+	// responses marks a natively relayed Responses API response, whose
+	// events and body are read in that format instead of Anthropic's.
+	responses bool
+	// streamFailed is set when the stream ended with an error event.
+	streamFailed bool
+}
+
+// maxObservedBody bounds how much of a non-stream body is kept to read usage.
+const maxObservedBody = 1 << 20
+
+func newObservedWriter(w http.ResponseWriter, stream bool) *observedWriter {
+	o := &observedWriter{ResponseWriter: w, start: time.Now(), stream: stream}
+	o.events.onEvent = o.onEvent
+	return o
+}
+
+func (o *observedWriter) WriteHeader(status int) {
+	if o.status == 0 {
+		o.status = status
+	}
+	o.ResponseWriter.WriteHeader(status)
+}
+
+func (o *observedWriter) Write(p []byte) (int, error) {
+	if o.status == 0 {
+		o.status = http.StatusOK
+	}
+	if o.stream && o.status < 400 {
+		_ = o.events.Write(p)
+	} else if o.body.Len()+len(p) <= maxObservedBody {
+		o.body.Write(p)
+	}
+	return o.ResponseWriter.Write(p)
+}
+
+func (o *observedWriter) Flush() {
+	if flusher, ok := o.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (o *observedWriter) onEvent(_ string, data string) error {
+	if o.responses {
+		o.onResponsesEvent(data)
+		return nil
+	}
+	var event AnthropicStreamEvent
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return nil
+	}
+	if o.transcript != nil {
+		o.transcript.add(event)
+	}
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			o.usage = event.Message.Usage
+		}
+	case "content_block_delta":
+		if o.firstToken == 0 {
+			o.firstToken = time.Since(o.start)
+		}
+	case "message_delta":
+		if event.Usage != nil {
+			o.usage.addDelta(*event.Usage)
+		}
+	case "error":
+		o.streamFailed = true
+	}
+	return nil
+}
+
+// responsesUsageEnvelope holds the usage of a Responses API object.
+type responsesUsageEnvelope struct {
+	Usage map[string]interface{} `json:"usage"`
+}
+
+func (o *observedWriter) onResponsesEvent(data string) {
+	var event struct {
+		Type     string                 `json:"type"`
+		Response responsesUsageEnvelope `json:"response"`
+	}
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return
+	}
+	switch event.Type {
+	case "response.output_text.delta", "response.reasoning_summary_text.delta", "response.function_call_arguments.delta":
+		if o.firstToken == 0 {
+			o.firstToken = time.Since(o.start)
+		}
+	case "response.completed", "response.incomplete":
+		if event.Response.Usage != nil {
+			o.usage = anthropicUsageFromResponses(event.Response.Usage)
+		}
+	case "response.failed", "error":
+		o.streamFailed = true
+	}
+}
+
+// finalUsage returns the usage of the finished response.
+func (o *observedWriter) finalUsage() AnthropicUsage {
+	if !o.stream && !o.usageFinal {
+		o.usageFinal = true
+		if o.responses {
+			var resp responsesUsageEnvelope
+			if json.Unmarshal(o.body.Bytes(), &resp) == nil && resp.Usage != nil {
+				o.usage = anthropicUsageFromResponses(resp.Usage)
+			}
+			return o.usage
+		}
+		var resp AnthropicMessageResponse
+		if json.Unmarshal(o.body.Bytes(), &resp) == nil {
+			o.usage = resp.Usage
+		}
+	}
+	return o.usage
+}
+
+// addDelta folds the usage of a message_delta event into u. Output counts
+// are cumulative; input counts are only present when the upstream reports
+// them late, so zero leaves them unchanged.
+func (u *AnthropicUsage) addDelta(delta AnthropicUsage) {
+	if delta.InputTokens > 0 {
+		u.InputTokens = delta.InputTokens
+	}
+	if delta.CacheCreationInputTokens > 0 {
+		u.CacheCreationInputTokens = delta.CacheCreationInputTokens
+	}
+	if delta.CacheReadInputTokens > 0 {
+		u.CacheReadInputTokens = delta.CacheReadInputTokens
+	}
+	u.OutputTokens = delta.OutputTokens
+}
+
+// promptTokens is the whole prompt size: uncached input plus cache writes
+// and reads.
+func (u AnthropicUsage) promptTokens() int {
+	return u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+// record adds the finished request to the metrics under route.
+func (o *observedWriter) record(m *Metrics, route *RouteResolution) {
+	if m == nil || route == nil {
+		return
+	}
+	labels := routeLabelValues(route)
+	status := o.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	m.requests.Add(1, append(labels, strconv.Itoa(status))...)
+	if status >= 400 {
+		return
+	}
+
+	if o.stream {
+		m.streamDuration.Observe(time.Since(o.start).Seconds(), labels...)
+		if o.firstToken > 0 {
+			m.timeToFirstToken.Observe(o.firstToken.Seconds(), labels...)
+		}
+	}
+	usage := o.finalUsage()
+	if usage.InputTokens > 0 {
+		m.tokens.Add(float64(usage.InputTokens), append(labels, "input")...)
+	}
+	if usage.OutputTokens > 0 {
+		m.tokens.Add(float64(usage.OutputTokens), append(labels, "output")...)
+	}
+}
+
+// metricVec is a counter or histogram family keyed by label values.
+type metricVec struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64
+	// bucketCounts[i] counts observations <= buckets[i]; cumulated on output.
+	bucketCounts []uint64
+	count        uint64
+}
+
+func newCounterVec(name, help string, labels []string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "counter", labels: labels, series: map[string]*metricSeries{}}
+}
+
+func newGaugeVec(name, help string, labels []string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "gauge", labels: labels, series: map[string]*metricSeries{}}
+}
+
+func newHistogramVec(name, help string, labels []string, buckets []float64) *metricVec {
+	return &metricVec{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets, series: map[string]*metricSeries{}}
+}
+
+func (v *metricVec) get(values []string) *metricSeries {
+	key := strings.Join(values, "\x00")
+	s, ok := v.series[key]
+	if !ok {
+		s = &metricSeries{labelValues: append([]string(nil), values...)}
+		if v.kind == "histogram" {
+			s.bucketCounts = make([]uint64, len(v.buckets))
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+// Add increments a counter.
+func (v *metricVec) Add(delta float64, values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.get(values).value += delta
+}
+
+// Set sets a gauge.
+func (v *metricVec) Set(value float64, values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.get(values).value = value
+}
+
+// Observe records one histogram observation.
+func (v *metricVec) Observe(x float64, values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s := v.get(values)
+	s.value += x
+	s.count++
+	for i, upper := range v.buckets {
+		if x <= upper {
+			s.bucketCounts[i]++
+			break
+		}
+	}
+}
+
+func (v *metricVec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind)
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := v.series[key]
+		labels := formatLabels(v.labels, s.labelValues)
+		if v.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", v.name, wrapLabels(labels), formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, upper := range v.buckets {
+			cumulative += s.bucketCounts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, wrapLabels(joinLabels(labels, `le="`+formatFloat(upper)+`"`)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, wrapLabels(joinLabels(labels, `le="+Inf"`)), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, wrapLabels(labels), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, wrapLabels(labels), s.count)
+	}
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	parts := make([]string, 0, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		parts = append(parts, name+`="`+labelValueEscaper.Replace(value)+`"`)
+	}
+	return strings.Join(parts, ",")
+}
+
+func joinLabels(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	m := NewMetrics()
+	m.requests.Add(1, "openai", "openai", "gpt-5-mini", "", "200")
+	m.requests.Add(1, "openai", "openai", "gpt-5-mini", "", "200")
+	m.tokens.Add(12, "openai", "openai", "gpt-5-mini", `a"b`, "input")
+	m.upstreamLatency.Observe(0.3, "openai", "openai", "gpt-5-mini", "")
+	m.upstreamLatency.Observe(7, "openai", "openai", "gpt-5-mini", "")
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo error: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE furiwake_requests_total counter\n",
+		`furiwake_requests_total{route="openai",provider_type="openai",model="gpt-5-mini",preset="",status="200"} 2` + "\n",
+		`furiwake_tokens_total{route="openai",provider_type="openai",model="gpt-5-mini",preset="a\"b",direction="input"} 12` + "\n",
+		"# TYPE furiwake_upstream_latency_seconds histogram\n",
+		`furiwake_upstream_latency_seconds_bucket{route="openai",provider_type="openai",model="gpt-5-mini",preset="",le="0.25"} 0` + "\n",
+		`furiwake_upstream_latency_seconds_bucket{route="openai",provider_type="openai",model="gpt-5-mini",preset="",le="0.5"} 1` + "\n",
+		`furiwake_upstream_latency_seconds_bucket{route="openai",provider_type="openai",model="gpt-5-mini",preset="",le="10"} 2` + "\n",
+		`furiwake_upstream_latency_seconds_bucket{route="openai",provider_type="openai",model="gpt-5-mini",preset="",le="+Inf"} 2` + "\n",
+		`furiwake_upstream_latency_seconds_sum{route="openai",provider_type="openai",model="gpt-5-mini",preset=""} 7.3` + "\n",
+		`furiwake_upstream_latency_seconds_count{route="openai",provider_type="openai",model="gpt-5-mini",preset=""} 2` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in exposition:\n%s", want, out)
+		}
+	}
+}
+
+func TestHandleMessages_RecordsMetrics(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hello\"}}]}\n\n")
+		_, _ = io.WriteString(w, "data: {\"id\":\"c1\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":9,\"completion_tokens\":4}}\n\n")
+		_, _ = io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "openai",
+		Providers: map[string]ProviderConfig{
+			"openai": {Type: ProviderTypeOpenAI, URL: upstream.URL, Model: "gpt-5-mini"},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+
+	body := []byte(`{"model":"claude","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	rr := httptest.NewRecorder()
+	s.handleMessages(rr, httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	metrics := httptest.NewRecorder()
+	s.handleMetrics(metrics, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	out := metrics.Body.String()
+	labels := `route="openai",provider_type="openai",model="gpt-5-mini",preset=""`
+	for _, want := range []string{
+		`furiwake_requests_total{` + labels + `,status="200"} 1`,
+		`furiwake_tokens_total{` + labels + `,direction="output"} 4`,
+		`furiwake_time_to_first_token_seconds_count{` + labels + `} 1`,
+		`furiwake_stream_duration_seconds_count{` + labels + `} 1`,
+		`furiwake_upstream_latency_seconds_count{` + labels + `} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in metrics:\n%s", want, out)
+		}
+	}
+}
@@ -3,63 +3,234 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
 )
 
-func (s *Server) proxyPassthrough(
-	ctx context.Context,
-	w http.ResponseWriter,
-	r *http.Request,
-	routeName string,
-	modelName string,
-	reasoningEffort string,
-	provider ProviderConfig,
-	body []byte,
-) {
+// passthroughProvider relays Anthropic Messages requests to an
+// Anthropic-compatible upstream without translation.
+type passthroughProvider struct{}
+
+func (passthroughProvider) Validate(string, ProviderConfig) error {
+	return nil
+}
+
+// TranslateRequest relays the body as received, except that the model is
+// rewritten when the route names one (@model marker, preset or
+// providers.<name>.model) and thinking blocks carrying Codex reasoning are
+// dropped.
+func (passthroughProvider) TranslateRequest(call *ProviderCall) ([]byte, error) {
+	body, err := stripCodexReasoning(call.Body)
+	if err != nil {
+		return nil, err
+	}
+	if call.Route.Model == "" || call.Route.Model == call.Request.Model {
+		return body, nil
+	}
+	return rewriteRequestModel(body, call.Route.Model)
+}
+
+func (passthroughProvider) Send(ctx context.Context, call *ProviderCall, payload []byte) (*http.Response, error) {
+	return sendRelay(ctx, call, payload, nil)
+}
+
+// sendRelay forwards payload to the route's provider at the inbound path with
+// the inbound headers. adjust, if set, edits the headers before provider auth
+// and the anthropic_beta rules are applied.
+func sendRelay(ctx context.Context, call *ProviderCall, payload []byte, adjust func(http.Header)) (*http.Response, error) {
+	r := call.Inbound
+	provider := call.Route.Provider
 	targetURL, err := joinURL(provider.URL, r.URL.Path, r.URL.RawQuery)
 	if err != nil {
-		writeJSONError(w, http.StatusBadGateway, err.Error())
-		return
+		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, r.Method, targetURL, bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, r.Method, targetURL, bytes.NewReader(payload))
 	if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, "failed to create relay request")
-		return
+		return nil, fmt.Errorf("failed to create relay request: %w", err)
 	}
 
 	copyHeaders(req.Header, r.Header)
 	req.Header.Del("Host")
+	req.Header.Del("Content-Length")
+	// Usage and transcripts are read from the relayed response, so let the
+	// transport negotiate compression and decode it.
+	req.Header.Del("Accept-Encoding")
+	if adjust != nil {
+		adjust(req.Header)
+	}
 	if err := ApplyProviderAuth(req, provider); err != nil {
-		writeJSONError(w, http.StatusBadGateway, err.Error())
+		return nil, err
+	}
+	applyAnthropicBeta(req.Header, provider.AnthropicBeta)
+
+	routeName, modelName := logValueOrDash(call.Route.ProviderName), logValueOrDash(call.Route.Model)
+	resp, err := call.Server.sendWithRetry(ctx, provider, routeName, modelName, func() (*http.Request, error) {
+		attempt := req.Clone(ctx)
+		attempt.Body = io.NopCloser(bytes.NewReader(payload))
+		call.Server.logger.Infof("[HTTP-OUT] req=%s route=%s model=%s reasoning=- tier=- %s %s", logValueOrDash(call.RequestID), routeName, modelName, attempt.Method, attempt.URL.String())
+		return attempt, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("relay failed: %w", err)
+	}
+	return resp, nil
+}
+
+func (passthroughProvider) TranslateStream(w http.ResponseWriter, resp *http.Response, _ *ProviderCall) error {
+	return relayStream(w, resp)
+}
+
+func (passthroughProvider) TranslateResponse(w http.ResponseWriter, resp *http.Response, _ *ProviderCall) error {
+	relayResponse(w, resp)
+	return nil
+}
+
+func (passthroughProvider) TranslateError(w http.ResponseWriter, resp *http.Response, _ *ProviderCall) {
+	relayResponse(w, resp)
+}
+
+func (p passthroughProvider) CountTokens(ctx context.Context, w http.ResponseWriter, call *ProviderCall) {
+	payload, err := p.TranslateRequest(call)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	relayCountTokens(ctx, w, call, p, payload)
+}
 
-	reqID := strings.TrimSpace(req.Header.Get("x-request-id"))
-	if reqID == "" {
-		reqID = "-"
+// relayCountTokens sends a count_tokens request through a relaying provider
+// and copies the upstream answer to w.
+func relayCountTokens(ctx context.Context, w http.ResponseWriter, call *ProviderCall, p Provider, payload []byte) {
+	call.Server.logger.Debugf("req=%s count_tokens %s route=%s", call.RequestID, call.Route.Provider.Type, call.Route.ProviderName)
+	resp, err := p.Send(ctx, call, payload)
+	if err != nil {
+		writeJSONError(w, mapTransportError(err), err.Error())
+		return
 	}
-	if strings.TrimSpace(routeName) == "" {
-		routeName = "-"
+	defer resp.Body.Close()
+	relayResponse(w, resp)
+}
+
+// relayStream copies an upstream SSE response to w, flushing after every
+// read so events are not held back in the response buffer.
+func relayStream(w http.ResponseWriter, resp *http.Response) error {
+	copyHeaders(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		_, err := io.Copy(w, resp.Body)
+		return err
 	}
-	if strings.TrimSpace(modelName) == "" {
-		modelName = "-"
+	buf := make([]byte, 32*1024)
+	atBoundary := true
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			flusher.Flush()
+			atBoundary = bytes.HasSuffix(buf[:n], []byte("\n\n"))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// End an interrupted event stream with an Anthropic error event so
+			// the client sees a failure rather than a truncated message.
+			if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+				if !atBoundary {
+					_, _ = io.WriteString(w, "\n\n")
+				}
+				_ = writeAnthropicStreamError(w, AnthropicErrAPI, "upstream stream interrupted: "+err.Error())
+				flusher.Flush()
+			}
+			return err
+		}
 	}
-	if strings.TrimSpace(reasoningEffort) == "" {
-		reasoningEffort = "-"
+}
+
+// rewriteRequestModel replaces the model field of a JSON request body, leaving
+// every other field as received.
+func rewriteRequestModel(body []byte, model string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("failed to rewrite request model: %w", err)
 	}
-	s.logger.Infof("[HTTP-OUT] req=%s route=%s model=%s reasoning=%s tier=- %s %s", reqID, routeName, modelName, reasoningEffort, req.Method, req.URL.String())
-	resp, err := s.client.Do(req)
+	raw, err := json.Marshal(model)
 	if err != nil {
-		writeJSONError(w, mapTransportError(err), fmt.Sprintf("relay failed: %v", err))
-		return
+		return nil, err
 	}
-	defer resp.Body.Close()
+	fields["model"] = raw
+	return json.Marshal(fields)
+}
 
-	relayResponse(w, resp)
+// stripCodexReasoning removes the thinking blocks furiwake signed with Codex
+// encrypted reasoning from the messages of body. Anthropic rejects their
+// signatures, so a conversation that moves from a chatgpt route to an
+// Anthropic upstream (fallback, split or rule) would fail otherwise. Other
+// fields and messages are kept byte for byte.
+func stripCodexReasoning(body []byte) ([]byte, error) {
+	if !bytes.Contains(body, []byte(codexReasoningSignaturePrefix)) {
+		return body, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("failed to strip codex reasoning: %w", err)
+	}
+	var messages []json.RawMessage
+	if err := json.Unmarshal(fields["messages"], &messages); err != nil {
+		return body, nil
+	}
+	changed := false
+	for i, rawMsg := range messages {
+		var msg map[string]json.RawMessage
+		var blocks []json.RawMessage
+		if json.Unmarshal(rawMsg, &msg) != nil || json.Unmarshal(msg["content"], &blocks) != nil {
+			continue
+		}
+		kept := make([]json.RawMessage, 0, len(blocks))
+		for _, raw := range blocks {
+			var block struct {
+				Type      string `json:"type"`
+				Signature string `json:"signature"`
+			}
+			if json.Unmarshal(raw, &block) == nil && block.Type == "thinking" && strings.HasPrefix(block.Signature, codexReasoningSignaturePrefix) {
+				continue
+			}
+			kept = append(kept, raw)
+		}
+		if len(kept) == len(blocks) {
+			continue
+		}
+		// Providers reject empty content.
+		if len(kept) == 0 {
+			kept = append(kept, json.RawMessage(`{"type":"text","text":"(empty)"}`))
+		}
+		content, err := json.Marshal(kept)
+		if err != nil {
+			return nil, err
+		}
+		msg["content"] = content
+		if messages[i], err = json.Marshal(msg); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+	if !changed {
+		return body, nil
+	}
+	raw, err := json.Marshal(messages)
+	if err != nil {
+		return nil, err
+	}
+	fields["messages"] = raw
+	return json.Marshal(fields)
 }
 
 func joinURL(baseURL, path, rawQuery string) (string, error) {
@@ -2,8 +2,11 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -57,7 +60,13 @@ func TestProxyPassthrough_AppliesProviderAuth(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader([]byte(`{"x":1}`)))
 	req.Header.Set("Authorization", "Bearer client-token")
 
-	s.proxyPassthrough(req.Context(), rr, req, "route", "model", "-", provider, []byte(`{"x":1}`))
+	call := &ProviderCall{
+		Server:  s,
+		Route:   &RouteResolution{ProviderName: "route", Provider: provider, Model: "model"},
+		Body:    []byte(`{"x":1}`),
+		Inbound: req,
+	}
+	s.serveProvider(req.Context(), rr, call)
 
 	if rr.Code != http.StatusOK {
 		t.Fatalf("expected 200, got %d", rr.Code)
@@ -66,3 +75,55 @@ func TestProxyPassthrough_AppliesProviderAuth(t *testing.T) {
 		t.Fatalf("unexpected Authorization header: %q", seenAuthorization)
 	}
 }
+
+func TestPassthroughTranslateRequest_RewritesModel(t *testing.T) {
+	body := []byte(`{"model":"claude-sonnet-4-6","max_tokens":64,"metadata":{"user_id":"u1"},"messages":[]}`)
+	call := &ProviderCall{
+		Route:   &RouteResolution{ProviderName: "anthropic", Provider: ProviderConfig{Type: ProviderTypePassthrough}, Model: "claude-haiku-4-5"},
+		Request: AnthropicMessageRequest{Model: "claude-sonnet-4-6"},
+		Body:    body,
+	}
+	got, err := passthroughProvider{}.TranslateRequest(call)
+	if err != nil {
+		t.Fatalf("TranslateRequest error: %v", err)
+	}
+	want := `{"max_tokens":64,"messages":[],"metadata":{"user_id":"u1"},"model":"claude-haiku-4-5"}`
+	if string(got) != want {
+		t.Fatalf("unexpected body:\n got=%s\nwant=%s", got, want)
+	}
+
+	call.Route.Model = ""
+	got, _ = passthroughProvider{}.TranslateRequest(call)
+	if !bytes.Equal(got, body) {
+		t.Fatalf("body must be relayed unchanged without a route model: %s", got)
+	}
+}
+
+func TestPassthroughTranslateRequest_DropsCodexReasoning(t *testing.T) {
+	body := []byte(`{"model":"claude","messages":[` +
+		`{"role":"user","content":"hi"},` +
+		`{"role":"assistant","content":[{"type":"thinking","thinking":"codex","signature":"` + codexReasoningSignaturePrefix + `enc"},{"type":"thinking","thinking":"claude","signature":"sig"},{"type":"tool_use","id":"t1","name":"ls","input":{}}]},` +
+		`{"role":"assistant","content":[{"type":"thinking","thinking":"only","signature":"` + codexReasoningSignaturePrefix + `enc"}]}]}`)
+	call := &ProviderCall{
+		Route:   &RouteResolution{ProviderName: "anthropic", Provider: ProviderConfig{Type: ProviderTypePassthrough}},
+		Request: AnthropicMessageRequest{Model: "claude"},
+		Body:    body,
+	}
+	got, err := passthroughProvider{}.TranslateRequest(call)
+	if err != nil {
+		t.Fatalf("TranslateRequest error: %v", err)
+	}
+	want := `{"model":"claude","messages":[` +
+		`{"role":"user","content":"hi"},` +
+		`{"content":[{"type":"thinking","thinking":"claude","signature":"sig"},{"type":"tool_use","id":"t1","name":"ls","input":{}}],"role":"assistant"},` +
+		`{"content":[{"type":"text","text":"(empty)"}],"role":"assistant"}]}`
+	var gotFields, wantFields map[string]interface{}
+	_ = json.Unmarshal(got, &gotFields)
+	_ = json.Unmarshal([]byte(want), &wantFields)
+	if !reflect.DeepEqual(gotFields, wantFields) {
+		t.Fatalf("unexpected body:\n got=%s\nwant=%s", got, want)
+	}
+	if !strings.Contains(string(got), `{"role":"user","content":"hi"}`) {
+		t.Fatalf("expected untouched messages to be kept byte for byte: %s", got)
+	}
+}
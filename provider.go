@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider adapts one upstream backend type to the Anthropic Messages API.
+// Implementations are registered by type name and looked up per request, so
+// new backends can be added without touching the router or the server.
+type Provider interface {
+	// Validate checks the provider-specific parts of a providers.<name> entry.
+	Validate(name string, cfg ProviderConfig) error
+	// TranslateRequest encodes the upstream payload for call.
+	TranslateRequest(call *ProviderCall) ([]byte, error)
+	// Send delivers payload upstream and returns the raw upstream response.
+	Send(ctx context.Context, call *ProviderCall, payload []byte) (*http.Response, error)
+	// TranslateStream writes a successful upstream response to w as an
+	// Anthropic SSE stream.
+	TranslateStream(w http.ResponseWriter, resp *http.Response, call *ProviderCall) error
+	// TranslateResponse writes a successful upstream response to w as an
+	// Anthropic message JSON body.
+	TranslateResponse(w http.ResponseWriter, resp *http.Response, call *ProviderCall) error
+	// TranslateError writes an upstream error response (status >= 400) to w.
+	TranslateError(w http.ResponseWriter, resp *http.Response, call *ProviderCall)
+	// CountTokens answers /v1/messages/count_tokens for this provider.
+	CountTokens(ctx context.Context, w http.ResponseWriter, call *ProviderCall)
+}
+
+// reasoningProvider is implemented by providers that honour reasoning effort
+// and service tier settings.
+type reasoningProvider interface {
+	SupportsReasoning() bool
+}
+
+// ProviderCall carries the state of one inbound request through a Provider.
+type ProviderCall struct {
+	Server *Server
+	// Config is the configuration snapshot the request was routed with.
+	Config    *Config
+	RequestID string
+	Route     *RouteResolution
+	Request   AnthropicMessageRequest
+	// Body is the raw inbound request body, used by providers that relay it.
+	Body []byte
+	// Inbound is the original client request (method, path and headers).
+	Inbound *http.Request
+}
+
+var (
+	providerRegistryMu sync.RWMutex
+	providerRegistry   = map[string]Provider{}
+	providerTypeOrder  []string
+)
+
+func init() {
+	RegisterProvider(ProviderTypePassthrough, passthroughProvider{})
+	RegisterProvider(ProviderTypeOpenAI, openAIProvider{})
+	RegisterProvider(ProviderTypeChatGPT, chatGPTProvider{})
+	RegisterProvider(ProviderTypeAnthropic, anthropicProvider{})
+}
+
+// RegisterProvider makes a Provider available under typeName. Registering the
+// same name twice replaces the previous implementation.
+func RegisterProvider(typeName string, p Provider) {
+	typeName = strings.TrimSpace(strings.ToLower(typeName))
+	providerRegistryMu.Lock()
+	defer providerRegistryMu.Unlock()
+	if _, exists := providerRegistry[typeName]; !exists {
+		providerTypeOrder = append(providerTypeOrder, typeName)
+	}
+	providerRegistry[typeName] = p
+}
+
+func LookupProvider(typeName string) (Provider, bool) {
+	providerRegistryMu.RLock()
+	defer providerRegistryMu.RUnlock()
+	p, ok := providerRegistry[typeName]
+	return p, ok
+}
+
+// RegisteredProviderTypes returns the registered type names in registration order.
+func RegisteredProviderTypes() []string {
+	providerRegistryMu.RLock()
+	defer providerRegistryMu.RUnlock()
+	out := make([]string, len(providerTypeOrder))
+	copy(out, providerTypeOrder)
+	return out
+}
+
+func ProviderSupportsReasoning(typeName string) bool {
+	p, ok := LookupProvider(typeName)
+	if !ok {
+		return false
+	}
+	rp, ok := p.(reasoningProvider)
+	return ok && rp.SupportsReasoning()
+}
+
+func requireProviderModel(name string, cfg ProviderConfig) error {
+	if cfg.Model == "" {
+		return fmt.Errorf("providers.%s.model is required for type %s", name, cfg.Type)
+	}
+	return nil
+}
+
+// serveProvider runs call through the provider registered for its route.
+// When the upstream fails before any bytes reach the client, the same request
+// is replayed against each provider in the route's fallback chain.
+func (s *Server) serveProvider(ctx context.Context, w http.ResponseWriter, call *ProviderCall) {
+	primary := call.Route
+	chain := append([]string{primary.ProviderName}, primary.Fallback...)
+
+	observed := newObservedWriter(w, call.Request.Stream)
+	trail := &auditTrail{}
+	if s.audit != nil {
+		observed.transcript = newMessageTranscript()
+		ctx = withAuditTrail(ctx, trail)
+	}
+	defer func() {
+		observed.record(s.metrics, call.Route)
+		s.recordUsage(call, observed)
+		s.writeAudit(call, observed, trail)
+	}()
+	w = observed
+
+	for i, name := range chain {
+		last := i == len(chain)-1
+		if i > 0 {
+			route, err := ResolveFallback(name, primary, call.Config)
+			if err != nil {
+				s.logger.Errorf("req=%s fallback skipped: %v", call.RequestID, err)
+				if last {
+					writeJSONError(w, http.StatusBadGateway, err.Error())
+					return
+				}
+				continue
+			}
+			call.Route = route
+		}
+
+		route, err := s.budgetRoute(call)
+		if err != nil {
+			if !last {
+				s.logger.Warnf("req=%s route=%s failed (%s), falling back to %s", call.RequestID, call.Route.ProviderName, err, chain[i+1])
+				continue
+			}
+			writeJSONError(w, mapTransportError(err), err.Error())
+			return
+		}
+		call.Route = route
+
+		provider, ok := LookupProvider(call.Route.Provider.Type)
+		if !ok {
+			if last {
+				writeJSONError(w, http.StatusBadGateway, "unsupported provider type")
+				return
+			}
+			continue
+		}
+
+		trail.attempts = append(trail.attempts, call.Route.ProviderName)
+		payload, err := provider.TranslateRequest(call)
+		if err != nil {
+			s.metrics.addTranslationError(call.Route)
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		release, err := s.acquireProvider(ctx, call)
+		if err != nil {
+			if !last && shouldFallback(ctx, nil, err) {
+				s.logger.Warnf("req=%s route=%s failed (%s), falling back to %s", call.RequestID, call.Route.ProviderName, err, chain[i+1])
+				continue
+			}
+			writeJSONError(w, mapTransportError(err), err.Error())
+			return
+		}
+
+		trail.payload = payload
+		sendStart := time.Now()
+		resp, err := provider.Send(ctx, call, payload)
+		trail.upstream = time.Since(sendStart)
+		if err == nil {
+			s.metrics.observeUpstreamLatency(call.Route, trail.upstream)
+		}
+		if !last && shouldFallback(ctx, resp, err) {
+			s.logger.Warnf("req=%s route=%s failed (%s), falling back to %s", call.RequestID, call.Route.ProviderName, describeUpstreamFailure(resp, err), chain[i+1])
+			closeResponseBody(resp)
+			release()
+			continue
+		}
+		if err != nil {
+			release()
+			writeJSONError(w, mapTransportError(err), err.Error())
+			return
+		}
+
+		s.writeProviderResponse(w, resp, provider, call)
+		release()
+		return
+	}
+}
+
+func (s *Server) writeProviderResponse(w http.ResponseWriter, resp *http.Response, provider Provider, call *ProviderCall) {
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		provider.TranslateError(w, resp, call)
+		return
+	}
+
+	if call.Request.Stream {
+		if err := provider.TranslateStream(w, resp, call); err != nil {
+			s.metrics.addTranslationError(call.Route)
+			s.logger.Errorf("%s stream translation failed: %v", call.Route.Provider.Type, err)
+		}
+		return
+	}
+	if err := provider.TranslateResponse(w, resp, call); err != nil {
+		s.metrics.addTranslationError(call.Route)
+		s.logger.Errorf("%s response translation failed: %v", call.Route.Provider.Type, err)
+	}
+}
+
+// shouldFallback reports whether an upstream attempt failed in a way another
+// provider may be able to serve: transport errors, 429, 5xx and Codex usage
+// limits. Client cancellation never falls back.
+func shouldFallback(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return true
+	}
+	return isUsageLimitResponse(resp)
+}
+
+func describeUpstreamFailure(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("status %d", resp.StatusCode)
+}
+
+func logValueOrDash(v string) string {
+	if strings.TrimSpace(v) == "" {
+		return "-"
+	}
+	return v
+}
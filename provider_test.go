@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeProvider struct {
+	translated []byte
+}
+
+func (fakeProvider) Validate(string, ProviderConfig) error { return nil }
+
+func (p *fakeProvider) TranslateRequest(call *ProviderCall) ([]byte, error) {
+	p.translated = []byte("fake:" + call.Route.Model)
+	return p.translated, nil
+}
+
+func (fakeProvider) Send(_ context.Context, _ *ProviderCall, payload []byte) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewReader(payload)),
+	}, nil
+}
+
+func (fakeProvider) TranslateStream(w http.ResponseWriter, resp *http.Response, _ *ProviderCall) error {
+	relayResponse(w, resp)
+	return nil
+}
+
+func (fakeProvider) TranslateResponse(w http.ResponseWriter, resp *http.Response, _ *ProviderCall) error {
+	relayResponse(w, resp)
+	return nil
+}
+
+func (fakeProvider) TranslateError(w http.ResponseWriter, resp *http.Response, _ *ProviderCall) {
+	relayResponse(w, resp)
+}
+
+func (fakeProvider) CountTokens(_ context.Context, w http.ResponseWriter, _ *ProviderCall) {
+	writeJSON(w, http.StatusOK, CountTokensResponse{InputTokens: 42})
+}
+
+func registerTestProvider(t *testing.T, typeName string, p Provider) {
+	t.Helper()
+	RegisterProvider(typeName, p)
+	t.Cleanup(func() {
+		providerRegistryMu.Lock()
+		defer providerRegistryMu.Unlock()
+		delete(providerRegistry, typeName)
+		for i, name := range providerTypeOrder {
+			if name == typeName {
+				providerTypeOrder = append(providerTypeOrder[:i], providerTypeOrder[i+1:]...)
+				break
+			}
+		}
+	})
+}
+
+func TestRegisteredProviderTypes_BuiltinOrder(t *testing.T) {
+	got := strings.Join(RegisteredProviderTypes(), "/")
+	if !strings.HasPrefix(got, "passthrough/openai/chatgpt") {
+		t.Fatalf("unexpected builtin provider types: %s", got)
+	}
+}
+
+func TestProviderSupportsReasoning(t *testing.T) {
+	if !ProviderSupportsReasoning(ProviderTypeChatGPT) {
+		t.Fatal("chatgpt should support reasoning")
+	}
+	if ProviderSupportsReasoning(ProviderTypeOpenAI) || ProviderSupportsReasoning("unknown") {
+		t.Fatal("only chatgpt should support reasoning")
+	}
+}
+
+func TestHandleMessages_CustomProvider(t *testing.T) {
+	fake := &fakeProvider{}
+	registerTestProvider(t, "fake", fake)
+
+	path := writeTempConfig(t, `
+listen: ":0"
+spoof_model: "claude-test"
+default_provider: custom
+timeout_seconds: 30
+providers:
+  custom:
+    type: fake
+    url: "http://example.invalid"
+    model: "fake-model"
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig error: %v", err)
+	}
+	s := NewServer(cfg, NewLogger())
+
+	body := []byte(`{"model":"claude","messages":[{"role":"user","content":"hi"}]}`)
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body))
+	s.handleMessages(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr.Body.String() != "fake:fake-model" {
+		t.Fatalf("unexpected body: %q", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", bytes.NewReader(body))
+	s.handleCountTokens(rr, req)
+	if !strings.Contains(rr.Body.String(), `"input_tokens":42`) {
+		t.Fatalf("unexpected count_tokens body: %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// ReloadConfig re-reads the config file at path and swaps it in for new
+// requests. Requests already in flight keep the snapshot they started with.
+// An invalid file is rejected and the current config stays active.
+func (s *Server) ReloadConfig(path string) error {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		s.logger.Errorf("config reload failed, keeping current config: %v", err)
+		return err
+	}
+
+	if old := s.config(); old != nil {
+		if cfg.Listen != old.Listen {
+			s.logger.Warnf("config reload: listen changed from %s to %s; restart to apply", old.Listen, cfg.Listen)
+		}
+		if cfg.AuditLog != old.AuditLog {
+			s.logger.Warnf("config reload: audit_log changed from %q to %q; restart to apply", old.AuditLog, cfg.AuditLog)
+		}
+		if cfg.Usage.File != old.Usage.File {
+			s.logger.Warnf("config reload: usage.file changed from %q to %q; restart to apply", old.Usage.File, cfg.Usage.File)
+		}
+	}
+	s.cfg.Store(cfg)
+	s.logger.Infof("config reloaded from %s (providers=%d presets=%d)", path, len(cfg.Providers), len(cfg.Presets))
+	return nil
+}
+
+// WatchConfig starts polling the config file every interval and reloads it
+// when its modification time or size changes. Polling stops when ctx is done.
+func (s *Server) WatchConfig(ctx context.Context, path string, interval time.Duration) {
+	last, _ := os.Stat(path)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+				continue
+			}
+			last = info
+			s.logger.Infof("config file %s changed, reloading", path)
+			_ = s.ReloadConfig(path)
+		}
+	}()
+}
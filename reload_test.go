@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+const reloadBaseConfig = `
+listen: ":9999"
+spoof_model: "claude-test"
+default_provider: "anthropic"
+timeout_seconds: 120
+providers:
+  anthropic:
+    type: passthrough
+    url: "https://api.anthropic.com"
+`
+
+const reloadExtendedConfig = reloadBaseConfig + `
+  openai:
+    type: openai
+    url: "https://api.openai.com/v1/chat/completions"
+    model: "gpt-5-mini"
+`
+
+func TestReloadConfig(t *testing.T) {
+	path := writeTempConfig(t, reloadBaseConfig)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig error: %v", err)
+	}
+	s := NewServer(cfg, NewLogger())
+	inFlight := s.config()
+
+	if err := os.WriteFile(path, []byte(reloadExtendedConfig), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if err := s.ReloadConfig(path); err != nil {
+		t.Fatalf("ReloadConfig error: %v", err)
+	}
+	if _, ok := s.config().Providers["openai"]; !ok {
+		t.Fatalf("reloaded config should contain the new provider")
+	}
+	if _, ok := inFlight.Providers["openai"]; ok {
+		t.Fatalf("snapshot taken before reload must not change")
+	}
+
+	if err := os.WriteFile(path, []byte("providers: ["), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if err := s.ReloadConfig(path); err == nil {
+		t.Fatalf("expected invalid config to be rejected")
+	}
+	if _, ok := s.config().Providers["openai"]; !ok {
+		t.Fatalf("invalid reload must keep the previous config")
+	}
+}
+
+func TestWatchConfig_ReloadsOnChange(t *testing.T) {
+	path := writeTempConfig(t, reloadBaseConfig)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig error: %v", err)
+	}
+	s := NewServer(cfg, NewLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.WatchConfig(ctx, path, 10*time.Millisecond)
+
+	if err := os.WriteFile(path, []byte(reloadExtendedConfig), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := s.config().Providers["openai"]; ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("config change was not picked up by the watcher")
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// runReplay implements `furiwake replay <file> --line N [--route X]`: it
+// resends the Anthropic request recorded on line N of an audit log through
+// the current config and writes the response to stdout. Without --route the
+// request goes to the provider it was recorded with.
+func runReplay(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "furiwake.yaml", "path to config yaml")
+	line := fs.Int("line", 0, "1-based line number of the audit record to replay")
+	routeName := fs.String("route", "", "send to this provider instead of the route resolved from the request")
+
+	// Accept flags before or after the file argument.
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) != 1 || *line < 1 {
+		return fmt.Errorf("usage: furiwake replay <audit.jsonl> --line N [--route NAME] [--config PATH]")
+	}
+
+	record, err := readAuditRecord(positional[0], *line)
+	if err != nil {
+		return err
+	}
+	var req AnthropicMessageRequest
+	if err := json.Unmarshal(record.Request, &req); err != nil {
+		return fmt.Errorf("line %d: invalid recorded request: %w", *line, err)
+	}
+
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("config error: %w", err)
+	}
+	// Replay must not write to the running server's debug log, append to the
+	// audit log it reads from, or add its cost to the usage file.
+	replayCfg := *cfg
+	replayCfg.AuditLog = ""
+	replayCfg.Usage.File = ""
+	cfg = &replayCfg
+	s := NewServer(cfg, NewConsoleLogger())
+
+	route, err := ResolveAll(req.System, req.Messages, cfg, NewRuleInput(req, nil))
+	if err != nil {
+		return err
+	}
+	switch {
+	case *routeName != "":
+		if route, err = ResolveFallback(*routeName, route, cfg); err != nil {
+			return err
+		}
+	case record.Route.Provider != "" && ExtractRouteName(req.System) == "" && ExtractRouteNameFromMessages(req.Messages) == "":
+		// Markers are stripped before requests are recorded, so replay on
+		// the route the request was originally served with.
+		if route, err = ResolveFallback(record.Route.Provider, route, cfg); err != nil {
+			return err
+		}
+		route.Model = record.Route.Model
+		route.ReasoningEffort = record.Route.ReasoningEffort
+		route.ServiceTier = record.Route.ServiceTier
+	}
+
+	ctx := context.Background()
+	inbound, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://furiwake/v1/messages", nil)
+	if err != nil {
+		return err
+	}
+	call, err := s.newTranslatedCall(cfg, "replay-"+record.RequestID, route, req, inbound)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stderr, "replaying line %d (req=%s) via route=%s model=%s\n", *line, logValueOrDash(record.RequestID), route.ProviderName, logValueOrDash(route.Model))
+	out := &replayWriter{header: http.Header{}, out: stdout}
+	s.serveProvider(ctx, out, call)
+	fmt.Fprintf(stderr, "\nstatus %d\n", out.status)
+	if out.status >= 400 {
+		return fmt.Errorf("replay failed with status %d", out.status)
+	}
+	return nil
+}
+
+// readAuditRecord decodes the record on the 1-based line of path.
+func readAuditRecord(path string, line int) (AuditRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return AuditRecord{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+	for n := 1; scanner.Scan(); n++ {
+		if n < line {
+			continue
+		}
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return AuditRecord{}, fmt.Errorf("line %d: %w", line, err)
+		}
+		return record, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return AuditRecord{}, err
+	}
+	return AuditRecord{}, fmt.Errorf("line %d not found in %s", line, path)
+}
+
+// replayWriter is the http.ResponseWriter for a replay; the response body
+// goes to out as it arrives.
+type replayWriter struct {
+	header http.Header
+	out    io.Writer
+	status int
+}
+
+func (w *replayWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *replayWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *replayWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.out.Write(p)
+}
+
+func (w *replayWriter) Flush() {}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts = 6
+	defaultRetryBaseDelay   = 250 * time.Millisecond
+	defaultRetryMaxDelay    = 10 * time.Second
+	defaultRetryJitter      = 0.2
+	defaultRetryDeadline    = 2 * time.Minute
+)
+
+// defaultRetryStatuses are retried when a provider's retry.statuses is empty:
+// rate limits, gateway errors and Anthropic's 529 overloaded.
+var defaultRetryStatuses = []int{429, 500, 502, 503, 504, 529}
+
+// retrySleep waits d or until ctx is done. Tests replace it.
+var retrySleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryRand returns a number in [0, 1) for jitter. Tests replace it.
+var retryRand = rand.Float64
+
+// normalizeRetry validates the retry policy of the provider at field.
+func normalizeRetry(field string, r RetryConfig) error {
+	switch {
+	case r.MaxAttempts < 0:
+		return fmt.Errorf("%s.retry.max_attempts must be >= 0", field)
+	case r.BaseDelayMS < 0 || r.MaxDelayMS < 0:
+		return fmt.Errorf("%s.retry delays must be >= 0", field)
+	case r.BaseDelayMS > 0 && r.MaxDelayMS > 0 && r.BaseDelayMS > r.MaxDelayMS:
+		return fmt.Errorf("%s.retry.base_delay_ms must not exceed max_delay_ms", field)
+	case r.Jitter != nil && (*r.Jitter < 0 || *r.Jitter > 1):
+		return fmt.Errorf("%s.retry.jitter must be between 0 and 1", field)
+	case r.DeadlineSeconds < 0:
+		return fmt.Errorf("%s.retry.deadline_seconds must be >= 0", field)
+	}
+	for _, status := range r.Statuses {
+		if status < 400 || status > 599 {
+			return fmt.Errorf("%s.retry.statuses: %d is not an HTTP error status", field, status)
+		}
+	}
+	return nil
+}
+
+func (r RetryConfig) maxAttempts() int {
+	if r.MaxAttempts > 0 {
+		return r.MaxAttempts
+	}
+	return defaultRetryMaxAttempts
+}
+
+func (r RetryConfig) retries(status int) bool {
+	statuses := r.Statuses
+	if len(statuses) == 0 {
+		statuses = defaultRetryStatuses
+	}
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (r RetryConfig) deadline() time.Duration {
+	if r.DeadlineSeconds > 0 {
+		return time.Duration(r.DeadlineSeconds) * time.Second
+	}
+	return defaultRetryDeadline
+}
+
+// backoff is the exponential delay before retry number attempt+1, capped at
+// max_delay_ms and spread by the jitter fraction in both directions.
+func (r RetryConfig) backoff(attempt int) time.Duration {
+	base, max := defaultRetryBaseDelay, defaultRetryMaxDelay
+	if r.BaseDelayMS > 0 {
+		base = time.Duration(r.BaseDelayMS) * time.Millisecond
+	}
+	if r.MaxDelayMS > 0 {
+		max = time.Duration(r.MaxDelayMS) * time.Millisecond
+	}
+	d := max
+	if attempt < 30 && base<<attempt < max {
+		d = base << attempt
+	}
+	jitter := defaultRetryJitter
+	if r.Jitter != nil {
+		jitter = *r.Jitter
+	}
+	if jitter > 0 {
+		d = time.Duration(float64(d) * (1 - jitter + 2*jitter*retryRand()))
+	}
+	return d
+}
+
+// retryAfter reads the delay an upstream asked for in Retry-After,
+// retry-after-ms or, for exhausted limits, x-ratelimit-reset-requests and
+// x-ratelimit-reset-tokens. It reports false when the policy ignores those
+// headers or none are present.
+func (r RetryConfig) retryAfter(resp *http.Response) (time.Duration, bool) {
+	if r.RetryAfter != nil && !*r.RetryAfter {
+		return 0, false
+	}
+	h := resp.Header
+	if v := strings.TrimSpace(h.Get("retry-after-ms")); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms >= 0 {
+			return time.Duration(ms * float64(time.Millisecond)), true
+		}
+	}
+	if v := strings.TrimSpace(h.Get("Retry-After")); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			d := time.Until(at)
+			if d < 0 {
+				d = 0
+			}
+			return d, true
+		}
+	}
+
+	var wait time.Duration
+	found := false
+	for _, limit := range []string{"requests", "tokens"} {
+		if remaining := h.Get("x-ratelimit-remaining-" + limit); remaining != "" && remaining != "0" {
+			continue
+		}
+		d, ok := parseRateLimitReset(h.Get("x-ratelimit-reset-" + limit))
+		if ok && (!found || d > wait) {
+			wait, found = d, true
+		}
+	}
+	return wait, found
+}
+
+// parseRateLimitReset accepts the reset formats OpenAI-style APIs send:
+// Go-style durations ("1s", "6m0s", "20ms") or plain seconds.
+func parseRateLimitReset(v string) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return d, true
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	return 0, false
+}
+
+// sendWithRetry sends the request built by newRequest through the provider's
+// circuit breaker and retry policy. A provider whose circuit is open is not
+// contacted; the circuitOpenError lets the route fall back at once.
+func (s *Server) sendWithRetry(ctx context.Context, provider ProviderConfig, routeName, modelName string, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	if routeName == "-" {
+		return s.sendAttempts(ctx, provider, routeName, modelName, newRequest)
+	}
+	if err := s.health.allow(routeName, provider.Circuit); err != nil {
+		return nil, err
+	}
+	resp, err := s.sendAttempts(ctx, provider, routeName, modelName, newRequest)
+	s.recordHealth(ctx, routeName, provider.Circuit, resp, err)
+	return resp, err
+}
+
+// recordHealth feeds the final outcome of a request to the circuit breaker.
+// Transport errors, 429, 5xx and usage limits count as failures; requests the
+// client abandoned count as neither.
+func (s *Server) recordHealth(ctx context.Context, routeName string, circuit CircuitConfig, resp *http.Response, err error) {
+	if ctx.Err() != nil {
+		s.health.release(routeName)
+		return
+	}
+	var failure error
+	switch {
+	case err != nil:
+		failure = err
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 || isUsageLimitResponse(resp):
+		failure = fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
+	if s.health.record(routeName, circuit, failure) {
+		s.logger.Warnf("route=%s circuit opened for %s after: %v", routeName, circuit.cooldown(), failure)
+	}
+}
+
+// sendAttempts retries transport errors and retryable statuses under the
+// provider's retry policy. A retry whose delay would end past the policy
+// deadline, or after another request opened the circuit, is not attempted:
+// the last upstream response is returned instead so the client sees the real
+// error.
+func (s *Server) sendAttempts(ctx context.Context, provider ProviderConfig, routeName, modelName string, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	policy := provider.Retry
+	maxAttempts := policy.maxAttempts()
+	deadline := time.Now().Add(policy.deadline())
+
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		last := attempt == maxAttempts-1
+		attemptCtx, watchdog := startUpstreamAttempt(ctx, provider.Timeouts)
+		resp, err := s.client.Do(req.WithContext(attemptCtx))
+		if err != nil {
+			watchdog.stop()
+			if timeout := watchdog.err(); timeout != nil && ctx.Err() == nil {
+				err = timeout
+			}
+		} else {
+			watchdog.watch(resp)
+		}
+		var delay time.Duration
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil || last {
+				return nil, err
+			}
+			lastErr = err
+			delay = policy.backoff(attempt)
+			if time.Now().Add(delay).After(deadline) || s.health.isOpen(routeName) {
+				return nil, err
+			}
+		} else {
+			if last || !policy.retries(resp.StatusCode) || isUsageLimitResponse(resp) {
+				return resp, nil
+			}
+			delay = policy.backoff(attempt)
+			if wait, ok := policy.retryAfter(resp); ok {
+				delay = wait
+			}
+			if time.Now().Add(delay).After(deadline) || s.health.isOpen(routeName) {
+				return resp, nil
+			}
+			lastErr = fmt.Errorf("upstream returned status %d", resp.StatusCode)
+			closeResponseBody(resp)
+		}
+
+		s.logger.Debugf("req=%s route=%s retrying in %s after %v", logValueOrDash(req.Header.Get("x-request-id")), routeName, delay.Round(time.Millisecond), lastErr)
+		s.metrics.addRetry(routeName, provider.Type, modelName)
+		countRetry(ctx)
+		if err := retrySleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+	return nil, lastErr
+}
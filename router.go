@@ -219,20 +219,27 @@ type RouteResolution struct {
 	ReasoningEffort string
 	ServiceTier     string
 	PresetName      string
+	// Rule is the name of the routing rule that selected this route, if any.
+	Rule string
+	// Split names the weighted split that chose this route and Arm the
+	// selected provider/model, when a split applied.
+	Split string
+	Arm   string
+	// Fallback lists the providers tried, in order, when this route fails
+	// before any response bytes reach the client.
+	Fallback []string
 }
 
 // ResolveAll performs consolidated resolution of all routing parameters,
-// including preset support.
-func ResolveAll(system interface{}, messages []AnthropicMessage, cfg *Config) (*RouteResolution, error) {
+// including preset support. When in is non-nil, config rules are evaluated
+// for requests that carry no @route or preset marker.
+func ResolveAll(system interface{}, messages []AnthropicMessage, cfg *Config, in *RuleInput) (*RouteResolution, error) {
 	if cfg == nil {
 		return nil, fmt.Errorf("config is nil")
 	}
 
 	// 1. Get list of preset names
-	presetNames := make([]string, 0, len(cfg.Presets))
-	for name := range cfg.Presets {
-		presetNames = append(presetNames, name)
-	}
+	presetNames := configPresetNames(cfg)
 
 	// 2. Check for preset marker
 	presetName := ExtractPresetName(system, presetNames)
@@ -249,11 +256,24 @@ func ResolveAll(system interface{}, messages []AnthropicMessage, cfg *Config) (*
 		}
 	}
 
-	// 3. Resolve provider: explicit @route: > preset's provider > config default_provider
+	// 3. Resolve provider: explicit @route: > preset's provider > matching
+	// rule (and its preset) > config default_provider
 	routeName := ExtractRouteName(system)
 	if routeName == "" {
 		routeName = ExtractRouteNameFromMessages(messages)
 	}
+	explicitRoute := routeName != ""
+	var rule *RuleConfig
+	if routeName == "" && presetName == "" && in != nil {
+		rule = matchRule(cfg, system, messages, in)
+	}
+	if rule != nil && rule.Preset != "" {
+		presetName = rule.Preset
+		preset, hasPreset = cfg.Presets[presetName]
+	}
+	if routeName == "" && rule != nil && rule.Provider != "" {
+		routeName = rule.Provider
+	}
 	if routeName == "" && hasPreset && preset.Provider != "" {
 		routeName = preset.Provider
 	}
@@ -261,15 +281,46 @@ func ResolveAll(system interface{}, messages []AnthropicMessage, cfg *Config) (*
 		routeName = cfg.DefaultProvider
 	}
 
+	model := ExtractModelName(system)
+	if model == "" {
+		model = ExtractModelNameFromMessages(messages)
+	}
+
+	// 3b. Weighted split: the preset's split unless @route chose the provider,
+	// otherwise the routed provider's own. An explicit @model pins the model
+	// and skips splitting.
+	var splitName string
+	var arm *SplitTarget
+	if model == "" {
+		splitName = routeName
+		targets := cfg.Providers[routeName].Split
+		if hasPreset && !explicitRoute && len(preset.Split) > 0 {
+			splitName, targets = "@"+presetName, preset.Split
+		}
+		if len(targets) > 0 && in != nil {
+			targets = allowedSplitTargets(cfg, in.Client, targets)
+		}
+		if len(targets) > 0 {
+			arm = pickSplitArm(targets, splitName, splitKey(messages, in))
+			routeName = arm.Provider
+		}
+	}
+
 	provider, ok := cfg.Providers[routeName]
 	if !ok {
 		return nil, fmt.Errorf("route provider %q not found", routeName)
 	}
 
-	// 4. Resolve model: explicit @model: > preset's model > provider's default model
-	model := ExtractModelName(system)
-	if model == "" {
-		model = ExtractModelNameFromMessages(messages)
+	// 4. Resolve model: explicit @model: > split arm's model > rule's model >
+	// preset's model > provider's default model
+	if model == "" && arm != nil {
+		model = arm.Model
+		if model == "" {
+			model = provider.Model
+		}
+	}
+	if model == "" && rule != nil && rule.Model != "" {
+		model = rule.Model
 	}
 	if model == "" && hasPreset && preset.Model != "" {
 		model = preset.Model
@@ -278,9 +329,10 @@ func ResolveAll(system interface{}, messages []AnthropicMessage, cfg *Config) (*
 		model = provider.Model
 	}
 
-	// 5. Resolve reasoning effort (only for chatgpt type)
+	// 5. Resolve reasoning effort (only for providers that support it)
+	supportsReasoning := ProviderSupportsReasoning(provider.Type)
 	reasoningEffort := ""
-	if provider.Type == ProviderTypeChatGPT {
+	if supportsReasoning {
 		markerEffort := ExtractReasoningEffort(system)
 		if markerEffort == "" {
 			markerEffort = ExtractReasoningEffortFromMessages(messages)
@@ -307,7 +359,7 @@ func ResolveAll(system interface{}, messages []AnthropicMessage, cfg *Config) (*
 	}
 
 	serviceTier := ""
-	if provider.Type == ProviderTypeChatGPT {
+	if supportsReasoning {
 		markerTier := ExtractServiceTier(system)
 		if markerTier == "" {
 			markerTier = ExtractServiceTierFromMessages(messages)
@@ -333,12 +385,61 @@ func ResolveAll(system interface{}, messages []AnthropicMessage, cfg *Config) (*
 		}
 	}
 
-	return &RouteResolution{
+	// 6. Resolve fallback chain: preset's fallback > provider's fallback
+	fallback := provider.Fallback
+	if hasPreset && len(preset.Fallback) > 0 {
+		fallback = preset.Fallback
+	}
+
+	resolved := &RouteResolution{
 		ProviderName:    routeName,
 		Provider:        provider,
 		Model:           model,
 		ReasoningEffort: reasoningEffort,
 		ServiceTier:     serviceTier,
 		PresetName:      presetName,
-	}, nil
+		Fallback:        fallback,
+	}
+	if rule != nil {
+		resolved.Rule = rule.Name
+	}
+	if arm != nil {
+		resolved.Split = splitName
+		resolved.Arm = routeName + "/" + logValueOrDash(model)
+	}
+	return resolved, nil
+}
+
+// ResolveFallback builds the resolution used when primary fails over to the
+// provider named name. The fallback provider's own default model is used since
+// an @model marker targets the primary provider; reasoning effort and service
+// tier carry over when both providers support them.
+func ResolveFallback(name string, primary *RouteResolution, cfg *Config) (*RouteResolution, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("config is nil")
+	}
+	provider, ok := cfg.Providers[name]
+	if !ok {
+		return nil, fmt.Errorf("fallback provider %q not found", name)
+	}
+
+	out := &RouteResolution{
+		ProviderName: name,
+		Provider:     provider,
+		Model:        provider.Model,
+		PresetName:   primary.PresetName,
+	}
+	if ProviderSupportsReasoning(provider.Type) {
+		out.ReasoningEffort = NormalizeReasoningEffort(provider.ReasoningEffort)
+		out.ServiceTier = NormalizeServiceTier(provider.ServiceTier)
+		if ProviderSupportsReasoning(primary.Provider.Type) {
+			if primary.ReasoningEffort != "" {
+				out.ReasoningEffort = primary.ReasoningEffort
+			}
+			if primary.ServiceTier != "" {
+				out.ServiceTier = primary.ServiceTier
+			}
+		}
+	}
+	return out, nil
 }
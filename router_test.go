@@ -319,7 +319,7 @@ func TestExtractPresetName(t *testing.T) {
 
 func TestResolveAll_WithPreset(t *testing.T) {
 	cfg := testConfig()
-	resolved, err := ResolveAll("<!-- @fast -->", nil, cfg)
+	resolved, err := ResolveAll("<!-- @fast -->", nil, cfg, nil)
 	if err != nil {
 		t.Fatalf("ResolveAll error: %v", err)
 	}
@@ -339,7 +339,7 @@ func TestResolveAll_WithPreset(t *testing.T) {
 
 func TestResolveAll_PresetOverriddenByExplicitMarkers(t *testing.T) {
 	cfg := testConfig()
-	resolved, err := ResolveAll("<!-- @fast @route:openai @model:gpt-4.1 -->", nil, cfg)
+	resolved, err := ResolveAll("<!-- @fast @route:openai @model:gpt-4.1 -->", nil, cfg, nil)
 	if err != nil {
 		t.Fatalf("ResolveAll error: %v", err)
 	}
@@ -357,7 +357,7 @@ func TestResolveAll_PresetOverriddenByExplicitMarkers(t *testing.T) {
 
 func TestResolveAll_NoPreset(t *testing.T) {
 	cfg := testConfig()
-	resolved, err := ResolveAll("@route:codex", nil, cfg)
+	resolved, err := ResolveAll("@route:codex", nil, cfg, nil)
 	if err != nil {
 		t.Fatalf("ResolveAll error: %v", err)
 	}
@@ -371,3 +371,49 @@ func TestResolveAll_NoPreset(t *testing.T) {
 		t.Fatalf("expected empty reasoning, got %s", resolved.ReasoningEffort)
 	}
 }
+
+func TestResolveAll_FallbackPresetOverridesProvider(t *testing.T) {
+	cfg := testConfig()
+	codex := cfg.Providers["codex"]
+	codex.Fallback = []string{"openai"}
+	cfg.Providers["codex"] = codex
+	fast := cfg.Presets["fast"]
+	fast.Fallback = []string{"anthropic"}
+	cfg.Presets["fast"] = fast
+
+	resolved, err := ResolveAll("@route:codex", nil, cfg, nil)
+	if err != nil {
+		t.Fatalf("ResolveAll error: %v", err)
+	}
+	if len(resolved.Fallback) != 1 || resolved.Fallback[0] != "openai" {
+		t.Fatalf("expected provider fallback, got %v", resolved.Fallback)
+	}
+
+	resolved, err = ResolveAll("<!-- @fast -->", nil, cfg, nil)
+	if err != nil {
+		t.Fatalf("ResolveAll error: %v", err)
+	}
+	if len(resolved.Fallback) != 1 || resolved.Fallback[0] != "anthropic" {
+		t.Fatalf("expected preset fallback, got %v", resolved.Fallback)
+	}
+}
+
+func TestResolveFallback(t *testing.T) {
+	cfg := testConfig()
+	primary, err := ResolveAll("<!-- @fast -->", nil, cfg, nil)
+	if err != nil {
+		t.Fatalf("ResolveAll error: %v", err)
+	}
+
+	got, err := ResolveFallback("openai", primary, cfg)
+	if err != nil {
+		t.Fatalf("ResolveFallback error: %v", err)
+	}
+	if got.Model != "gpt-5-mini" || got.ReasoningEffort != "" || got.ServiceTier != "" {
+		t.Fatalf("unexpected openai fallback: %+v", got)
+	}
+
+	if _, err := ResolveFallback("missing", primary, cfg); err == nil {
+		t.Fatal("expected error for unknown fallback provider")
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RuleInput carries the request attributes, beyond the prompt, that routing
+// rules and traffic splits use.
+type RuleInput struct {
+	Model      string
+	Tools      []AnthropicTool
+	Header     http.Header
+	RemoteAddr string
+	// UserID is metadata.user_id, which keys sticky split selection.
+	UserID string
+	// Client is the authenticated client; split arms it may not use are
+	// never picked.
+	Client string
+}
+
+// NewRuleInput collects the rule attributes of req; r may be nil when there is
+// no inbound HTTP request (e.g. replay).
+func NewRuleInput(req AnthropicMessageRequest, r *http.Request) *RuleInput {
+	in := &RuleInput{Model: req.Model, Tools: req.Tools}
+	if req.Metadata != nil {
+		in.UserID = req.Metadata.UserID
+	}
+	if r != nil {
+		in.Header = r.Header
+		in.RemoteAddr = r.RemoteAddr
+		in.Client = requestClient(r)
+	}
+	return in
+}
+
+// compiledRule holds the parsed form of a rule's match conditions.
+type compiledRule struct {
+	model   *regexp.Regexp
+	system  *regexp.Regexp
+	headers map[string]*regexp.Regexp
+	sources []*net.IPNet
+}
+
+// compileRules validates cfg.Rules and prepares them for matching.
+func compileRules(cfg *Config) error {
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		field := fmt.Sprintf("rules[%d]", i)
+		if rule.Name != "" {
+			field = fmt.Sprintf("rules[%d] (%s)", i, rule.Name)
+		} else {
+			rule.Name = fmt.Sprintf("#%d", i+1)
+		}
+
+		if rule.Provider == "" && rule.Model == "" && rule.Preset == "" {
+			return fmt.Errorf("%s must set provider, model or preset", field)
+		}
+		if rule.Provider != "" {
+			if _, ok := cfg.Providers[rule.Provider]; !ok {
+				return fmt.Errorf("%s.provider %q is not defined in providers", field, rule.Provider)
+			}
+		}
+		if rule.Preset != "" {
+			if _, ok := cfg.Presets[rule.Preset]; !ok {
+				return fmt.Errorf("%s.preset %q is not defined in presets", field, rule.Preset)
+			}
+		}
+
+		compiled, err := rule.compile()
+		if err != nil {
+			return fmt.Errorf("%s.match: %w", field, err)
+		}
+		rule.compiled = compiled
+	}
+	return nil
+}
+
+func (r *RuleConfig) compile() (*compiledRule, error) {
+	c := &compiledRule{}
+	if r.Match.Model != "" {
+		c.model = globPattern(r.Match.Model)
+	}
+	if r.Match.System != "" {
+		system, err := regexp.Compile(r.Match.System)
+		if err != nil {
+			return nil, fmt.Errorf("invalid system regex: %w", err)
+		}
+		c.system = system
+	}
+	if len(r.Match.Headers) > 0 {
+		c.headers = make(map[string]*regexp.Regexp, len(r.Match.Headers))
+		for name, value := range r.Match.Headers {
+			c.headers[http.CanonicalHeaderKey(name)] = globPattern(value)
+		}
+	}
+	for _, source := range r.Match.Source {
+		source = strings.TrimSpace(source)
+		if !strings.Contains(source, "/") {
+			ip := net.ParseIP(source)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid source address %q", source)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			c.sources = append(c.sources, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source range %q", source)
+		}
+		c.sources = append(c.sources, network)
+	}
+	return c, nil
+}
+
+// globPattern turns a case-insensitive glob with * and ? into an anchored
+// regular expression.
+func globPattern(glob string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(glob)
+	quoted = strings.ReplaceAll(quoted, `\*`, `.*`)
+	quoted = strings.ReplaceAll(quoted, `\?`, `.`)
+	return regexp.MustCompile(`(?is)^` + quoted + `$`)
+}
+
+// matchRule returns the first rule whose conditions all hold, or nil.
+func matchRule(cfg *Config, system interface{}, messages []AnthropicMessage, in *RuleInput) *RuleConfig {
+	inputTokens := -1
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		c := rule.compiled
+		if c == nil {
+			compiled, err := rule.compile()
+			if err != nil {
+				continue
+			}
+			c = compiled
+		}
+
+		if c.model != nil && !c.model.MatchString(in.Model) {
+			continue
+		}
+		if c.system != nil && !c.system.MatchString(NormalizeSystemText(system)) {
+			continue
+		}
+		if !hasAllTools(in.Tools, rule.Match.Tools) {
+			continue
+		}
+		if rule.Match.MinInputTokens > 0 || rule.Match.MaxInputTokens > 0 {
+			if inputTokens < 0 {
+				inputTokens = estimateInputTokens(system, messages)
+			}
+			if rule.Match.MinInputTokens > 0 && inputTokens < rule.Match.MinInputTokens {
+				continue
+			}
+			if rule.Match.MaxInputTokens > 0 && inputTokens > rule.Match.MaxInputTokens {
+				continue
+			}
+		}
+		if !headersMatch(in.Header, c.headers) {
+			continue
+		}
+		if len(c.sources) > 0 && !sourceMatches(in.RemoteAddr, c.sources) {
+			continue
+		}
+		return rule
+	}
+	return nil
+}
+
+func hasAllTools(tools []AnthropicTool, names []string) bool {
+	for _, name := range names {
+		found := false
+		for _, tool := range tools {
+			if tool.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func headersMatch(header http.Header, patterns map[string]*regexp.Regexp) bool {
+	for name, pattern := range patterns {
+		if header == nil || !pattern.MatchString(header.Get(name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func sourceMatches(remoteAddr string, networks []*net.IPNet) bool {
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
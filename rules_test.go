@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const rulesConfig = `
+listen: ":0"
+spoof_model: "claude-test"
+default_provider: "anthropic"
+timeout_seconds: 30
+providers:
+  anthropic:
+    type: passthrough
+    url: "https://api.anthropic.com"
+  openai:
+    type: openai
+    url: "https://api.openai.com/v1/chat/completions"
+    model: "gpt-5-mini"
+  codex:
+    type: chatgpt
+    url: "https://chatgpt.com/backend-api/codex/responses"
+    model: "gpt-5.3-codex"
+    auth:
+      type: codex
+presets:
+  deep:
+    provider: codex
+    reasoning_effort: high
+rules:
+  - name: cheap-haiku
+    match:
+      model: "*haiku*"
+    provider: openai
+  - name: infra-team
+    match:
+      headers:
+        x-team: "infra"
+      source: ["10.0.0.0/8", "127.0.0.1"]
+    preset: deep
+  - name: big-reviews
+    match:
+      system: "(?i)code reviewer"
+      tools: ["Read", "Grep"]
+      min_input_tokens: 10
+    provider: codex
+    model: "gpt-5.4"
+`
+
+func TestResolveAll_Rules(t *testing.T) {
+	cfg, err := LoadConfig(writeTempConfig(t, rulesConfig))
+	if err != nil {
+		t.Fatalf("LoadConfig error: %v", err)
+	}
+	user := []AnthropicMessage{{Role: "user", Content: strings.Repeat("review this diff ", 10)}}
+
+	resolved, err := ResolveAll("", user, cfg, &RuleInput{Model: "claude-haiku-4-5"})
+	if err != nil || resolved.ProviderName != "openai" || resolved.Model != "gpt-5-mini" || resolved.Rule != "cheap-haiku" {
+		t.Fatalf("expected cheap-haiku rule, got %+v err=%v", resolved, err)
+	}
+
+	header := http.Header{}
+	header.Set("X-Team", "INFRA")
+	resolved, err = ResolveAll("", user, cfg, &RuleInput{Model: "claude-sonnet-4-6", Header: header, RemoteAddr: "10.1.2.3:5555"})
+	if err != nil || resolved.ProviderName != "codex" || resolved.PresetName != "deep" || resolved.ReasoningEffort != "high" {
+		t.Fatalf("expected infra-team preset, got %+v err=%v", resolved, err)
+	}
+	resolved, _ = ResolveAll("", user, cfg, &RuleInput{Model: "claude-sonnet-4-6", Header: header, RemoteAddr: "192.168.1.2:5555"})
+	if resolved.ProviderName != "anthropic" {
+		t.Fatalf("source outside the rule must not match, got %s", resolved.ProviderName)
+	}
+
+	tools := []AnthropicTool{{Name: "Read"}, {Name: "Grep"}, {Name: "Bash"}}
+	resolved, _ = ResolveAll("You are a Code Reviewer.", user, cfg, &RuleInput{Model: "claude-sonnet-4-6", Tools: tools})
+	if resolved.ProviderName != "codex" || resolved.Model != "gpt-5.4" || resolved.Rule != "big-reviews" {
+		t.Fatalf("expected big-reviews rule, got %+v", resolved)
+	}
+	resolved, _ = ResolveAll("You are a Code Reviewer.", user, cfg, &RuleInput{Model: "claude-sonnet-4-6", Tools: tools[:1]})
+	if resolved.ProviderName != "anthropic" {
+		t.Fatalf("missing tool must not match, got %s", resolved.ProviderName)
+	}
+
+	// Explicit markers win over rules.
+	resolved, _ = ResolveAll("<!-- @route:anthropic @model:claude-haiku-4-5 -->", user, cfg, &RuleInput{Model: "claude-haiku-4-5"})
+	if resolved.ProviderName != "anthropic" || resolved.Rule != "" {
+		t.Fatalf("marker should win over rules, got %+v", resolved)
+	}
+	resolved, _ = ResolveAll("@model:gpt-4.1", user, cfg, &RuleInput{Model: "claude-haiku-4-5"})
+	if resolved.ProviderName != "openai" || resolved.Model != "gpt-4.1" {
+		t.Fatalf("@model marker should override the rule's model, got %+v", resolved)
+	}
+}
+
+func TestLoadConfig_InvalidRules(t *testing.T) {
+	cases := map[string]string{
+		"unknown provider": "rules:\n  - provider: nope\n",
+		"no target":        "rules:\n  - match:\n      model: \"*\"\n",
+		"bad regex":        "rules:\n  - provider: openai\n    match:\n      system: \"(\"\n",
+		"bad source":       "rules:\n  - provider: openai\n    match:\n      source: [\"10.0.0.0/99\"]\n",
+	}
+	for name, rules := range cases {
+		if _, err := LoadConfig(writeTempConfig(t, strings.SplitN(rulesConfig, "rules:", 2)[0]+rules)); err == nil {
+			t.Fatalf("%s: expected LoadConfig to fail", name)
+		}
+	}
+}
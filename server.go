@@ -9,28 +9,59 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 )
 
 type Server struct {
-	cfg        *Config
+	// cfg is swapped atomically on reload; each request works on the
+	// snapshot taken when it arrived.
+	cfg        atomic.Pointer[Config]
 	logger     *Logger
 	client     *http.Client
+	metrics    *Metrics
+	health     *healthTracker
+	limits     *providerLimits
+	audit      *AuditLog
+	usage      *UsageStore
 	httpServer *http.Server
 }
 
 func NewServer(cfg *Config, logger *Logger) *Server {
+	metrics := NewMetrics()
 	s := &Server{
-		cfg:    cfg,
-		logger: logger,
-		client: &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second},
+		logger:  logger,
+		client:  &http.Client{},
+		metrics: metrics,
+		health:  newHealthTracker(),
+		limits:  newProviderLimits(metrics),
 	}
+	s.cfg.Store(cfg)
+	if cfg.AuditLog != "" {
+		audit, err := OpenAuditLog(cfg.AuditLog)
+		if err != nil {
+			logger.Errorf("audit log disabled: %v", err)
+		} else {
+			s.audit = audit
+		}
+	}
+	usage, err := OpenUsageStore(cfg.Usage.File)
+	if err != nil {
+		logger.Errorf("usage file not loaded, starting from zero: %v", err)
+		usage, _ = OpenUsageStore("")
+	}
+	usage.errorf = logger.Errorf
+	s.usage = usage
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", s.handleHealth)
-	mux.HandleFunc("/v1/messages", s.handleMessages)
-	mux.HandleFunc("/v1/messages/count_tokens", s.handleCountTokens)
+	mux.HandleFunc("/metrics", s.requireClient(s.handleMetrics, writeJSONError))
+	mux.HandleFunc("/status", s.requireClient(s.handleStatus, writeJSONError))
+	mux.HandleFunc("/v1/messages", s.requireClient(s.handleMessages, writeJSONError))
+	mux.HandleFunc("/v1/messages/count_tokens", s.requireClient(s.handleCountTokens, writeJSONError))
+	mux.HandleFunc("/v1/chat/completions", s.requireClient(s.handleChatCompletions, writeOpenAIStatusError))
+	mux.HandleFunc("/v1/responses", s.requireClient(s.handleResponses, writeOpenAIStatusError))
 
 	s.httpServer = &http.Server{
 		Addr:    cfg.Listen,
@@ -39,12 +70,23 @@ func NewServer(cfg *Config, logger *Logger) *Server {
 	return s
 }
 
+// config returns the active configuration.
+func (s *Server) config() *Config {
+	return s.cfg.Load()
+}
+
 func (s *Server) ListenAndServe() error {
 	return s.httpServer.ListenAndServe()
 }
 
+// Shutdown stops accepting requests, waits for in-flight ones and saves the
+// usage totals they added.
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.httpServer.Shutdown(ctx)
+	err := s.httpServer.Shutdown(ctx)
+	if flushErr := s.usage.Flush(); flushErr != nil {
+		s.logger.Errorf("usage file write failed: %v", flushErr)
+	}
+	return err
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -77,42 +119,37 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resolved, err := ResolveAll(anthropicReq.System, anthropicReq.Messages, s.cfg)
+	cfg := s.config()
+	resolved, err := ResolveAll(anthropicReq.System, anthropicReq.Messages, cfg, NewRuleInput(anthropicReq, r))
 	if err != nil {
 		writeJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-
-	reasoningForLog := "-"
-	if resolved.ReasoningEffort != "" {
-		reasoningForLog = resolved.ReasoningEffort
-	}
-	presetForLog := "-"
-	if resolved.PresetName != "" {
-		presetForLog = resolved.PresetName
-	}
-	tierForLog := "-"
-	if resolved.ServiceTier != "" {
-		tierForLog = resolved.ServiceTier
-	}
-	requestID := strings.TrimSpace(r.Header.Get("x-request-id"))
-	if requestID == "" {
-		requestID = fmt.Sprintf("req_%d", time.Now().UnixNano())
+	if err := authorizeRoute(cfg, r, resolved); err != nil {
+		writeJSONError(w, http.StatusForbidden, err.Error())
+		return
 	}
-	r.Header.Set("x-request-id", requestID)
-	s.logger.Infof("req=%s preset=%s route=%s type=%s model=%s reasoning=%s tier=%s stream=%t", requestID, presetForLog, resolved.ProviderName, resolved.Provider.Type, resolved.Model, reasoningForLog, tierForLog, anthropicReq.Stream)
-
-	ctx := r.Context()
-	switch resolved.Provider.Type {
-	case ProviderTypePassthrough:
-		s.proxyPassthrough(ctx, w, r, resolved.ProviderName, resolved.Model, "-", resolved.Provider, body)
-	case ProviderTypeOpenAI:
-		s.proxyOpenAI(ctx, w, resolved.ProviderName, resolved.Provider, resolved.Model, "-", anthropicReq, r.Header)
-	case ProviderTypeChatGPT:
-		s.proxyChatGPT(ctx, w, resolved.ProviderName, resolved.Provider, resolved.Model, resolved.ReasoningEffort, resolved.ServiceTier, anthropicReq, r.Header)
-	default:
-		writeJSONError(w, http.StatusBadGateway, "unsupported provider type")
+
+	requestID := inboundRequestID(r)
+	s.logResolvedRoute(r, requestID, resolved, anthropicReq.Stream)
+
+	if cfg.StripMarkersEnabled() {
+		body, _, err = StripRoutingMarkers(&anthropicReq, body, configPresetNames(cfg))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 	}
+
+	s.serveProvider(r.Context(), w, &ProviderCall{
+		Server:    s,
+		Config:    cfg,
+		RequestID: requestID,
+		Route:     resolved,
+		Request:   anthropicReq,
+		Body:      body,
+		Inbound:   r,
+	})
 }
 
 func (s *Server) handleCountTokens(w http.ResponseWriter, r *http.Request) {
@@ -127,25 +164,80 @@ func (s *Server) handleCountTokens(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req CountTokensRequest
-	if err := json.Unmarshal(body, &req); err != nil {
+	var countReq CountTokensRequest
+	if err := json.Unmarshal(body, &countReq); err != nil {
 		writeJSONError(w, http.StatusBadRequest, "invalid JSON")
 		return
 	}
+	req := AnthropicMessageRequest{
+		Model:    countReq.Model,
+		System:   countReq.System,
+		Messages: countReq.Messages,
+		Tools:    countReq.Tools,
+	}
 
-	providerName, provider, err := ResolveProvider(req.System, nil, s.cfg)
+	// Count against the route the same request would take on /v1/messages,
+	// so markers, presets and rules pick the provider and model.
+	cfg := s.config()
+	resolved, err := ResolveAll(req.System, req.Messages, cfg, NewRuleInput(req, r))
 	if err != nil {
 		writeJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	if provider.Type == ProviderTypePassthrough {
-		s.logger.Debugf("req=%s count_tokens passthrough route=%s", r.Header.Get("x-request-id"), providerName)
-		s.proxyPassthrough(r.Context(), w, r, providerName, "-", "-", provider, body)
+	if err := authorizeRoute(cfg, r, resolved); err != nil {
+		writeJSONError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	p, ok := LookupProvider(resolved.Provider.Type)
+	if !ok {
+		writeJSONError(w, http.StatusBadGateway, "unsupported provider type")
 		return
 	}
+	if cfg.StripMarkersEnabled() {
+		body, _, err = StripRoutingMarkers(&req, body, configPresetNames(cfg))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	p.CountTokens(r.Context(), w, &ProviderCall{
+		Server:    s,
+		Config:    cfg,
+		RequestID: r.Header.Get("x-request-id"),
+		Route:     resolved,
+		Request:   req,
+		Body:      body,
+		Inbound:   r,
+	})
+}
+
+// inboundRequestID returns the client's x-request-id, assigning one when the
+// client did not send it.
+func inboundRequestID(r *http.Request) string {
+	requestID := strings.TrimSpace(r.Header.Get("x-request-id"))
+	if requestID == "" {
+		requestID = fmt.Sprintf("req_%d", time.Now().UnixNano())
+	}
+	r.Header.Set("x-request-id", requestID)
+	return requestID
+}
 
-	tokens := estimateInputTokens(req.System, req.Messages)
-	writeJSON(w, http.StatusOK, CountTokensResponse{InputTokens: tokens})
+// logResolvedRoute logs the route a request was resolved to, with the client
+// that sent it, and counts the split arm, if a traffic split chose it.
+func (s *Server) logResolvedRoute(r *http.Request, requestID string, resolved *RouteResolution, stream bool) {
+	if resolved.Rule != "" {
+		s.logger.Debugf("req=%s matched rule %s", requestID, resolved.Rule)
+	}
+	if resolved.Split != "" {
+		s.logger.Infof("req=%s split=%s arm=%s", requestID, resolved.Split, resolved.Arm)
+		s.metrics.addSplitArm(resolved.Split, resolved.Arm)
+	}
+	client := ""
+	if name := requestClient(r); name != "" {
+		client = " client=" + name
+	}
+	s.logger.Infof("req=%s%s preset=%s route=%s type=%s model=%s reasoning=%s tier=%s stream=%t", requestID, client, logValueOrDash(resolved.PresetName), resolved.ProviderName, resolved.Provider.Type, resolved.Model, logValueOrDash(resolved.ReasoningEffort), logValueOrDash(resolved.ServiceTier), stream)
 }
 
 func writeJSON(w http.ResponseWriter, status int, v interface{}) {
@@ -155,10 +247,7 @@ func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 }
 
 func writeJSONError(w http.ResponseWriter, status int, message string) {
-	writeJSON(w, status, map[string]interface{}{
-		"type":    "error",
-		"message": message,
-	})
+	writeAnthropicError(w, status, anthropicErrorType(status), message)
 }
 
 func relayResponse(w http.ResponseWriter, resp *http.Response) {
@@ -171,10 +260,6 @@ func cloneBody(body []byte) io.ReadCloser {
 	return io.NopCloser(bytes.NewReader(body))
 }
 
-func isRetryableStatus(status int) bool {
-	return status == http.StatusTooManyRequests
-}
-
 func closeResponseBody(resp *http.Response) {
 	if resp == nil || resp.Body == nil {
 		return
@@ -187,6 +272,18 @@ func mapTransportError(err error) int {
 	if err == nil {
 		return http.StatusOK
 	}
+	var circuitErr *circuitOpenError
+	if errors.As(err, &circuitErr) {
+		return http.StatusServiceUnavailable
+	}
+	var queueErr *queueRejectedError
+	if errors.As(err, &queueErr) {
+		return http.StatusTooManyRequests
+	}
+	var budgetErr *budgetExceededError
+	if errors.As(err, &budgetErr) {
+		return http.StatusTooManyRequests
+	}
 	var netErr interface{ Timeout() bool }
 	if errors.As(err, &netErr) && netErr.Timeout() {
 		return http.StatusGatewayTimeout
@@ -2,12 +2,14 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestHandleMessages_OpenAINonStream(t *testing.T) {
@@ -315,3 +317,115 @@ func TestHandleMessages_ChatGPTNonStream_InvalidReasoning(t *testing.T) {
 		t.Fatalf("expected 400, got %d body=%s", rr.Code, rr.Body.String())
 	}
 }
+
+func TestHandleMessages_FallbackOnUsageLimit(t *testing.T) {
+	codexCalls := 0
+	codex := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		codexCalls++
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = io.WriteString(w, `{"error":{"type":"usage_limit_reached","message":"The usage limit has been reached"}}`)
+	}))
+	defer codex.Close()
+
+	var seenModel string
+	openai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OpenAIChatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		seenModel = req.Model
+		_ = json.NewEncoder(w).Encode(OpenAIChatResponse{
+			Choices: []OpenAIChoice{{Message: OpenAIMessage{Role: "assistant", Content: "from fallback"}, FinishReason: "stop"}},
+		})
+	}))
+	defer openai.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "codex",
+		Providers: map[string]ProviderConfig{
+			"codex":  {Type: ProviderTypeChatGPT, URL: codex.URL, Model: "gpt-5-codex", Fallback: []string{"openai"}},
+			"openai": {Type: ProviderTypeOpenAI, URL: openai.URL, Model: "gpt-5-mini"},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+
+	body := []byte(`{"model":"claude","system":"@model:gpt-5.3-codex","messages":[{"role":"user","content":"hi"}]}`)
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body))
+	s.handleMessages(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if codexCalls != 1 {
+		t.Fatalf("usage limit should not be retried, got %d codex calls", codexCalls)
+	}
+	if seenModel != "gpt-5-mini" {
+		t.Fatalf("fallback should use its own default model, got %s", seenModel)
+	}
+	if !strings.Contains(rr.Body.String(), "from fallback") {
+		t.Fatalf("unexpected response: %s", rr.Body.String())
+	}
+}
+
+func TestHandleMessages_FallbackExhausted(t *testing.T) {
+	prevSleep := retrySleep
+	retrySleep = func(context.Context, time.Duration) error { return nil }
+	defer func() { retrySleep = prevSleep }()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(w, `{"error":"down"}`)
+	}))
+	defer failing.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "primary",
+		Providers: map[string]ProviderConfig{
+			"primary":   {Type: ProviderTypeOpenAI, URL: failing.URL, Model: "a", Fallback: []string{"secondary"}},
+			"secondary": {Type: ProviderTypeOpenAI, URL: failing.URL, Model: "b"},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+
+	body := []byte(`{"model":"claude","messages":[{"role":"user","content":"hi"}]}`)
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body))
+	s.handleMessages(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected last provider's 503, got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandleMessages_UpstreamErrorEnvelope(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, `{"error":{"message":"You exceeded your current quota","type":"insufficient_quota","code":"insufficient_quota"}}`)
+	}))
+	defer upstream.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "openai",
+		Providers: map[string]ProviderConfig{
+			"openai": {Type: ProviderTypeOpenAI, URL: upstream.URL, Model: "gpt-5-mini"},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+
+	body := []byte(`{"model":"claude","messages":[{"role":"user","content":"hi"}]}`)
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body))
+	s.handleMessages(rr, req)
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), `"error":{"message":"You exceeded your current quota","type":"rate_limit_error"}`) {
+		t.Fatalf("unexpected error envelope: %s", rr.Body.String())
+	}
+}
@@ -141,3 +141,53 @@ func TestHandleCountTokens_InvalidRoute(t *testing.T) {
 		t.Fatalf("expected 400, got %d body=%s", rr.Code, rr.Body.String())
 	}
 }
+
+func TestHandleCountTokens_RoutesByMessageMarkerAndPreset(t *testing.T) {
+	relayed := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		relayed++
+		_, _ = w.Write([]byte(`{"input_tokens":321}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-test",
+		DefaultProvider: "anthropic",
+		Providers: map[string]ProviderConfig{
+			"anthropic": {Type: ProviderTypePassthrough, URL: upstream.URL},
+			"openai":    {Type: ProviderTypeOpenAI, URL: "http://example.com", Model: "gpt-5-mini"},
+		},
+		Presets: map[string]PresetConfig{
+			"cheap": {Provider: "openai", Model: "gpt-4-turbo"},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+	count := func(req CountTokensRequest) int {
+		t.Helper()
+		b, _ := json.Marshal(req)
+		rr := httptest.NewRecorder()
+		s.handleCountTokens(rr, httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", bytes.NewReader(b)))
+		var out CountTokensResponse
+		if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &out) != nil {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		return out.InputTokens
+	}
+
+	for _, marker := range []string{"@route:openai", "@cheap"} {
+		req := CountTokensRequest{
+			Model:    "claude",
+			System:   "system",
+			Messages: []AnthropicMessage{{Role: "user", Content: marker + " hello world"}},
+		}
+		plain := count(req)
+		req.Tools = []AnthropicTool{{Name: "read_file", Description: "Read a file from disk.", InputSchema: json.RawMessage(`{"type":"object"}`)}}
+		if withTools := count(req); plain == 321 || withTools <= plain {
+			t.Fatalf("%s: expected a local count that includes tools, got %d then %d", marker, plain, withTools)
+		}
+	}
+	if relayed != 0 {
+		t.Fatalf("expected markers in messages to route away from passthrough, got %d relays", relayed)
+	}
+}
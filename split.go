@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// pickSplitArm chooses a target in proportion to its weight. The choice is a
+// hash of the split name and key, so a conversation keeps the same arm for
+// every turn of its tool loop.
+func pickSplitArm(targets []SplitTarget, splitName, key string) *SplitTarget {
+	total := 0
+	for _, target := range targets {
+		total += target.Weight
+	}
+	if total <= 0 {
+		return &targets[0]
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(splitName))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(key))
+	point := int(h.Sum64() % uint64(total))
+	for i := range targets {
+		point -= targets[i].Weight
+		if point < 0 {
+			return &targets[i]
+		}
+	}
+	return &targets[len(targets)-1]
+}
+
+// allowedSplitTargets leaves out the arms the client may not route to, so
+// whether a restricted client is refused does not depend on the arm its
+// conversation hashes to. When no arm is allowed all are kept, and
+// authorizeRoute refuses the request.
+func allowedSplitTargets(cfg *Config, clientName string, targets []SplitTarget) []SplitTarget {
+	client, ok := cfg.Clients[clientName]
+	if !ok || len(client.Providers) == 0 {
+		return targets
+	}
+	var allowed []SplitTarget
+	for _, target := range targets {
+		if containsString(client.Providers, target.Provider) {
+			allowed = append(allowed, target)
+		}
+	}
+	if len(allowed) == 0 {
+		return targets
+	}
+	return allowed
+}
+
+// splitKey identifies the conversation a request belongs to: metadata.user_id
+// when the client sends one (Claude Code includes its session), otherwise the
+// text of the first user message.
+func splitKey(messages []AnthropicMessage, in *RuleInput) string {
+	if in != nil && in.UserID != "" {
+		return in.UserID
+	}
+	for _, msg := range messages {
+		if msg.Role == "user" {
+			return normalizeContentToText(msg.Content)
+		}
+	}
+	return ""
+}
+
+// normalizeSplit validates the split targets of the config entry at field.
+// Targets must name providers that do not split again.
+func normalizeSplit(cfg *Config, field string, split []SplitTarget) ([]SplitTarget, error) {
+	if len(split) == 0 {
+		return nil, nil
+	}
+	out := make([]SplitTarget, 0, len(split))
+	for i, target := range split {
+		target.Provider = strings.TrimSpace(target.Provider)
+		target.Model = strings.TrimSpace(target.Model)
+		provider, ok := cfg.Providers[target.Provider]
+		if !ok {
+			return nil, fmt.Errorf("%s.split[%d].provider %q is not defined in providers", field, i, target.Provider)
+		}
+		if len(provider.Split) > 0 && field != "providers."+target.Provider {
+			return nil, fmt.Errorf("%s.split[%d].provider %q has its own split", field, i, target.Provider)
+		}
+		if target.Weight <= 0 {
+			return nil, fmt.Errorf("%s.split[%d].weight must be > 0", field, i)
+		}
+		out = append(out, target)
+	}
+	return out, nil
+}
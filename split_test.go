@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const splitConfig = `
+listen: ":0"
+spoof_model: "claude-test"
+default_provider: "codex"
+timeout_seconds: 30
+providers:
+  codex:
+    type: chatgpt
+    url: "https://chatgpt.com/backend-api/codex/responses"
+    model: "gpt-5.3-codex"
+    auth:
+      type: codex
+    split:
+      - provider: codex
+        weight: 90
+      - provider: openrouter
+        model: "some/model"
+        weight: 10
+  openrouter:
+    type: openai
+    url: "https://openrouter.ai/api/v1/chat/completions"
+    model: "openrouter/auto"
+presets:
+  canary:
+    provider: codex
+    split:
+      - provider: openrouter
+        weight: 1
+`
+
+func TestResolveAll_SplitIsStickyAndWeighted(t *testing.T) {
+	cfg, err := LoadConfig(writeTempConfig(t, splitConfig))
+	if err != nil {
+		t.Fatalf("LoadConfig error: %v", err)
+	}
+	user := []AnthropicMessage{{Role: "user", Content: "hello"}}
+
+	counts := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		in := &RuleInput{UserID: fmt.Sprintf("session-%d", i)}
+		first, err := ResolveAll("", user, cfg, in)
+		if err != nil {
+			t.Fatalf("ResolveAll error: %v", err)
+		}
+		again, _ := ResolveAll("", append(user, AnthropicMessage{Role: "assistant", Content: "hi"}), cfg, in)
+		if first.Arm != again.Arm {
+			t.Fatalf("session %d changed arm: %s -> %s", i, first.Arm, again.Arm)
+		}
+		counts[first.Arm]++
+	}
+	if counts["codex/gpt-5.3-codex"]+counts["openrouter/some/model"] != 2000 {
+		t.Fatalf("unexpected arms: %v", counts)
+	}
+	if share := counts["openrouter/some/model"]; share < 120 || share > 300 {
+		t.Fatalf("expected ~10%% canary traffic, got %d/2000", share)
+	}
+
+	// Without metadata.user_id the first user message keys the arm.
+	a, _ := ResolveAll("", []AnthropicMessage{{Role: "user", Content: "same prompt"}}, cfg, nil)
+	b, _ := ResolveAll("", []AnthropicMessage{{Role: "user", Content: "same prompt"}, {Role: "assistant", Content: "ok"}}, cfg, &RuleInput{})
+	if a.Arm != b.Arm || a.Split != "codex" {
+		t.Fatalf("expected the same arm for one conversation, got %+v and %+v", a, b)
+	}
+}
+
+func TestResolveAll_SplitOverrides(t *testing.T) {
+	cfg, err := LoadConfig(writeTempConfig(t, splitConfig))
+	if err != nil {
+		t.Fatalf("LoadConfig error: %v", err)
+	}
+	user := []AnthropicMessage{{Role: "user", Content: "hello"}}
+
+	resolved, _ := ResolveAll("@model:gpt-5.4", user, cfg, nil)
+	if resolved.ProviderName != "codex" || resolved.Model != "gpt-5.4" || resolved.Split != "" {
+		t.Fatalf("@model should pin the route and skip the split, got %+v", resolved)
+	}
+
+	resolved, _ = ResolveAll("@canary", user, cfg, nil)
+	if resolved.ProviderName != "openrouter" || resolved.Model != "openrouter/auto" || resolved.Split != "@canary" {
+		t.Fatalf("expected preset split to openrouter, got %+v", resolved)
+	}
+
+	// @route picks the provider, so its split applies rather than the preset's.
+	resolved, _ = ResolveAll("@canary @route:openrouter", user, cfg, nil)
+	if resolved.ProviderName != "openrouter" || resolved.Split != "" {
+		t.Fatalf("expected explicit route without split, got %+v", resolved)
+	}
+}
+
+func TestResolveAll_SplitPicksOnlyAllowedArms(t *testing.T) {
+	cfg, err := LoadConfig(writeTempConfig(t, splitConfig))
+	if err != nil {
+		t.Fatalf("LoadConfig error: %v", err)
+	}
+	cfg.Clients = map[string]ClientConfig{
+		"ci":     {Providers: []string{"openrouter"}},
+		"nobody": {Providers: []string{"elsewhere"}},
+	}
+	user := []AnthropicMessage{{Role: "user", Content: "hello"}}
+
+	for i := 0; i < 200; i++ {
+		in := &RuleInput{UserID: fmt.Sprintf("session-%d", i), Client: "ci"}
+		resolved, err := ResolveAll("", user, cfg, in)
+		if err != nil || resolved.Arm != "openrouter/some/model" {
+			t.Fatalf("session %d: expected the allowed arm, got %+v %v", i, resolved, err)
+		}
+	}
+	// With no allowed arm the split is unchanged and authorization refuses it.
+	in := &RuleInput{UserID: "session-0", Client: "nobody"}
+	if resolved, err := ResolveAll("", user, cfg, in); err != nil || resolved.Split != "codex" {
+		t.Fatalf("expected the full split, got %+v %v", resolved, err)
+	}
+}
+
+func TestLoadConfig_InvalidSplit(t *testing.T) {
+	base := strings.SplitN(splitConfig, "presets:", 2)[0]
+	cases := map[string]string{
+		"unknown provider": "presets:\n  p:\n    provider: codex\n    split:\n      - provider: nope\n        weight: 1\n",
+		"zero weight":      "presets:\n  p:\n    provider: codex\n    split:\n      - provider: openrouter\n",
+		"nested split":     "presets:\n  p:\n    provider: openrouter\n    split:\n      - provider: codex\n        weight: 1\n",
+	}
+	for name, presets := range cases {
+		if _, err := LoadConfig(writeTempConfig(t, base+presets)); err == nil {
+			t.Fatalf("%s: expected LoadConfig to fail", name)
+		}
+	}
+}
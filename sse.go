@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"io"
 	"strings"
@@ -72,3 +73,24 @@ func readSSEEvents(r io.Reader, onEvent func(eventName, data string) error) erro
 	}
 	return nil
 }
+
+// sseEventSplitter re-assembles SSE events from writes that may split them at
+// any point and hands each complete event to onEvent.
+type sseEventSplitter struct {
+	pending bytes.Buffer
+	onEvent func(eventName, data string) error
+}
+
+func (p *sseEventSplitter) Write(b []byte) error {
+	p.pending.Write(bytes.ReplaceAll(b, []byte("\r"), nil))
+	for {
+		i := bytes.Index(p.pending.Bytes(), []byte("\n\n"))
+		if i < 0 {
+			return nil
+		}
+		block := string(p.pending.Next(i + 2))
+		if err := readSSEEvents(strings.NewReader(block), p.onEvent); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+const defaultConnectTimeout = 30 * time.Second
+
+// normalizeTimeouts validates the timeouts of the provider at field and fills
+// the defaults: connect 30s, first byte and idle timeout_seconds, no total cap.
+func normalizeTimeouts(field string, t TimeoutConfig, timeoutSeconds int) (TimeoutConfig, error) {
+	if t.ConnectSeconds < 0 || t.FirstByteSeconds < 0 || t.IdleSeconds < 0 || t.TotalSeconds < 0 {
+		return t, fmt.Errorf("%s.timeouts must be >= 0", field)
+	}
+	if t.ConnectSeconds == 0 {
+		t.ConnectSeconds = int(defaultConnectTimeout / time.Second)
+	}
+	if t.FirstByteSeconds == 0 {
+		t.FirstByteSeconds = timeoutSeconds
+	}
+	if t.IdleSeconds == 0 {
+		t.IdleSeconds = timeoutSeconds
+	}
+	return t, nil
+}
+
+// timeoutUnit scales the *_seconds settings. Tests shorten it.
+var timeoutUnit = time.Second
+
+func secondsDuration(seconds int) time.Duration {
+	return time.Duration(seconds) * timeoutUnit
+}
+
+// upstreamTimeoutError reports which phase of an upstream request ran out of
+// time. It satisfies net.Error's Timeout so mapTransportError answers 504.
+type upstreamTimeoutError struct {
+	phase string
+	after time.Duration
+}
+
+func (e *upstreamTimeoutError) Error() string {
+	return fmt.Sprintf("upstream %s timeout after %s", e.phase, e.after)
+}
+
+func (e *upstreamTimeoutError) Timeout() bool {
+	return true
+}
+
+// upstreamWatchdog cancels one upstream attempt when its current phase
+// (connect, first byte or idle body read) or the total cap runs out.
+type upstreamWatchdog struct {
+	cancel   context.CancelFunc
+	timeouts TimeoutConfig
+
+	mu    sync.Mutex
+	gen   int
+	phase *time.Timer
+	total *time.Timer
+	fired *upstreamTimeoutError
+}
+
+// startUpstreamAttempt returns the context for one upstream attempt, traced
+// so the watchdog moves from the connect to the first-byte phase once a
+// connection (including TLS) is ready.
+func startUpstreamAttempt(ctx context.Context, timeouts TimeoutConfig) (context.Context, *upstreamWatchdog) {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &upstreamWatchdog{cancel: cancel, timeouts: timeouts}
+	if timeouts.TotalSeconds > 0 {
+		total := secondsDuration(timeouts.TotalSeconds)
+		w.total = time.AfterFunc(total, func() { w.fire(&upstreamTimeoutError{phase: "total", after: total}) })
+	}
+	w.arm("connect", secondsDuration(timeouts.ConnectSeconds))
+	trace := &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) {
+			w.arm("first byte", secondsDuration(timeouts.FirstByteSeconds))
+		},
+		GotFirstResponseByte: func() {
+			w.arm("", 0)
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), w
+}
+
+// arm replaces the phase timer; a zero duration leaves the phase unbounded.
+func (w *upstreamWatchdog) arm(phase string, d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.gen++
+	if w.phase != nil {
+		w.phase.Stop()
+		w.phase = nil
+	}
+	if d <= 0 || w.fired != nil {
+		return
+	}
+	gen := w.gen
+	w.phase = time.AfterFunc(d, func() {
+		w.mu.Lock()
+		current := gen == w.gen
+		w.mu.Unlock()
+		if current {
+			w.fire(&upstreamTimeoutError{phase: phase, after: d})
+		}
+	})
+}
+
+func (w *upstreamWatchdog) fire(err *upstreamTimeoutError) {
+	w.mu.Lock()
+	if w.fired == nil {
+		w.fired = err
+	}
+	w.mu.Unlock()
+	w.cancel()
+}
+
+// err returns the timeout that cancelled the attempt, if any.
+func (w *upstreamWatchdog) err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fired == nil {
+		return nil
+	}
+	return w.fired
+}
+
+// stop releases the timers and the attempt context.
+func (w *upstreamWatchdog) stop() {
+	w.mu.Lock()
+	w.gen++
+	if w.phase != nil {
+		w.phase.Stop()
+	}
+	if w.total != nil {
+		w.total.Stop()
+	}
+	w.mu.Unlock()
+	w.cancel()
+}
+
+// watch hands the response body to the watchdog: every read must make
+// progress within the idle timeout, and closing the body ends the attempt.
+func (w *upstreamWatchdog) watch(resp *http.Response) {
+	idle := secondsDuration(w.timeouts.IdleSeconds)
+	w.arm("idle", idle)
+	resp.Body = &idleTimeoutBody{ReadCloser: resp.Body, watchdog: w, idle: idle}
+}
+
+type idleTimeoutBody struct {
+	io.ReadCloser
+	watchdog *upstreamWatchdog
+	idle     time.Duration
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.watchdog.arm("idle", b.idle)
+	}
+	if err != nil && err != io.EOF {
+		if timeout := b.watchdog.err(); timeout != nil {
+			return n, timeout
+		}
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.watchdog.stop()
+	return err
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func useMillisecondTimeouts(t *testing.T) {
+	prev := timeoutUnit
+	timeoutUnit = time.Millisecond
+	t.Cleanup(func() { timeoutUnit = prev })
+}
+
+func TestSendWithRetry_FirstByteTimeout(t *testing.T) {
+	useMillisecondTimeouts(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(300 * time.Millisecond):
+		}
+	}))
+	defer upstream.Close()
+
+	s := &Server{client: upstream.Client(), logger: NewLogger()}
+	provider := ProviderConfig{
+		Type:     ProviderTypeOpenAI,
+		URL:      upstream.URL,
+		Retry:    RetryConfig{MaxAttempts: 1},
+		Timeouts: TimeoutConfig{ConnectSeconds: 1000, FirstByteSeconds: 50},
+	}
+	start := time.Now()
+	_, err := s.doProviderRequestWithRetry(context.Background(), http.MethodPost, upstream.URL, []byte(`{}`), nil, provider, false, "", "", "", "")
+	var timeout *upstreamTimeoutError
+	if !errors.As(err, &timeout) || timeout.phase != "first byte" {
+		t.Fatalf("expected first byte timeout, got %v", err)
+	}
+	if mapTransportError(err) != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504 for a timeout, got %d", mapTransportError(err))
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("timeout took %s", time.Since(start))
+	}
+}
+
+func TestRelayStream_IdleTimeoutEndsWithErrorEvent(t *testing.T) {
+	useMillisecondTimeouts(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		// A healthy stream may outlast the idle timeout as long as events keep coming.
+		for i := 0; i < 5; i++ {
+			_, _ = w.Write([]byte("event: ping\ndata: {\"type\":\"ping\"}\n\n"))
+			flusher.Flush()
+			time.Sleep(30 * time.Millisecond)
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer upstream.Close()
+
+	s := &Server{client: upstream.Client(), logger: NewLogger()}
+	provider := ProviderConfig{Type: ProviderTypePassthrough, URL: upstream.URL, Timeouts: TimeoutConfig{IdleSeconds: 100}}
+	resp, err := s.doProviderRequestWithRetry(context.Background(), http.MethodPost, upstream.URL, []byte(`{}`), nil, provider, true, "", "", "", "")
+	if err != nil {
+		t.Fatalf("doProviderRequestWithRetry error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	rr := httptest.NewRecorder()
+	err = relayStream(rr, resp)
+	var timeout *upstreamTimeoutError
+	if !errors.As(err, &timeout) || timeout.phase != "idle" {
+		t.Fatalf("expected idle timeout, got %v", err)
+	}
+	body := rr.Body.String()
+	if strings.Count(body, "event: ping") != 5 {
+		t.Fatalf("expected all events before the stall to be relayed, got %s", body)
+	}
+	if !strings.Contains(body, "event: error") || !strings.Contains(body, "upstream idle timeout") {
+		t.Fatalf("expected an Anthropic error event, got %s", body)
+	}
+}
+
+func TestSendWithRetry_TotalTimeout(t *testing.T) {
+	useMillisecondTimeouts(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		for {
+			if _, err := w.Write([]byte("x")); err != nil {
+				return
+			}
+			flusher.Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}))
+	defer upstream.Close()
+
+	s := &Server{client: upstream.Client(), logger: NewLogger()}
+	provider := ProviderConfig{Type: ProviderTypeOpenAI, URL: upstream.URL, Timeouts: TimeoutConfig{IdleSeconds: 100, TotalSeconds: 100}}
+	resp, err := s.doProviderRequestWithRetry(context.Background(), http.MethodPost, upstream.URL, []byte(`{}`), nil, provider, false, "", "", "", "")
+	if err != nil {
+		t.Fatalf("doProviderRequestWithRetry error: %v", err)
+	}
+	defer resp.Body.Close()
+	buf := make([]byte, 64)
+	for err == nil {
+		_, err = resp.Body.Read(buf)
+	}
+	var timeout *upstreamTimeoutError
+	if !errors.As(err, &timeout) || timeout.phase != "total" {
+		t.Fatalf("expected total timeout, got %v", err)
+	}
+}
+
+func TestLoadConfig_Timeouts(t *testing.T) {
+	base := "listen: \":0\"\nspoof_model: m\ndefault_provider: p\ntimeout_seconds: 300\nproviders:\n  p:\n    type: passthrough\n    url: \"https://api.anthropic.com\"\n"
+	cfg, err := LoadConfig(writeTempConfig(t, base+"    timeouts:\n      idle_seconds: 60\n"))
+	if err != nil {
+		t.Fatalf("LoadConfig error: %v", err)
+	}
+	want := TimeoutConfig{ConnectSeconds: 30, FirstByteSeconds: 300, IdleSeconds: 60}
+	if got := cfg.Providers["p"].Timeouts; got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	if _, err := LoadConfig(writeTempConfig(t, base+"    timeouts:\n      total_seconds: -1\n")); err == nil {
+		t.Fatal("expected negative timeout to be rejected")
+	}
+}
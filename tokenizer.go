@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// o200kBaseFile is OpenAI's published o200k_base rank table from tiktoken
+// (MIT), gzipped, in the tiktoken rank file format ("<base64 token> <rank>"
+// per line). tokenizer/README.md records its source and license.
+//
+//go:generate sh -c "curl -fsSL https://openaipublic.blob.core.windows.net/encodings/o200k_base.tiktoken | gzip -9n > tokenizer/o200k_base.tiktoken.gz"
+const o200kBaseFile = "tokenizer/o200k_base.tiktoken.gz"
+
+// o200kBaseSHA256 is the checksum tiktoken pins for the uncompressed file.
+const o200kBaseSHA256 = "446a9538cb6c348e3516120d7c08b09f57c36495e2acfffe59a5bf8b0cfb1a2d"
+
+//go:embed tokenizer
+var tokenizerFiles embed.FS
+
+// o200kPattern is the pre-tokenizer pattern of OpenAI's o200k_base encoding.
+// RE2 has no lookahead, so its `\s+(?!\S)` alternative is applied in
+// bpeEncoding.split instead.
+const o200kPattern = `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+`
+
+// maxPieceBytes bounds the text merged at once; longer pieces (base64 blobs,
+// long runs of one character) are counted in chunks.
+const maxPieceBytes = 1024
+
+// bpeEncoding counts tokens the way a tiktoken encoding does: text is split
+// into pieces by pattern and each piece is merged byte pair by byte pair,
+// lowest rank first.
+type bpeEncoding struct {
+	pattern *regexp.Regexp
+
+	once  sync.Once
+	ranks map[string]int
+	err   error
+	// warnOnce reports a missing or damaged table a single time.
+	warnOnce sync.Once
+}
+
+// tokenEncoding counts tokens for every model. OpenAI's current models all
+// use o200k_base, and it is a reasonable stand-in for the tokenizers of other
+// models served through openai-compatible providers.
+var tokenEncoding = &bpeEncoding{pattern: regexp.MustCompile(`^(?:` + o200kPattern + `)`)}
+
+func (e *bpeEncoding) load() error {
+	e.once.Do(func() {
+		data, err := tokenizerFiles.ReadFile(o200kBaseFile)
+		if err != nil {
+			e.err = fmt.Errorf("%s is not bundled; run go generate to fetch it", o200kBaseFile)
+			return
+		}
+		e.ranks, e.err = parseRankFile(data, o200kBaseSHA256)
+		if e.err != nil {
+			e.err = fmt.Errorf("%s: %w", o200kBaseFile, e.err)
+		}
+	})
+	return e.err
+}
+
+// parseRankFile reads a gzipped tiktoken rank file whose uncompressed
+// contents must hash to checksum.
+func parseRankFile(data []byte, checksum string) (map[string]int, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(raw); hex.EncodeToString(sum[:]) != checksum {
+		return nil, fmt.Errorf("checksum mismatch")
+	}
+	ranks := map[string]int{}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		token, rankText, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		rank, err := strconv.Atoi(rankText)
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, err
+		}
+		ranks[string(decoded)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for b := 0; b < 256; b++ {
+		if _, ok := ranks[string([]byte{byte(b)})]; !ok {
+			return nil, fmt.Errorf("byte %d has no rank", b)
+		}
+	}
+	return ranks, nil
+}
+
+// split calls fn with each pre-tokenized piece of text.
+func (e *bpeEncoding) split(text string, fn func(piece string)) {
+	for len(text) > 0 {
+		end := len(text)
+		if loc := e.pattern.FindStringIndex(text); loc != nil && loc[1] > 0 {
+			end = loc[1]
+		} else {
+			_, end = utf8.DecodeRuneInString(text)
+		}
+		piece := text[:end]
+		// `\s+(?!\S)`: a run of spaces before a word leaves its last
+		// character to start the next piece.
+		if end < len(text) && isSpaceRun(piece) && utf8.RuneCountInString(piece) > 1 {
+			_, size := utf8.DecodeLastRuneInString(piece)
+			end -= size
+			piece = text[:end]
+		}
+		fn(piece)
+		text = text[end:]
+	}
+}
+
+// isSpaceRun reports whether piece is whitespace that does not end in a line
+// break, i.e. was matched by the pattern's trailing whitespace alternative.
+func isSpaceRun(piece string) bool {
+	last := piece[len(piece)-1]
+	if last == '\n' || last == '\r' {
+		return false
+	}
+	for i := 0; i < len(piece); i++ {
+		switch piece[i] {
+		case ' ', '\t', '\f', '\v':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// count returns the number of tokens text encodes to.
+func (e *bpeEncoding) count(text string) (int, error) {
+	if err := e.load(); err != nil {
+		return 0, err
+	}
+	seen := map[string]int{}
+	total := 0
+	e.split(text, func(piece string) {
+		n, ok := seen[piece]
+		if !ok {
+			for start := 0; start < len(piece); start += maxPieceBytes {
+				end := start + maxPieceBytes
+				if end > len(piece) {
+					end = len(piece)
+				}
+				n += e.mergeCount(piece[start:end])
+			}
+			seen[piece] = n
+		}
+		total += n
+	})
+	return total, nil
+}
+
+// mergeCount runs byte pair merges over piece and returns how many tokens
+// remain.
+func (e *bpeEncoding) mergeCount(piece string) int {
+	if _, ok := e.ranks[piece]; ok {
+		return 1
+	}
+	// bounds holds the start offset of every remaining token, plus the end.
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, bestRank := -1, 0
+		for i := 0; i+2 < len(bounds); i++ {
+			rank, ok := e.ranks[piece[bounds[i]:bounds[i+2]]]
+			if ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	return len(bounds) - 1
+}
+
+// Token overheads of OpenAI's chat format, added on top of the content.
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+	tokensPerTool    = 8
+	// Images and PDFs are not decoded, so they count as a typical
+	// 1024x1024 image or a few document pages.
+	imageTokenEstimate    = 765
+	documentTokenEstimate = 1500
+)
+
+// countRequestTokens counts the input tokens of an Anthropic request: system
+// prompt, tool definitions and every content block of every message. When
+// the rank table cannot be loaded, text is estimated at four characters per
+// token and the load error is returned with the estimate.
+func countRequestTokens(req AnthropicMessageRequest) (int, error) {
+	c := requestTokenCounter{enc: tokenEncoding}
+	c.text(NormalizeSystemText(req.System))
+	for _, tool := range req.Tools {
+		c.total += tokensPerTool
+		c.text(tool.Name)
+		c.text(tool.Description)
+		c.raw(tool.InputSchema)
+	}
+	for _, msg := range req.Messages {
+		c.total += tokensPerMessage
+		c.text(msg.Role)
+		c.content(msg.Content)
+	}
+	c.total += tokensPerReply
+	return c.total, c.err
+}
+
+// writeTokenCount answers count_tokens for a translated provider by
+// counting locally.
+func writeTokenCount(w http.ResponseWriter, call *ProviderCall) {
+	tokens, err := countRequestTokens(call.Request)
+	if err != nil {
+		tokenEncoding.warnOnce.Do(func() {
+			call.Server.logger.Warnf("count_tokens is estimating token counts: %v", err)
+		})
+	}
+	writeJSON(w, http.StatusOK, CountTokensResponse{InputTokens: tokens})
+}
+
+type requestTokenCounter struct {
+	enc   *bpeEncoding
+	total int
+	err   error
+}
+
+func (c *requestTokenCounter) text(s string) {
+	if s == "" {
+		return
+	}
+	n, err := c.enc.count(s)
+	if err != nil {
+		n = utf8.RuneCountInString(s) / 4
+		if n < 1 {
+			n = 1
+		}
+		c.err = err
+	}
+	c.total += n
+}
+
+func (c *requestTokenCounter) raw(v json.RawMessage) {
+	if len(v) > 0 {
+		c.text(string(v))
+	}
+}
+
+// content counts message or tool_result content: a string or a list of
+// content blocks.
+func (c *requestTokenCounter) content(content interface{}) {
+	switch v := content.(type) {
+	case nil:
+	case string:
+		c.text(v)
+	default:
+		var blocks []AnthropicContentBlock
+		raw, err := json.Marshal(v)
+		if err != nil || json.Unmarshal(raw, &blocks) != nil {
+			c.text(string(raw))
+			return
+		}
+		for _, block := range blocks {
+			c.block(block)
+		}
+	}
+}
+
+func (c *requestTokenCounter) block(block AnthropicContentBlock) {
+	switch block.Type {
+	case "text":
+		c.text(block.Text)
+	case "thinking":
+		c.text(block.Thinking)
+	case "tool_use":
+		c.text(block.Name)
+		c.raw(block.Input)
+	case "tool_result":
+		c.content(block.Content)
+	case "image":
+		c.total += imageTokenEstimate
+	case "document":
+		c.text(block.Title)
+		switch {
+		case block.Source == nil:
+		case block.Source.Type == "text":
+			c.text(block.Source.Data)
+		case block.Source.Type == "content":
+			c.content(block.Source.Content)
+		default:
+			c.total += documentTokenEstimate
+		}
+	default:
+		raw, _ := json.Marshal(block)
+		c.text(string(raw))
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBPEEncoding_Split(t *testing.T) {
+	var got []string
+	tokenEncoding.split("Hello world  foo\n\n  bar 12345 don't", func(piece string) {
+		got = append(got, piece)
+	})
+	want := []string{"Hello", " world", " ", " foo", "\n\n", " ", " bar", " ", "123", "45", " don't"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected pieces: %q", got)
+	}
+}
+
+func TestBPEEncoding_MatchesO200kReferenceCounts(t *testing.T) {
+	requireRankTable(t)
+	// Counts tiktoken's o200k_base gives for these strings.
+	for text, want := range map[string]int{
+		"hello world":   2,
+		"Hello, world!": 4,
+		"The quick brown fox jumps over the lazy dog.": 10,
+		"You are a helpful assistant.":                 6,
+		"import numpy as np":                           4,
+		"1234567890":                                   4,
+		"    ":                                         1,
+	} {
+		if n, err := tokenEncoding.count(text); err != nil || n != want {
+			t.Fatalf("%q: expected %d tokens, got %d %v", text, want, n, err)
+		}
+	}
+}
+
+func TestBPEEncoding_Count(t *testing.T) {
+	requireRankTable(t)
+	if n, err := tokenEncoding.count(""); err != nil || n != 0 {
+		t.Fatalf("expected 0 for empty text, got %d %v", n, err)
+	}
+	// Unseen bytes still count, one token per byte at most.
+	text := "\x00\x01\xff"
+	if n, err := tokenEncoding.count(text); err != nil || n < 1 || n > len(text) {
+		t.Fatalf("unexpected count for raw bytes: %d %v", n, err)
+	}
+	long := strings.Repeat("=", 10*maxPieceBytes)
+	if n, err := tokenEncoding.count(long); err != nil || n < 10 || n > len(long)/2 {
+		t.Fatalf("unexpected count for a long piece: %d %v", n, err)
+	}
+}
+
+func TestParseRankFile_VerifiesChecksum(t *testing.T) {
+	var plain bytes.Buffer
+	for b := 0; b < 256; b++ {
+		fmt.Fprintf(&plain, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(b)}), b)
+	}
+	var zipped bytes.Buffer
+	zw := gzip.NewWriter(&zipped)
+	_, _ = zw.Write(plain.Bytes())
+	_ = zw.Close()
+	sum := sha256.Sum256(plain.Bytes())
+
+	ranks, err := parseRankFile(zipped.Bytes(), hex.EncodeToString(sum[:]))
+	if err != nil || len(ranks) != 256 || ranks["a"] != 'a' {
+		t.Fatalf("expected 256 byte ranks, got %d %v", len(ranks), err)
+	}
+	if _, err := parseRankFile(zipped.Bytes(), o200kBaseSHA256); err == nil {
+		t.Fatal("expected a table that does not match the checksum to be rejected")
+	}
+}
+
+// requireRankTable skips tests that need the o200k_base table when it has not
+// been fetched; see tokenizer/README.md.
+func requireRankTable(t *testing.T) {
+	t.Helper()
+	if err := tokenEncoding.load(); err != nil {
+		t.Skipf("rank table unavailable: %v", err)
+	}
+}
+
+func TestCountRequestTokens_CountsToolsAndBlocks(t *testing.T) {
+	count := func(req AnthropicMessageRequest) int {
+		t.Helper()
+		// Without the rank table the same structure is counted by estimate.
+		n, _ := countRequestTokens(req)
+		return n
+	}
+	base := AnthropicMessageRequest{
+		System:   "You are a coding assistant.",
+		Messages: []AnthropicMessage{{Role: "user", Content: "list the files"}},
+	}
+	baseCount := count(base)
+
+	withTool := base
+	withTool.Tools = []AnthropicTool{{
+		Name:        "list_files",
+		Description: "List the files in a directory.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"path":{"type":"string"}}}`),
+	}}
+	toolCount := count(withTool)
+	if toolCount <= baseCount+tokensPerTool {
+		t.Fatalf("expected the tool definition to be counted: %d vs %d", toolCount, baseCount)
+	}
+
+	withBlocks := withTool
+	withBlocks.Messages = append(withBlocks.Messages,
+		AnthropicMessage{Role: "assistant", Content: []interface{}{
+			map[string]interface{}{"type": "thinking", "thinking": "The user wants a listing."},
+			map[string]interface{}{"type": "tool_use", "id": "t1", "name": "list_files", "input": map[string]interface{}{"path": "/srv"}},
+		}},
+		AnthropicMessage{Role: "user", Content: []interface{}{
+			map[string]interface{}{"type": "tool_result", "tool_use_id": "t1", "content": []interface{}{
+				map[string]interface{}{"type": "text", "text": "README.md\nmain.go\nserver.go"},
+			}},
+			map[string]interface{}{"type": "image", "source": map[string]interface{}{"type": "base64", "media_type": "image/png", "data": strings.Repeat("A", 4096)}},
+		}},
+	)
+	blockCount := count(withBlocks)
+	if blockCount <= toolCount+2*tokensPerMessage+imageTokenEstimate+10 {
+		t.Fatalf("expected every content block to be counted: %d vs %d", blockCount, toolCount)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,74 +13,79 @@ import (
 	"time"
 )
 
-func (s *Server) proxyChatGPT(
-	ctx context.Context,
-	w http.ResponseWriter,
-	routeName string,
-	provider ProviderConfig,
-	model string,
-	reasoningEffort string,
-	serviceTier string,
-	anthropicReq AnthropicMessageRequest,
-	incomingHeaders http.Header,
-) {
+// chatGPTProvider translates Anthropic Messages requests to the ChatGPT
+// Responses API used by Codex.
+type chatGPTProvider struct{}
+
+func (chatGPTProvider) Validate(name string, cfg ProviderConfig) error {
+	return requireProviderModel(name, cfg)
+}
+
+func (chatGPTProvider) SupportsReasoning() bool {
+	return true
+}
+
+func (chatGPTProvider) TranslateRequest(call *ProviderCall) ([]byte, error) {
 	// Codex requires stream:true for all requests. Force it regardless of the
 	// original caller's preference and handle the non-streaming case by
 	// collecting the SSE stream internally.
-	req := translateAnthropicToResponses(anthropicReq, model, reasoningEffort, serviceTier)
+	req := translateAnthropicToResponses(call.Request, call.Route.Model, call.Route.ReasoningEffort, call.Route.ServiceTier)
 	req.Stream = true
 	payload, err := json.Marshal(req)
 	if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, "failed to encode upstream request")
-		return
+		return nil, fmt.Errorf("failed to encode upstream request")
 	}
 
 	// DEBUG: log outgoing request to Codex
-	s.logger.Debugf("[CODEX-REQ] payload=%s", truncateForLog(string(payload), 2000))
+	call.Server.logger.Debugf("[CODEX-REQ] payload=%s", truncateForLog(string(payload), 2000))
+	return payload, nil
+}
 
-	resp, err := s.doProviderRequestWithRetry(
+func (chatGPTProvider) Send(ctx context.Context, call *ProviderCall, payload []byte) (*http.Response, error) {
+	return call.Server.doProviderRequestWithRetry(
 		ctx,
 		http.MethodPost,
-		provider.URL,
+		call.Route.Provider.URL,
 		payload,
-		incomingHeaders,
-		provider,
+		call.Inbound.Header,
+		call.Route.Provider,
 		true, // always stream toward Codex
-		routeName,
-		req.Model,
-		req.Reasoning.Effort,
-		req.ServiceTier,
+		call.Route.ProviderName,
+		call.Route.Model,
+		NormalizeReasoningEffort(call.Route.ReasoningEffort),
+		NormalizeServiceTier(call.Route.ServiceTier),
 	)
-	if err != nil {
-		writeJSONError(w, mapTransportError(err), err.Error())
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 400 {
-		raw, _ := io.ReadAll(resp.Body)
-		writeJSON(w, resp.StatusCode, map[string]interface{}{
-			"type":    "error",
-			"message": string(raw),
-		})
-		return
-	}
+}
 
-	if anthropicReq.Stream {
-		if err := convertResponsesStreamToAnthropic(w, resp.Body, s.cfg.SpoofModel, s.logger); err != nil {
-			s.logger.Errorf("responses stream translation failed: %v", err)
-		}
-		return
-	}
+func (chatGPTProvider) TranslateStream(w http.ResponseWriter, resp *http.Response, call *ProviderCall) error {
+	w, stop := startKeepalive(w, call.Config.PingInterval())
+	defer stop()
+	return convertResponsesStreamToAnthropic(w, resp.Body, call.Config.SpoofModel, call.Server.logger)
+}
 
+func (chatGPTProvider) TranslateResponse(w http.ResponseWriter, resp *http.Response, call *ProviderCall) error {
 	// Non-streaming caller: collect the SSE stream and build a JSON response
 	// from the response.completed event.
-	raw, err := collectResponsesStreamAsJSON(resp.Body, s.logger)
+	raw, err := collectResponsesStreamAsJSON(resp.Body, call.Server.logger)
 	if err != nil {
+		var failure *upstreamError
+		if errors.As(err, &failure) {
+			writeAnthropicError(w, failure.Status, failure.Type, failure.Message)
+			return err
+		}
 		writeJSONError(w, http.StatusBadGateway, "failed to collect upstream stream: "+err.Error())
-		return
+		return err
 	}
-	writeJSON(w, http.StatusOK, convertResponsesJSONToAnthropic(raw, s.cfg.SpoofModel))
+	writeJSON(w, http.StatusOK, convertResponsesJSONToAnthropic(raw, call.Config.SpoofModel))
+	return nil
+}
+
+func (chatGPTProvider) TranslateError(w http.ResponseWriter, resp *http.Response, _ *ProviderCall) {
+	writeAnthropicUpstreamError(w, resp)
+}
+
+func (chatGPTProvider) CountTokens(_ context.Context, w http.ResponseWriter, call *ProviderCall) {
+	writeTokenCount(w, call)
 }
 
 func translateAnthropicToResponses(req AnthropicMessageRequest, model string, reasoningEffort string, serviceTier string) ChatGPTResponsesRequest {
@@ -130,24 +136,28 @@ func translateAnthropicMessagesToResponsesInput(messages []AnthropicMessage) []R
 		}
 
 		blocks := normalizeContentToBlocks(message.Content)
-		textParts := make([]string, 0, len(blocks))
+		parts := make([]ResponsesContentPart, 0, len(blocks))
 		flushText := func() {
-			if len(textParts) == 0 {
+			if len(parts) == 0 {
 				return
 			}
 			out = append(out, ResponsesInputItem{
 				Type:    "message",
 				Role:    role,
-				Content: strings.Join(textParts, "\n"),
+				Content: responsesMessageContent(parts),
 			})
-			textParts = textParts[:0]
+			parts = parts[:0]
 		}
 
 		for i, block := range blocks {
 			switch block.Type {
 			case "text":
 				if strings.TrimSpace(block.Text) != "" {
-					textParts = append(textParts, block.Text)
+					parts = append(parts, ResponsesContentPart{Type: "input_text", Text: block.Text})
+				}
+			case "image", "document":
+				if role == "user" {
+					parts = append(parts, translateMediaBlockToResponses(block))
 				}
 			case "tool_use":
 				flushText()
@@ -162,6 +172,21 @@ func translateAnthropicMessagesToResponsesInput(messages []AnthropicMessage) []R
 					Name:      block.Name,
 					Arguments: string(safeJSONRawMessage(string(block.Input))),
 				})
+			case "thinking":
+				encrypted, ok := decodeCodexReasoningSignature(block.Signature)
+				if !ok || role != "assistant" {
+					continue
+				}
+				flushText()
+				summary := []ResponsesSummaryPart{}
+				if strings.TrimSpace(block.Thinking) != "" {
+					summary = append(summary, ResponsesSummaryPart{Type: "summary_text", Text: block.Thinking})
+				}
+				out = append(out, ResponsesInputItem{
+					Type:             "reasoning",
+					Summary:          summary,
+					EncryptedContent: encrypted,
+				})
 			case "tool_result":
 				flushText()
 				if strings.TrimSpace(block.ToolUseID) == "" {
@@ -176,6 +201,12 @@ func translateAnthropicMessagesToResponsesInput(messages []AnthropicMessage) []R
 					CallID: block.ToolUseID,
 					Output: outputText,
 				})
+				// Images and documents returned by a tool follow the output
+				// in a user message.
+				for _, media := range extractToolResultMedia(block.Content) {
+					parts = append(parts, translateMediaBlockToResponses(media))
+				}
+				flushText()
 			}
 		}
 		flushText()
@@ -183,6 +214,53 @@ func translateAnthropicMessagesToResponsesInput(messages []AnthropicMessage) []R
 	return out
 }
 
+// responsesMessageContent collapses text-only parts into a plain string and
+// keeps the multi-part form when images or files are present.
+func responsesMessageContent(parts []ResponsesContentPart) interface{} {
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type != "input_text" {
+			out := make([]ResponsesContentPart, len(parts))
+			copy(out, parts)
+			return out
+		}
+		texts = append(texts, part.Text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+// translateMediaBlockToResponses maps an Anthropic image or document block to
+// a Responses input_image or input_file part.
+func translateMediaBlockToResponses(block AnthropicContentBlock) ResponsesContentPart {
+	src := block.Source
+	if src == nil {
+		return ResponsesContentPart{Type: "input_text", Text: mediaPlaceholder(block)}
+	}
+	if block.Type == "image" {
+		if url := anthropicSourceURL(src); url != "" {
+			return ResponsesContentPart{Type: "input_image", ImageURL: url, Detail: "auto"}
+		}
+		return ResponsesContentPart{Type: "input_text", Text: mediaPlaceholder(block)}
+	}
+
+	switch src.Type {
+	case "base64":
+		return ResponsesContentPart{
+			Type:     "input_file",
+			Filename: documentFilename(block),
+			FileData: anthropicSourceURL(src),
+		}
+	case "url":
+		return ResponsesContentPart{Type: "input_file", FileURL: src.URL}
+	case "text":
+		return ResponsesContentPart{Type: "input_text", Text: src.Data}
+	case "content":
+		return ResponsesContentPart{Type: "input_text", Text: normalizeContentToText(src.Content)}
+	default:
+		return ResponsesContentPart{Type: "input_text", Text: mediaPlaceholder(block)}
+	}
+}
+
 func translateAnthropicToolsToResponses(tools []AnthropicTool) []ResponsesTool {
 	out := make([]ResponsesTool, 0, len(tools))
 	for _, tool := range tools {
@@ -225,14 +303,16 @@ func translateToolChoiceToResponses(v interface{}) interface{} {
 }
 
 type responsesStreamState struct {
-	messageID     string
-	blockIndex    int
-	textBlocks    map[string]int
-	toolBlocks    map[int]int
-	openBlocks    map[int]bool
-	stopReason    string
-	outputTokens  int
-	messageOpened bool
+	messageID       string
+	blockIndex      int
+	textBlocks      map[string]int
+	toolBlocks      map[int]int
+	reasoningBlocks map[int]int
+	openBlocks      map[int]bool
+	stopReason      string
+	usage           AnthropicUsage
+	// failure is set when the upstream reports response.failed or error.
+	failure *upstreamError
 }
 
 func convertResponsesStreamToAnthropic(w http.ResponseWriter, src io.Reader, spoofModel string, logger *Logger) error {
@@ -247,37 +327,36 @@ func convertResponsesStreamToAnthropic(w http.ResponseWriter, src io.Reader, spo
 	}
 
 	state := &responsesStreamState{
-		messageID:    fmt.Sprintf("msg_%d", time.Now().UnixNano()),
-		blockIndex:   -1,
-		textBlocks:   map[string]int{},
-		toolBlocks:   map[int]int{},
-		openBlocks:   map[int]bool{},
-		stopReason:   "end_turn",
-		outputTokens: 0,
-	}
-
-	sendMessageStart := func() error {
-		if state.messageOpened {
-			return nil
-		}
-		state.messageOpened = true
-		return writeAnthropicSSEEvent(w, "message_start", map[string]interface{}{
-			"type": "message_start",
-			"message": map[string]interface{}{
-				"id":            state.messageID,
-				"type":          "message",
-				"role":          "assistant",
-				"model":         spoofModel,
-				"content":       []interface{}{},
-				"stop_reason":   nil,
-				"stop_sequence": nil,
-				"usage": map[string]int{
-					"input_tokens":  0,
-					"output_tokens": 0,
-				},
+		messageID:       fmt.Sprintf("msg_%d", time.Now().UnixNano()),
+		blockIndex:      -1,
+		textBlocks:      map[string]int{},
+		toolBlocks:      map[int]int{},
+		reasoningBlocks: map[int]int{},
+		openBlocks:      map[int]bool{},
+		stopReason:      "end_turn",
+	}
+
+	// Open the message before the upstream answers so the client sees the
+	// stream start even while Codex is still reasoning.
+	if err := writeAnthropicSSEEvent(w, "message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id":            state.messageID,
+			"type":          "message",
+			"role":          "assistant",
+			"model":         spoofModel,
+			"content":       []interface{}{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage": map[string]int{
+				"input_tokens":  0,
+				"output_tokens": 0,
 			},
-		})
+		},
+	}); err != nil {
+		return err
 	}
+	flusher.Flush()
 
 	if err := readSSEEvents(src, func(eventName, data string) error {
 		data = strings.TrimSpace(data)
@@ -297,37 +376,25 @@ func convertResponsesStreamToAnthropic(w http.ResponseWriter, src io.Reader, spo
 			return nil
 		}
 
-		if eventType, _ := event["type"].(string); eventType == "response.created" {
-			if err := applyResponsesEventToAnthropic(w, event, eventName, state); err != nil {
-				return err
-			}
-			if err := sendMessageStart(); err != nil {
-				return err
-			}
-			flusher.Flush()
-			return nil
-		}
-
-		if err := sendMessageStart(); err != nil {
-			return err
-		}
 		if err := applyResponsesEventToAnthropic(w, event, eventName, state); err != nil {
 			return err
 		}
 		flusher.Flush()
+		if state.failure != nil {
+			return errSSEStreamDone
+		}
 		return nil
 	}); err != nil {
-		return err
+		return failAnthropicStream(w, flusher, &upstreamError{Status: http.StatusBadGateway, Type: AnthropicErrAPI, Message: "upstream stream interrupted: " + err.Error()})
+	}
+	if state.failure != nil {
+		logger.Warnf("[CODEX-SSE] upstream failure: %v", state.failure)
+		return failAnthropicStream(w, flusher, state.failure)
 	}
 
-	logger.Debugf("[CODEX-SSE] stream ended, stopReason=%s outputTokens=%d openBlocks=%d messageOpened=%t",
-		state.stopReason, state.outputTokens, len(state.openBlocks), state.messageOpened)
+	logger.Debugf("[CODEX-SSE] stream ended, stopReason=%s inputTokens=%d cachedTokens=%d outputTokens=%d openBlocks=%d",
+		state.stopReason, state.usage.InputTokens, state.usage.CacheReadInputTokens, state.usage.OutputTokens, len(state.openBlocks))
 
-	if !state.messageOpened {
-		if err := sendMessageStart(); err != nil {
-			return err
-		}
-	}
 	if err := closeOpenResponseBlocks(w, state); err != nil {
 		return err
 	}
@@ -337,9 +404,7 @@ func convertResponsesStreamToAnthropic(w http.ResponseWriter, src io.Reader, spo
 			"stop_reason":   state.stopReason,
 			"stop_sequence": nil,
 		},
-		"usage": map[string]int{
-			"output_tokens": state.outputTokens,
-		},
+		"usage": state.usage,
 	}); err != nil {
 		return err
 	}
@@ -365,13 +430,6 @@ func applyResponsesEventToAnthropic(
 	}
 
 	switch t {
-	case "response.created":
-		if resp, ok := event["response"].(map[string]interface{}); ok {
-			if id, ok := resp["id"].(string); ok && id != "" {
-				state.messageID = id
-			}
-		}
-		return nil
 	case "response.content_part.added":
 		part, _ := event["part"].(map[string]interface{})
 		partType, _ := part["type"].(string)
@@ -436,6 +494,10 @@ func applyResponsesEventToAnthropic(
 	case "response.output_item.added":
 		item, _ := event["item"].(map[string]interface{})
 		itemType, _ := item["type"].(string)
+		if itemType == "reasoning" {
+			_, err := openResponsesReasoningBlock(w, responseOutputIndex(event), state)
+			return err
+		}
 		if itemType != "function_call" {
 			return nil
 		}
@@ -503,14 +565,111 @@ func applyResponsesEventToAnthropic(
 			"type":  "content_block_stop",
 			"index": idx,
 		})
-	case "response.completed":
+	case "response.reasoning_summary_part.added":
+		outputIndex := responseOutputIndex(event)
+		idx, err := openResponsesReasoningBlock(w, outputIndex, state)
+		if err != nil {
+			return err
+		}
+		// Separate consecutive summary parts the way Codex CLI renders them.
+		if summaryIndex, ok := event["summary_index"].(float64); ok && summaryIndex > 0 {
+			return writeThinkingDelta(w, idx, "\n\n")
+		}
+		return nil
+	case "response.reasoning_summary_text.delta":
+		idx, err := openResponsesReasoningBlock(w, responseOutputIndex(event), state)
+		if err != nil {
+			return err
+		}
+		delta, _ := event["delta"].(string)
+		if delta == "" {
+			return nil
+		}
+		return writeThinkingDelta(w, idx, delta)
+	case "response.output_item.done":
+		item, _ := event["item"].(map[string]interface{})
+		if itemType, _ := item["type"].(string); itemType != "reasoning" {
+			return nil
+		}
+		idx, ok := state.reasoningBlocks[responseOutputIndex(event)]
+		if !ok || !state.openBlocks[idx] {
+			return nil
+		}
+		if encrypted, _ := item["encrypted_content"].(string); encrypted != "" {
+			if err := writeAnthropicSSEEvent(w, "content_block_delta", map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": idx,
+				"delta": map[string]interface{}{
+					"type":      "signature_delta",
+					"signature": encodeCodexReasoningSignature(encrypted),
+				},
+			}); err != nil {
+				return err
+			}
+		}
+		delete(state.openBlocks, idx)
+		return writeAnthropicSSEEvent(w, "content_block_stop", map[string]interface{}{
+			"type":  "content_block_stop",
+			"index": idx,
+		})
+	case "response.completed", "response.incomplete":
 		updateResponseCompletionState(event, state)
 		return nil
+	case "response.failed", "error":
+		state.failure = responsesEventFailure(event)
+		return nil
 	default:
 		return nil
 	}
 }
 
+// responsesEventFailure classifies a response.failed or error event.
+func responsesEventFailure(event map[string]interface{}) *upstreamError {
+	obj := event
+	if resp, ok := event["response"].(map[string]interface{}); ok {
+		obj = resp
+	}
+	code, errType, message := parseUpstreamErrorObject(obj)
+	if errType == "error" {
+		errType = ""
+	}
+	if message == "" {
+		message = "upstream response failed"
+	}
+	return classifyUpstreamError(0, code, errType, message)
+}
+
+// openResponsesReasoningBlock returns the Anthropic thinking block for the
+// reasoning item at outputIndex, starting it on first use.
+func openResponsesReasoningBlock(w io.Writer, outputIndex int, state *responsesStreamState) (int, error) {
+	if idx, ok := state.reasoningBlocks[outputIndex]; ok {
+		return idx, nil
+	}
+	state.blockIndex++
+	idx := state.blockIndex
+	state.reasoningBlocks[outputIndex] = idx
+	state.openBlocks[idx] = true
+	return idx, writeAnthropicSSEEvent(w, "content_block_start", map[string]interface{}{
+		"type":  "content_block_start",
+		"index": idx,
+		"content_block": map[string]interface{}{
+			"type":     "thinking",
+			"thinking": "",
+		},
+	})
+}
+
+func writeThinkingDelta(w io.Writer, idx int, text string) error {
+	return writeAnthropicSSEEvent(w, "content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": idx,
+		"delta": map[string]interface{}{
+			"type":     "thinking_delta",
+			"thinking": text,
+		},
+	})
+}
+
 func closeOpenResponseBlocks(w io.Writer, state *responsesStreamState) error {
 	indexes := make([]int, 0, len(state.openBlocks))
 	for idx := range state.openBlocks {
@@ -553,9 +712,7 @@ func updateResponseCompletionState(event map[string]interface{}, state *response
 	}
 
 	if usage, ok := resp["usage"].(map[string]interface{}); ok {
-		if v, ok := usage["output_tokens"].(float64); ok {
-			state.outputTokens = int(v)
-		}
+		state.usage = anthropicUsageFromResponses(usage)
 	}
 
 	state.stopReason = "end_turn"
@@ -597,6 +754,7 @@ func convertResponsesJSONToAnthropic(raw []byte, spoofModel string) AnthropicMes
 		return out
 	}
 
+	out.Content = append(out.Content, extractResponseThinking(payload)...)
 	text := extractResponseText(payload)
 	if strings.TrimSpace(text) != "" {
 		out.Content = append(out.Content, AnthropicContentBlock{
@@ -607,18 +765,33 @@ func convertResponsesJSONToAnthropic(raw []byte, spoofModel string) AnthropicMes
 	out.Content = append(out.Content, extractResponseToolUses(payload)...)
 
 	if usage, ok := payload["usage"].(map[string]interface{}); ok {
-		if v, ok := usage["input_tokens"].(float64); ok {
-			out.Usage.InputTokens = int(v)
-		}
-		if v, ok := usage["output_tokens"].(float64); ok {
-			out.Usage.OutputTokens = int(v)
-		}
+		out.Usage = anthropicUsageFromResponses(usage)
 	}
 
 	out.StopReason = determineResponsesStopReason(payload, out.Content)
 	return out
 }
 
+// anthropicUsageFromResponses maps a Responses usage object to Anthropic
+// usage, moving input_tokens_details.cached_tokens out of input_tokens into
+// cache_read_input_tokens.
+func anthropicUsageFromResponses(usage map[string]interface{}) AnthropicUsage {
+	var out AnthropicUsage
+	if v, ok := usage["input_tokens"].(float64); ok {
+		out.InputTokens = int(v)
+	}
+	if v, ok := usage["output_tokens"].(float64); ok {
+		out.OutputTokens = int(v)
+	}
+	if details, ok := usage["input_tokens_details"].(map[string]interface{}); ok {
+		if v, ok := details["cached_tokens"].(float64); ok {
+			out.CacheReadInputTokens = int(v)
+			out.InputTokens -= out.CacheReadInputTokens
+		}
+	}
+	return out
+}
+
 func determineResponsesStopReason(payload map[string]interface{}, content []AnthropicContentBlock) string {
 	for _, block := range content {
 		if block.Type == "tool_use" {
@@ -671,6 +844,67 @@ func extractResponseText(payload map[string]interface{}) string {
 	return strings.Join(parts, "\n")
 }
 
+// extractResponseThinking converts reasoning output items into Anthropic
+// thinking blocks, joining the summary parts of each item.
+func extractResponseThinking(payload map[string]interface{}) []AnthropicContentBlock {
+	output, ok := payload["output"].([]interface{})
+	if !ok {
+		return nil
+	}
+	out := []AnthropicContentBlock{}
+	for _, item := range output {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if itemType, _ := entry["type"].(string); itemType != "reasoning" {
+			continue
+		}
+		parts := []string{}
+		summary, _ := entry["summary"].([]interface{})
+		for _, s := range summary {
+			part, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if text, _ := part["text"].(string); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		encrypted, _ := entry["encrypted_content"].(string)
+		if len(parts) == 0 && encrypted == "" {
+			continue
+		}
+		block := AnthropicContentBlock{
+			Type:     "thinking",
+			Thinking: strings.Join(parts, "\n\n"),
+		}
+		if encrypted != "" {
+			block.Signature = encodeCodexReasoningSignature(encrypted)
+		}
+		out = append(out, block)
+	}
+	return out
+}
+
+// codexReasoningSignaturePrefix marks thinking block signatures that carry
+// Codex encrypted reasoning rather than an Anthropic signature. Since requests
+// are sent with store:false, the encrypted reasoning is handed to the client in
+// the signature and replayed as a reasoning input item on the next turn.
+const codexReasoningSignaturePrefix = "furiwake-codex-reasoning:"
+
+func encodeCodexReasoningSignature(encrypted string) string {
+	return codexReasoningSignaturePrefix + encrypted
+}
+
+func decodeCodexReasoningSignature(signature string) (string, bool) {
+	if !strings.HasPrefix(signature, codexReasoningSignaturePrefix) {
+		return "", false
+	}
+	encrypted := strings.TrimPrefix(signature, codexReasoningSignaturePrefix)
+	return encrypted, encrypted != ""
+}
+
 func extractResponseToolUses(payload map[string]interface{}) []AnthropicContentBlock {
 	output, ok := payload["output"].([]interface{})
 	if !ok {
@@ -718,13 +952,16 @@ func collectResponsesStreamAsJSON(src io.Reader, logger *Logger) ([]byte, error)
 		if err := json.Unmarshal([]byte(data), &event); err != nil {
 			return nil
 		}
-		if t, _ := event["type"].(string); t == "response.completed" {
+		switch t, _ := event["type"].(string); t {
+		case "response.completed", "response.incomplete":
 			if resp, ok := event["response"]; ok {
 				b, err := json.Marshal(resp)
 				if err == nil {
 					responseJSON = b
 				}
 			}
+		case "response.failed", "error":
+			return responsesEventFailure(event)
 		}
 		return nil
 	})
@@ -240,3 +240,228 @@ func TestCloseOpenResponseBlocks_SortedOrder(t *testing.T) {
 		}
 	}
 }
+
+func TestConvertResponsesStreamToAnthropic_ReasoningSummary(t *testing.T) {
+	stream := strings.Join([]string{
+		`data: {"type":"response.created","response":{"id":"resp_1"}}`,
+		"",
+		`data: {"type":"response.output_item.added","output_index":0,"item":{"type":"reasoning","id":"rs_1","summary":[]}}`,
+		"",
+		`data: {"type":"response.reasoning_summary_part.added","output_index":0,"summary_index":0,"part":{"type":"summary_text","text":""}}`,
+		"",
+		`data: {"type":"response.reasoning_summary_text.delta","output_index":0,"summary_index":0,"delta":"Looking at files"}`,
+		"",
+		`data: {"type":"response.reasoning_summary_part.added","output_index":0,"summary_index":1,"part":{"type":"summary_text","text":""}}`,
+		"",
+		`data: {"type":"response.reasoning_summary_text.delta","output_index":0,"summary_index":1,"delta":"Planning edit"}`,
+		"",
+		`data: {"type":"response.output_item.done","output_index":0,"item":{"type":"reasoning","id":"rs_1"}}`,
+		"",
+		`data: {"type":"response.output_text.delta","output_index":1,"content_index":0,"delta":"done"}`,
+		"",
+		`data: {"type":"response.completed","response":{"status":"completed","usage":{"output_tokens":5}}}`,
+		"",
+		"data: [DONE]",
+		"",
+	}, "\n")
+
+	rr := httptest.NewRecorder()
+	if err := convertResponsesStreamToAnthropic(rr, strings.NewReader(stream), "claude-spoof", NewLogger()); err != nil {
+		t.Fatalf("convertResponsesStreamToAnthropic error: %v", err)
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, `"content_block":{"thinking":"","type":"thinking"},"index":0`) {
+		t.Fatalf("expected thinking block at index 0: %s", body)
+	}
+	if !strings.Contains(body, `"thinking":"Looking at files","type":"thinking_delta"`) {
+		t.Fatalf("expected thinking_delta: %s", body)
+	}
+	if !strings.Contains(body, `"thinking":"\n\n","type":"thinking_delta"`) {
+		t.Fatalf("expected separator between summary parts: %s", body)
+	}
+	if !strings.Contains(body, `{"index":0,"type":"content_block_stop"}`) {
+		t.Fatalf("expected thinking block to be closed: %s", body)
+	}
+	if !strings.Contains(body, `"content_block":{"text":"","type":"text"},"index":1`) {
+		t.Fatalf("expected text block after thinking: %s", body)
+	}
+}
+
+func TestConvertResponsesJSONToAnthropic_WithReasoning(t *testing.T) {
+	raw := []byte(`{
+	  "status":"completed",
+	  "output":[
+	    {"type":"reasoning","id":"rs_1","summary":[{"type":"summary_text","text":"step one"},{"type":"summary_text","text":"step two"}]},
+	    {"type":"message","content":[{"text":"answer"}]}
+	  ]
+	}`)
+	out := convertResponsesJSONToAnthropic(raw, "claude-spoof")
+	if len(out.Content) != 2 {
+		t.Fatalf("unexpected content blocks: %+v", out.Content)
+	}
+	if out.Content[0].Type != "thinking" || out.Content[0].Thinking != "step one\n\nstep two" {
+		t.Fatalf("unexpected thinking block: %+v", out.Content[0])
+	}
+	if out.Content[1].Type != "text" || out.Content[1].Text != "answer" {
+		t.Fatalf("unexpected text block: %+v", out.Content[1])
+	}
+}
+
+func TestConvertResponsesStreamToAnthropic_ReasoningSignature(t *testing.T) {
+	stream := strings.Join([]string{
+		`data: {"type":"response.output_item.added","output_index":0,"item":{"type":"reasoning","id":"rs_1","summary":[]}}`,
+		"",
+		`data: {"type":"response.output_item.done","output_index":0,"item":{"type":"reasoning","id":"rs_1","summary":[],"encrypted_content":"gAAAAB-secret"}}`,
+		"",
+		"data: [DONE]",
+		"",
+	}, "\n")
+
+	rr := httptest.NewRecorder()
+	if err := convertResponsesStreamToAnthropic(rr, strings.NewReader(stream), "claude-spoof", NewLogger()); err != nil {
+		t.Fatalf("convertResponsesStreamToAnthropic error: %v", err)
+	}
+	body := rr.Body.String()
+	want := `"signature":"` + codexReasoningSignaturePrefix + `gAAAAB-secret","type":"signature_delta"`
+	if !strings.Contains(body, want) {
+		t.Fatalf("expected signature_delta carrying encrypted reasoning: %s", body)
+	}
+	if strings.Index(body, "signature_delta") > strings.Index(body, `{"index":0,"type":"content_block_stop"}`) {
+		t.Fatalf("signature_delta must precede content_block_stop: %s", body)
+	}
+}
+
+func TestConvertResponsesJSONToAnthropic_ReasoningSignature(t *testing.T) {
+	raw := []byte(`{"output":[{"type":"reasoning","summary":[{"type":"summary_text","text":"hmm"}],"encrypted_content":"enc"}]}`)
+	out := convertResponsesJSONToAnthropic(raw, "claude-spoof")
+	if len(out.Content) != 1 || out.Content[0].Signature != codexReasoningSignaturePrefix+"enc" {
+		t.Fatalf("unexpected thinking block: %+v", out.Content)
+	}
+}
+
+func TestTranslateAnthropicToResponses_ReplaysEncryptedReasoning(t *testing.T) {
+	req := AnthropicMessageRequest{
+		Messages: []AnthropicMessage{
+			{Role: "user", Content: "fix it"},
+			{
+				Role: "assistant",
+				Content: []AnthropicContentBlock{
+					{Type: "thinking", Thinking: "inspecting", Signature: codexReasoningSignaturePrefix + "enc-1"},
+					{Type: "thinking", Thinking: "anthropic", Signature: "EqQBCkgIAhABGAIiQL"},
+					{Type: "tool_use", ID: "tool_1", Name: "read", Input: []byte(`{}`)},
+				},
+			},
+		},
+	}
+	out := translateAnthropicToResponses(req, "gpt-5", "", "")
+	if len(out.Input) != 3 {
+		t.Fatalf("unexpected input: %+v", out.Input)
+	}
+	reasoning := out.Input[1]
+	if reasoning.Type != "reasoning" || reasoning.EncryptedContent != "enc-1" {
+		t.Fatalf("expected reasoning item with encrypted content: %+v", reasoning)
+	}
+	b, _ := json.Marshal(reasoning)
+	if !strings.Contains(string(b), `"summary":[{"type":"summary_text","text":"inspecting"}]`) {
+		t.Fatalf("unexpected reasoning item json: %s", b)
+	}
+	if out.Input[2].Type != "function_call" {
+		t.Fatalf("expected function_call after reasoning: %+v", out.Input[2])
+	}
+
+	b, _ = json.Marshal(out.Input[0])
+	if strings.Contains(string(b), "summary") {
+		t.Fatalf("summary must be omitted on message items: %s", b)
+	}
+}
+
+func TestTranslateAnthropicToResponses_ImagesAndDocuments(t *testing.T) {
+	req := AnthropicMessageRequest{
+		Messages: []AnthropicMessage{
+			{
+				Role: "user",
+				Content: []AnthropicContentBlock{
+					{Type: "text", Text: "review"},
+					{Type: "image", Source: &AnthropicSource{Type: "base64", MediaType: "image/png", Data: "iVBOR"}},
+					{Type: "document", Source: &AnthropicSource{Type: "url", URL: "https://example.com/a.pdf"}},
+				},
+			},
+			{
+				Role: "user",
+				Content: []AnthropicContentBlock{
+					{Type: "tool_result", ToolUseID: "tool_1", Content: []AnthropicContentBlock{
+						{Type: "image", Source: &AnthropicSource{Type: "url", URL: "https://example.com/shot.png"}},
+					}},
+				},
+			},
+		},
+	}
+	out := translateAnthropicToResponses(req, "gpt-5", "", "")
+	if len(out.Input) != 3 {
+		t.Fatalf("unexpected input: %+v", out.Input)
+	}
+	parts, ok := out.Input[0].Content.([]ResponsesContentPart)
+	if !ok || len(parts) != 3 {
+		t.Fatalf("expected multi-part content, got %#v", out.Input[0].Content)
+	}
+	if parts[1].Type != "input_image" || parts[1].ImageURL != "data:image/png;base64,iVBOR" {
+		t.Fatalf("unexpected image part: %+v", parts[1])
+	}
+	if parts[2].Type != "input_file" || parts[2].FileURL != "https://example.com/a.pdf" {
+		t.Fatalf("unexpected file part: %+v", parts[2])
+	}
+	if out.Input[1].Type != "function_call_output" || out.Input[1].Output != "(empty)" {
+		t.Fatalf("unexpected tool output: %+v", out.Input[1])
+	}
+	toolParts, ok := out.Input[2].Content.([]ResponsesContentPart)
+	if !ok || len(toolParts) != 1 || toolParts[0].ImageURL != "https://example.com/shot.png" {
+		t.Fatalf("expected tool result image to be kept: %#v", out.Input[2])
+	}
+}
+
+func TestConvertResponsesStreamToAnthropic_ResponseFailed(t *testing.T) {
+	stream := strings.Join([]string{
+		`data: {"type":"response.created","response":{"id":"resp_1"}}`,
+		"",
+		`data: {"type":"response.failed","response":{"id":"resp_1","status":"failed","error":{"code":"context_length_exceeded","message":"Your input exceeds the context window"}}}`,
+		"",
+	}, "\n")
+
+	rr := httptest.NewRecorder()
+	err := convertResponsesStreamToAnthropic(rr, strings.NewReader(stream), "claude-spoof", NewLogger())
+	if err == nil {
+		t.Fatalf("expected response.failed to be reported")
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, "event: message_start") || !strings.Contains(body, "event: error") {
+		t.Fatalf("expected message_start followed by error event: %s", body)
+	}
+	if !strings.Contains(body, `"message":"prompt is too long: Your input exceeds the context window"`) {
+		t.Fatalf("context window failure should map to prompt is too long: %s", body)
+	}
+}
+
+func TestConvertResponsesStreamToAnthropic_ReportsInputAndCachedTokens(t *testing.T) {
+	stream := strings.Join([]string{
+		"event: response.output_text.delta",
+		`data: {"type":"response.output_text.delta","output_index":0,"content_index":0,"delta":"hi"}`,
+		"",
+		"event: response.completed",
+		`data: {"type":"response.completed","response":{"status":"completed","usage":{"input_tokens":900,"input_tokens_details":{"cached_tokens":512},"output_tokens":9}}}`,
+		"",
+	}, "\n")
+
+	rr := httptest.NewRecorder()
+	if err := convertResponsesStreamToAnthropic(rr, strings.NewReader(stream), "claude-spoof", NewLogger()); err != nil {
+		t.Fatalf("convertResponsesStreamToAnthropic error: %v", err)
+	}
+	want := `"usage":{"input_tokens":388,"output_tokens":9,"cache_read_input_tokens":512}`
+	if !strings.Contains(rr.Body.String(), want) {
+		t.Fatalf("expected %s in message_delta: %s", want, rr.Body.String())
+	}
+
+	out := convertResponsesJSONToAnthropic([]byte(`{"output_text":"ok","usage":{"input_tokens":40,"input_tokens_details":{"cached_tokens":32},"output_tokens":2}}`), "claude-spoof")
+	if out.Usage != (AnthropicUsage{InputTokens: 8, OutputTokens: 2, CacheReadInputTokens: 32}) {
+		t.Fatalf("unexpected non-stream usage: %+v", out.Usage)
+	}
+}
@@ -59,34 +59,42 @@ func translateUserMessage(message AnthropicMessage) []OpenAIMessage {
 	}
 
 	blocks := normalizeContentToBlocks(message.Content)
-	textParts := []string{}
+	parts := []OpenAIContentPart{}
 	out := []OpenAIMessage{}
-	flushText := func() {
-		if len(textParts) == 0 {
+	flushParts := func() {
+		if len(parts) == 0 {
 			return
 		}
 		out = append(out, OpenAIMessage{
 			Role:    "user",
-			Content: strings.Join(textParts, "\n"),
+			Content: openAIUserContent(parts),
 		})
-		textParts = textParts[:0]
+		parts = parts[:0]
 	}
 	for _, block := range blocks {
 		switch block.Type {
 		case "text":
 			if strings.TrimSpace(block.Text) != "" {
-				textParts = append(textParts, block.Text)
+				parts = append(parts, OpenAIContentPart{Type: "text", Text: block.Text})
 			}
+		case "image", "document":
+			parts = append(parts, translateMediaBlockToOpenAI(block))
 		case "tool_result":
-			flushText()
+			flushParts()
 			out = append(out, OpenAIMessage{
 				Role:       "tool",
 				ToolCallID: block.ToolUseID,
 				Content:    extractToolResultText(block.Content),
 			})
+			// Tool messages only carry text, so images and documents returned
+			// by a tool follow in a separate user message.
+			for _, media := range extractToolResultMedia(block.Content) {
+				parts = append(parts, translateMediaBlockToOpenAI(media))
+			}
+			flushParts()
 		}
 	}
-	flushText()
+	flushParts()
 	if len(out) == 0 {
 		out = append(out, OpenAIMessage{
 			Role:    "user",
@@ -96,6 +104,54 @@ func translateUserMessage(message AnthropicMessage) []OpenAIMessage {
 	return out
 }
 
+// openAIUserContent collapses text-only parts into a plain string and keeps
+// the multi-part form when images or files are present.
+func openAIUserContent(parts []OpenAIContentPart) interface{} {
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type != "text" {
+			out := make([]OpenAIContentPart, len(parts))
+			copy(out, parts)
+			return out
+		}
+		texts = append(texts, part.Text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+// translateMediaBlockToOpenAI maps an Anthropic image or document block to a
+// Chat Completions content part. Sources Chat Completions cannot carry are
+// replaced by a short text note rather than dropped.
+func translateMediaBlockToOpenAI(block AnthropicContentBlock) OpenAIContentPart {
+	src := block.Source
+	if src == nil {
+		return OpenAIContentPart{Type: "text", Text: mediaPlaceholder(block)}
+	}
+	if block.Type == "image" {
+		if url := anthropicSourceURL(src); url != "" {
+			return OpenAIContentPart{Type: "image_url", ImageURL: &OpenAIImageURL{URL: url}}
+		}
+		return OpenAIContentPart{Type: "text", Text: mediaPlaceholder(block)}
+	}
+
+	switch src.Type {
+	case "base64":
+		return OpenAIContentPart{
+			Type: "file",
+			File: &OpenAIFile{
+				Filename: documentFilename(block),
+				FileData: anthropicSourceURL(src),
+			},
+		}
+	case "text":
+		return OpenAIContentPart{Type: "text", Text: src.Data}
+	case "content":
+		return OpenAIContentPart{Type: "text", Text: normalizeContentToText(src.Content)}
+	default:
+		return OpenAIContentPart{Type: "text", Text: mediaPlaceholder(block)}
+	}
+}
+
 func translateAssistantMessage(message AnthropicMessage) []OpenAIMessage {
 	if text, ok := message.Content.(string); ok {
 		return []OpenAIMessage{{Role: "assistant", Content: text}}
@@ -130,12 +186,13 @@ func translateAssistantMessage(message AnthropicMessage) []OpenAIMessage {
 		}
 	}
 
-	content := strings.Join(textParts, "\n")
 	out := OpenAIMessage{
 		Role:      "assistant",
-		Content:   content,
 		ToolCalls: toolCalls,
 	}
+	if content := strings.Join(textParts, "\n"); content != "" {
+		out.Content = content
+	}
 	return []OpenAIMessage{out}
 }
 
@@ -205,3 +262,95 @@ func extractToolResultText(content interface{}) string {
 	}
 	return strings.Join(parts, "\n")
 }
+
+// extractToolResultMedia returns the image and document blocks nested in a
+// tool_result's content.
+func extractToolResultMedia(content interface{}) []AnthropicContentBlock {
+	if _, ok := content.(string); ok || content == nil {
+		return nil
+	}
+	out := []AnthropicContentBlock{}
+	for _, block := range normalizeContentToBlocks(content) {
+		if block.Type == "image" || block.Type == "document" {
+			out = append(out, block)
+		}
+	}
+	return out
+}
+
+// anthropicSourceURL returns a URL for a base64 or url source, encoding
+// base64 data as a data: URL.
+func anthropicSourceURL(src *AnthropicSource) string {
+	switch src.Type {
+	case "base64":
+		if src.Data == "" {
+			return ""
+		}
+		mediaType := src.MediaType
+		if mediaType == "" {
+			mediaType = "application/octet-stream"
+		}
+		return "data:" + mediaType + ";base64," + src.Data
+	case "url":
+		return src.URL
+	default:
+		return ""
+	}
+}
+
+func documentFilename(block AnthropicContentBlock) string {
+	name := strings.TrimSpace(block.Title)
+	if name == "" {
+		name = "document"
+	}
+	if block.Source != nil && block.Source.MediaType == "application/pdf" && !strings.HasSuffix(strings.ToLower(name), ".pdf") {
+		name += ".pdf"
+	}
+	return name
+}
+
+func mediaPlaceholder(block AnthropicContentBlock) string {
+	desc := block.Type
+	if block.Source != nil {
+		if block.Source.URL != "" {
+			return fmt.Sprintf("[%s: %s]", desc, block.Source.URL)
+		}
+		if block.Source.MediaType != "" {
+			desc += " " + block.Source.MediaType
+		}
+	}
+	return fmt.Sprintf("[%s omitted: not supported by this provider]", desc)
+}
+
+// openAIContentText returns the text of an OpenAI message content, which may
+// be a string or an array of content parts.
+func openAIContentText(content interface{}) string {
+	switch v := content.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []OpenAIContentPart:
+		parts := []string{}
+		for _, part := range v {
+			if part.Type == "text" && part.Text != "" {
+				parts = append(parts, part.Text)
+			}
+		}
+		return strings.Join(parts, "\n")
+	case []interface{}:
+		parts := []string{}
+		for _, item := range v {
+			part, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if text, _ := part["text"].(string); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, "\n")
+	default:
+		return ""
+	}
+}
@@ -88,3 +88,65 @@ func TestTranslateMessagesToOpenAI_UserToolResultOrder(t *testing.T) {
 		t.Fatalf("unexpected third message: %+v", out[2])
 	}
 }
+
+func TestTranslateMessagesToOpenAI_ImagesAndDocuments(t *testing.T) {
+	messages := []AnthropicMessage{
+		{
+			Role: "user",
+			Content: []AnthropicContentBlock{
+				{Type: "text", Text: "what is this?"},
+				{Type: "image", Source: &AnthropicSource{Type: "base64", MediaType: "image/png", Data: "iVBOR"}},
+				{Type: "image", Source: &AnthropicSource{Type: "url", URL: "https://example.com/a.jpg"}},
+				{Type: "document", Title: "spec", Source: &AnthropicSource{Type: "base64", MediaType: "application/pdf", Data: "JVBER"}},
+			},
+		},
+	}
+
+	out := TranslateMessagesToOpenAI(nil, messages)
+	if len(out) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(out))
+	}
+	parts, ok := out[0].Content.([]OpenAIContentPart)
+	if !ok || len(parts) != 4 {
+		t.Fatalf("expected 4 content parts, got %#v", out[0].Content)
+	}
+	if parts[1].Type != "image_url" || parts[1].ImageURL.URL != "data:image/png;base64,iVBOR" {
+		t.Fatalf("unexpected base64 image part: %+v", parts[1])
+	}
+	if parts[2].ImageURL == nil || parts[2].ImageURL.URL != "https://example.com/a.jpg" {
+		t.Fatalf("unexpected url image part: %+v", parts[2])
+	}
+	if parts[3].Type != "file" || parts[3].File.Filename != "spec.pdf" || parts[3].File.FileData != "data:application/pdf;base64,JVBER" {
+		t.Fatalf("unexpected document part: %+v", parts[3])
+	}
+}
+
+func TestTranslateMessagesToOpenAI_ToolResultImage(t *testing.T) {
+	messages := []AnthropicMessage{
+		{
+			Role: "user",
+			Content: []AnthropicContentBlock{
+				{
+					Type:      "tool_result",
+					ToolUseID: "tool_1",
+					Content: []interface{}{
+						map[string]interface{}{"type": "text", "text": "screenshot taken"},
+						map[string]interface{}{"type": "image", "source": map[string]interface{}{"type": "base64", "media_type": "image/jpeg", "data": "/9j/"}},
+					},
+				},
+			},
+		},
+	}
+
+	out := TranslateMessagesToOpenAI(nil, messages)
+	if len(out) != 2 {
+		t.Fatalf("expected tool + user messages, got %+v", out)
+	}
+	if out[0].Role != "tool" || out[0].Content != "screenshot taken" {
+		t.Fatalf("unexpected tool message: %+v", out[0])
+	}
+	parts, ok := out[1].Content.([]OpenAIContentPart)
+	if out[1].Role != "user" || !ok || len(parts) != 1 || parts[0].ImageURL.URL != "data:image/jpeg;base64,/9j/" {
+		t.Fatalf("unexpected image follow-up message: %#v", out[1])
+	}
+}
@@ -11,71 +11,68 @@ import (
 	"time"
 )
 
-func (s *Server) proxyOpenAI(
-	ctx context.Context,
-	w http.ResponseWriter,
-	routeName string,
-	provider ProviderConfig,
-	model string,
-	reasoningEffort string,
-	anthropicReq AnthropicMessageRequest,
-	incomingHeaders http.Header,
-) {
-	openAIReq := TranslateAnthropicToOpenAI(anthropicReq, model)
+// openAIProvider translates Anthropic Messages requests to the OpenAI Chat
+// Completions API.
+type openAIProvider struct{}
+
+func (openAIProvider) Validate(name string, cfg ProviderConfig) error {
+	return requireProviderModel(name, cfg)
+}
+
+func (openAIProvider) TranslateRequest(call *ProviderCall) ([]byte, error) {
+	openAIReq := TranslateAnthropicToOpenAI(call.Request, call.Route.Model)
 	payload, err := json.Marshal(openAIReq)
 	if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, "failed to encode upstream request")
-		return
+		return nil, fmt.Errorf("failed to encode upstream request")
 	}
+	return payload, nil
+}
 
-	resp, err := s.doProviderRequestWithRetry(
+func (openAIProvider) Send(ctx context.Context, call *ProviderCall, payload []byte) (*http.Response, error) {
+	return call.Server.doProviderRequestWithRetry(
 		ctx,
 		http.MethodPost,
-		provider.URL,
+		call.Route.Provider.URL,
 		payload,
-		incomingHeaders,
-		provider,
-		anthropicReq.Stream,
-		routeName,
-		openAIReq.Model,
-		reasoningEffort,
+		call.Inbound.Header,
+		call.Route.Provider,
+		call.Request.Stream,
+		call.Route.ProviderName,
+		call.Route.Model,
+		"-",
 		"",
 	)
-	if err != nil {
-		writeJSONError(w, mapTransportError(err), err.Error())
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 400 {
-		raw, _ := io.ReadAll(resp.Body)
-		writeJSON(w, resp.StatusCode, map[string]interface{}{
-			"type":    "error",
-			"message": string(raw),
-		})
-		return
-	}
+}
 
-	if anthropicReq.Stream {
-		if err := convertOpenAIStreamToAnthropic(w, resp.Body, s.cfg.SpoofModel); err != nil {
-			s.logger.Errorf("openai stream translation failed: %v", err)
-		}
-		return
-	}
+func (openAIProvider) TranslateStream(w http.ResponseWriter, resp *http.Response, call *ProviderCall) error {
+	w, stop := startKeepalive(w, call.Config.PingInterval())
+	defer stop()
+	return convertOpenAIStreamToAnthropic(w, resp.Body, call.Config.SpoofModel)
+}
 
+func (openAIProvider) TranslateResponse(w http.ResponseWriter, resp *http.Response, call *ProviderCall) error {
 	raw, err := io.ReadAll(resp.Body)
 	if err != nil {
 		writeJSONError(w, http.StatusBadGateway, "failed to read upstream response")
-		return
+		return err
 	}
 
 	var openAIResp OpenAIChatResponse
 	if err := json.Unmarshal(raw, &openAIResp); err != nil {
 		writeJSONError(w, http.StatusBadGateway, "invalid upstream JSON response")
-		return
+		return err
 	}
 
-	writeJSON(w, http.StatusOK, convertOpenAINonStreamToAnthropic(openAIResp, s.cfg.SpoofModel))
+	writeJSON(w, http.StatusOK, convertOpenAINonStreamToAnthropic(openAIResp, call.Config.SpoofModel))
+	return nil
+}
+
+func (openAIProvider) TranslateError(w http.ResponseWriter, resp *http.Response, _ *ProviderCall) {
+	writeAnthropicUpstreamError(w, resp)
+}
+
+func (openAIProvider) CountTokens(_ context.Context, w http.ResponseWriter, call *ProviderCall) {
+	writeTokenCount(w, call)
 }
 
 type trackedToolCall struct {
@@ -121,7 +118,8 @@ func convertOpenAIStreamToAnthropic(w http.ResponseWriter, src io.Reader, spoofM
 	activeToolCalls := map[int]*trackedToolCall{}
 	openBlocks := map[int]bool{}
 	stopReason := "end_turn"
-	outputTokens := 0
+	var usage AnthropicUsage
+	var streamErr *upstreamError
 
 	closeBlock := func(index int) error {
 		if !openBlocks[index] {
@@ -147,8 +145,12 @@ func convertOpenAIStreamToAnthropic(w http.ResponseWriter, src io.Reader, spoofM
 		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
 			return nil
 		}
-		if chunk.Usage.CompletionTokens > 0 {
-			outputTokens = chunk.Usage.CompletionTokens
+		if chunk.Error != nil {
+			streamErr = classifyUpstreamError(0, stringifyErrorField(chunk.Error.Code), chunk.Error.Type, chunk.Error.Message)
+			return errSSEStreamDone
+		}
+		if chunk.Usage.PromptTokens > 0 || chunk.Usage.CompletionTokens > 0 {
+			usage = anthropicUsageFromOpenAI(chunk.Usage)
 		}
 		if len(chunk.Choices) == 0 {
 			return nil
@@ -261,7 +263,10 @@ func convertOpenAIStreamToAnthropic(w http.ResponseWriter, src io.Reader, spoofM
 		}
 		return nil
 	}); err != nil {
-		return err
+		return failAnthropicStream(w, flusher, &upstreamError{Status: http.StatusBadGateway, Type: AnthropicErrAPI, Message: "upstream stream interrupted: " + err.Error()})
+	}
+	if streamErr != nil {
+		return failAnthropicStream(w, flusher, streamErr)
 	}
 
 	if activeTextIndex >= 0 {
@@ -286,9 +291,7 @@ func convertOpenAIStreamToAnthropic(w http.ResponseWriter, src io.Reader, spoofM
 			"stop_reason":   stopReason,
 			"stop_sequence": nil,
 		},
-		"usage": map[string]int{
-			"output_tokens": outputTokens,
-		},
+		"usage": usage,
 	}); err != nil {
 		return err
 	}
@@ -301,16 +304,23 @@ func convertOpenAIStreamToAnthropic(w http.ResponseWriter, src io.Reader, spoofM
 	return nil
 }
 
+// failAnthropicStream ends an Anthropic SSE stream with an error event in
+// place of message_delta/message_stop, and returns the failure for logging.
+func failAnthropicStream(w io.Writer, flusher http.Flusher, failure *upstreamError) error {
+	if err := writeAnthropicStreamError(w, failure.Type, failure.Message); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return failure
+}
+
 func convertOpenAINonStreamToAnthropic(resp OpenAIChatResponse, spoofModel string) AnthropicMessageResponse {
 	out := AnthropicMessageResponse{
 		ID:    fmt.Sprintf("msg_%d", time.Now().UnixNano()),
 		Type:  "message",
 		Role:  "assistant",
 		Model: spoofModel,
-		Usage: AnthropicUsage{
-			InputTokens:  resp.Usage.PromptTokens,
-			OutputTokens: resp.Usage.CompletionTokens,
-		},
+		Usage: anthropicUsageFromOpenAI(resp.Usage),
 	}
 
 	if len(resp.Choices) == 0 {
@@ -318,10 +328,10 @@ func convertOpenAINonStreamToAnthropic(resp OpenAIChatResponse, spoofModel strin
 	}
 
 	message := resp.Choices[0].Message
-	if strings.TrimSpace(message.Content) != "" {
+	if text := openAIContentText(message.Content); strings.TrimSpace(text) != "" {
 		out.Content = append(out.Content, AnthropicContentBlock{
 			Type: "text",
-			Text: message.Content,
+			Text: text,
 		})
 	}
 	for _, tc := range message.ToolCalls {
@@ -337,6 +347,18 @@ func convertOpenAINonStreamToAnthropic(resp OpenAIChatResponse, spoofModel strin
 	return out
 }
 
+// anthropicUsageFromOpenAI maps Chat Completions usage to Anthropic usage.
+// OpenAI counts cached tokens inside prompt_tokens, while Anthropic reports
+// them apart from input_tokens as cache_read_input_tokens.
+func anthropicUsageFromOpenAI(u OpenAIUsage) AnthropicUsage {
+	out := AnthropicUsage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens}
+	if u.PromptTokensDetails != nil {
+		out.CacheReadInputTokens = u.PromptTokensDetails.CachedTokens
+		out.InputTokens -= out.CacheReadInputTokens
+	}
+	return out
+}
+
 func safeJSONRawMessage(raw string) json.RawMessage {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
@@ -353,13 +375,9 @@ func writeAnthropicSSEEvent(w io.Writer, event string, payload interface{}) erro
 	if err != nil {
 		return err
 	}
-	if _, err := fmt.Fprintf(w, "event: %s\n", event); err != nil {
-		return err
-	}
-	if _, err := fmt.Fprintf(w, "data: %s\n\n", string(b)); err != nil {
-		return err
-	}
-	return nil
+	// One write per event, so keepalive pings never land inside an event.
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
 }
 
 func mapFinishReason(v string) string {
@@ -145,3 +145,54 @@ func TestConvertOpenAIStreamToAnthropic_MultiLineDataEvent(t *testing.T) {
 		t.Fatalf("missing usage translation: %s", body)
 	}
 }
+
+func TestConvertOpenAIStreamToAnthropic_ErrorChunk(t *testing.T) {
+	stream := strings.Join([]string{
+		`data: {"choices":[{"delta":{"content":"hel"}}]}`,
+		"",
+		`data: {"error":{"message":"model overloaded","type":"server_error","code":"server_is_overloaded"}}`,
+		"",
+	}, "\n")
+
+	rr := httptest.NewRecorder()
+	err := convertOpenAIStreamToAnthropic(rr, strings.NewReader(stream), "claude-spoof")
+	if err == nil {
+		t.Fatalf("expected stream error to be reported")
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, "event: error") || !strings.Contains(body, `"type":"overloaded_error"`) {
+		t.Fatalf("missing Anthropic error event: %s", body)
+	}
+	if strings.Contains(body, "message_stop") {
+		t.Fatalf("failed stream must not end with message_stop: %s", body)
+	}
+}
+
+func TestConvertOpenAIStreamToAnthropic_ReportsPromptAndCachedTokens(t *testing.T) {
+	stream := strings.Join([]string{
+		`data: {"choices":[{"delta":{"content":"hi"}}]}`,
+		"",
+		`data: {"choices":[{"delta":{},"finish_reason":"stop"}]}`,
+		"",
+		`data: {"choices":[],"usage":{"prompt_tokens":1200,"completion_tokens":7,"prompt_tokens_details":{"cached_tokens":1000}}}`,
+		"",
+		`data: [DONE]`,
+		"",
+	}, "\n")
+
+	rr := httptest.NewRecorder()
+	if err := convertOpenAIStreamToAnthropic(rr, strings.NewReader(stream), "claude-spoof"); err != nil {
+		t.Fatalf("convertOpenAIStreamToAnthropic error: %v", err)
+	}
+	want := `"usage":{"input_tokens":200,"output_tokens":7,"cache_read_input_tokens":1000}`
+	if !strings.Contains(rr.Body.String(), want) {
+		t.Fatalf("expected %s in message_delta: %s", want, rr.Body.String())
+	}
+
+	out := convertOpenAINonStreamToAnthropic(OpenAIChatResponse{
+		Usage: OpenAIUsage{PromptTokens: 50, CompletionTokens: 5, PromptTokensDetails: &OpenAIPromptTokensDetails{CachedTokens: 30}},
+	}, "claude-spoof")
+	if out.Usage != (AnthropicUsage{InputTokens: 20, OutputTokens: 5, CacheReadInputTokens: 30}) {
+		t.Fatalf("unexpected non-stream usage: %+v", out.Usage)
+	}
+}
@@ -6,26 +6,120 @@ const (
 	ProviderTypePassthrough = "passthrough"
 	ProviderTypeOpenAI      = "openai"
 	ProviderTypeChatGPT     = "chatgpt"
+	ProviderTypeAnthropic   = "anthropic"
 
 	AuthTypeNone   = "none"
 	AuthTypeBearer = "bearer"
 	AuthTypeCodex  = "codex"
+	AuthTypeAPIKey = "api_key"
 )
 
 type PresetConfig struct {
-	Provider        string `yaml:"provider"`
-	Model           string `yaml:"model"`
-	ReasoningEffort string `yaml:"reasoning_effort"`
-	ServiceTier     string `yaml:"service_tier"`
+	Provider        string   `yaml:"provider"`
+	Model           string   `yaml:"model"`
+	ReasoningEffort string   `yaml:"reasoning_effort"`
+	ServiceTier     string   `yaml:"service_tier"`
+	Fallback        []string `yaml:"fallback"`
+	// Split sends weighted shares of traffic to other provider/model targets.
+	Split []SplitTarget `yaml:"split"`
+}
+
+// SplitTarget is one weighted arm of a traffic split. An empty Model uses the
+// provider's default model.
+type SplitTarget struct {
+	Provider string `yaml:"provider"`
+	Model    string `yaml:"model"`
+	Weight   int    `yaml:"weight"`
 }
 
 type Config struct {
-	Listen          string                    `yaml:"listen"`
-	SpoofModel      string                    `yaml:"spoof_model"`
-	DefaultProvider string                    `yaml:"default_provider"`
-	TimeoutSeconds  int                       `yaml:"timeout_seconds"`
-	Providers       map[string]ProviderConfig `yaml:"providers"`
-	Presets         map[string]PresetConfig   `yaml:"presets"`
+	Listen          string `yaml:"listen"`
+	SpoofModel      string `yaml:"spoof_model"`
+	DefaultProvider string `yaml:"default_provider"`
+	TimeoutSeconds  int    `yaml:"timeout_seconds"`
+	// PingIntervalSeconds spaces keepalive pings on translated streams; see
+	// Config.PingInterval.
+	PingIntervalSeconds int    `yaml:"ping_interval_seconds"`
+	AuditLog            string `yaml:"audit_log"`
+	// StripMarkers removes routing markers before forwarding; nil means true.
+	StripMarkers *bool                     `yaml:"strip_markers"`
+	Providers    map[string]ProviderConfig `yaml:"providers"`
+	Presets      map[string]PresetConfig   `yaml:"presets"`
+	// Rules are evaluated in order for requests without routing markers.
+	Rules []RuleConfig `yaml:"rules"`
+	// Clients issues proxy API keys; when set, every API request needs one.
+	Clients map[string]ClientConfig `yaml:"clients"`
+	// Usage persists token and cost totals and enforces spending budgets.
+	Usage UsageConfig `yaml:"usage"`
+}
+
+// UsageConfig configures token and cost accounting.
+type UsageConfig struct {
+	// File keeps the totals across restarts; empty keeps them in memory.
+	File    string         `yaml:"file"`
+	Budgets []BudgetConfig `yaml:"budgets"`
+}
+
+// BudgetConfig caps the daily or monthly spend of the requests it covers.
+// Empty Providers, Presets or Clients lists match any.
+type BudgetConfig struct {
+	Name      string   `yaml:"name"`
+	Period    string   `yaml:"period"`
+	LimitUSD  float64  `yaml:"limit_usd"`
+	Providers []string `yaml:"providers"`
+	Presets   []string `yaml:"presets"`
+	Clients   []string `yaml:"clients"`
+	// Fallback names the provider used once the budget is spent; without it
+	// requests are refused with a 429.
+	Fallback string `yaml:"fallback"`
+}
+
+// ModelPrice is the USD price per million tokens of one model. CachedInput
+// defaults to Input.
+type ModelPrice struct {
+	Input       float64  `yaml:"input"`
+	Output      float64  `yaml:"output"`
+	CachedInput *float64 `yaml:"cached_input"`
+}
+
+// ClientConfig is a named client identity and its proxy API key. Empty
+// Providers or Presets lists allow any.
+type ClientConfig struct {
+	Key string `yaml:"key"`
+	// KeyEnv names an environment variable holding the key instead.
+	KeyEnv    string   `yaml:"key_env"`
+	Providers []string `yaml:"providers"`
+	Presets   []string `yaml:"presets"`
+
+	key string
+}
+
+// RuleConfig routes requests that match all of its conditions to a provider,
+// model and/or preset.
+type RuleConfig struct {
+	Name     string    `yaml:"name"`
+	Match    RuleMatch `yaml:"match"`
+	Provider string    `yaml:"provider"`
+	Model    string    `yaml:"model"`
+	Preset   string    `yaml:"preset"`
+
+	compiled *compiledRule
+}
+
+// RuleMatch lists the conditions of a rule; empty fields match everything.
+type RuleMatch struct {
+	// Model is a glob (*, ?) on the requested model name, case-insensitive.
+	Model string `yaml:"model"`
+	// System is a regular expression on the system prompt text.
+	System string `yaml:"system"`
+	// Tools must all be offered by the request.
+	Tools          []string `yaml:"tools"`
+	MinInputTokens int      `yaml:"min_input_tokens"`
+	MaxInputTokens int      `yaml:"max_input_tokens"`
+	// Headers maps request header names to globs on their value.
+	Headers map[string]string `yaml:"headers"`
+	// Source lists client addresses as IPs or CIDR ranges.
+	Source []string `yaml:"source"`
 }
 
 type ProviderConfig struct {
@@ -34,7 +128,88 @@ type ProviderConfig struct {
 	Model           string     `yaml:"model"`
 	ReasoningEffort string     `yaml:"reasoning_effort"`
 	ServiceTier     string     `yaml:"service_tier"`
+	Fallback        []string   `yaml:"fallback"`
 	Auth            AuthConfig `yaml:"auth"`
+	// AnthropicBeta rewrites the anthropic-beta header on relaying providers.
+	AnthropicBeta AnthropicBetaConfig `yaml:"anthropic_beta"`
+	// Split sends weighted shares of this route's traffic to other targets.
+	Split []SplitTarget `yaml:"split"`
+	// Retry is the policy for retrying failed upstream requests.
+	Retry RetryConfig `yaml:"retry"`
+	// Timeouts bounds each phase of an upstream request.
+	Timeouts TimeoutConfig `yaml:"timeouts"`
+	// Circuit stops sending requests to the provider after repeated failures.
+	Circuit CircuitConfig `yaml:"circuit"`
+	// Limits queues requests beyond the provider's concurrency or rate.
+	Limits LimitConfig `yaml:"limits"`
+	// Pricing maps model names to prices; "*" covers models not listed.
+	Pricing map[string]ModelPrice `yaml:"pricing"`
+}
+
+// LimitConfig smooths bursts of traffic to a provider. Zero values are
+// unlimited, except the queue defaults of 64 waiters and 60 seconds.
+type LimitConfig struct {
+	// MaxConcurrent caps in-flight requests, streams included.
+	MaxConcurrent int `yaml:"max_concurrent"`
+	// QueueSize bounds the requests waiting for a slot or rate budget.
+	QueueSize int `yaml:"queue_size"`
+	// QueueTimeoutSeconds is the longest a request waits before a 429.
+	QueueTimeoutSeconds int `yaml:"queue_timeout_seconds"`
+	RequestsPerMinute   int `yaml:"requests_per_minute"`
+	// TokensPerMinute budgets estimated input tokens.
+	TokensPerMinute int `yaml:"tokens_per_minute"`
+}
+
+// CircuitConfig tunes a provider's circuit breaker.
+type CircuitConfig struct {
+	// FailureThreshold consecutive failed requests open the circuit; 0 uses
+	// the default of 5 and a negative value disables the breaker.
+	FailureThreshold int `yaml:"failure_threshold"`
+	// CooldownSeconds is how long an open circuit rejects requests before one
+	// probe is let through (default 30).
+	CooldownSeconds int `yaml:"cooldown_seconds"`
+}
+
+// TimeoutConfig bounds the phases of one upstream request. Zero values take
+// the defaults set by LoadConfig; zero at request time means no limit.
+type TimeoutConfig struct {
+	// ConnectSeconds covers dialing and the TLS handshake.
+	ConnectSeconds int `yaml:"connect_seconds"`
+	// FirstByteSeconds is the wait for response headers once connected.
+	FirstByteSeconds int `yaml:"first_byte_seconds"`
+	// IdleSeconds is the longest gap between reads of the response body,
+	// e.g. between SSE events.
+	IdleSeconds int `yaml:"idle_seconds"`
+	// TotalSeconds optionally caps the whole request, body included.
+	TotalSeconds int `yaml:"total_seconds"`
+}
+
+// RetryConfig controls how upstream requests are retried. Zero values use
+// the defaults: 6 attempts, statuses 429/500/502/503/504/529, 250ms base
+// delay doubling up to 10s, 20% jitter, honouring Retry-After, and a 2 minute
+// deadline.
+type RetryConfig struct {
+	// MaxAttempts counts the first request; 1 disables retries.
+	MaxAttempts int   `yaml:"max_attempts"`
+	Statuses    []int `yaml:"statuses"`
+	BaseDelayMS int   `yaml:"base_delay_ms"`
+	MaxDelayMS  int   `yaml:"max_delay_ms"`
+	// Jitter spreads each backoff delay by up to this fraction either way.
+	Jitter *float64 `yaml:"jitter"`
+	// RetryAfter honours Retry-After and x-ratelimit-reset-* headers; nil
+	// means true.
+	RetryAfter *bool `yaml:"retry_after"`
+	// DeadlineSeconds bounds the total time spent retrying one request.
+	DeadlineSeconds int `yaml:"deadline_seconds"`
+}
+
+// AnthropicBetaConfig filters or overrides the client's anthropic-beta
+// header. Set replaces it outright; otherwise Allow (when non-empty) keeps only
+// the listed betas and Drop removes the listed ones ("*" drops all).
+type AnthropicBetaConfig struct {
+	Set   []string `yaml:"set"`
+	Allow []string `yaml:"allow"`
+	Drop  []string `yaml:"drop"`
 }
 
 type AuthConfig struct {
@@ -44,6 +219,7 @@ type AuthConfig struct {
 
 type AnthropicMessageRequest struct {
 	Model      string             `json:"model"`
+	Metadata   *AnthropicMetadata `json:"metadata,omitempty"`
 	MaxTokens  int                `json:"max_tokens,omitempty"`
 	System     interface{}        `json:"system,omitempty"`
 	Messages   []AnthropicMessage `json:"messages"`
@@ -52,19 +228,36 @@ type AnthropicMessageRequest struct {
 	ToolChoice interface{}        `json:"tool_choice,omitempty"`
 }
 
+type AnthropicMetadata struct {
+	UserID string `json:"user_id,omitempty"`
+}
+
 type AnthropicMessage struct {
 	Role    string      `json:"role"`
 	Content interface{} `json:"content"`
 }
 
 type AnthropicContentBlock struct {
-	Type      string          `json:"type"`
-	Text      string          `json:"text,omitempty"`
-	ID        string          `json:"id,omitempty"`
-	Name      string          `json:"name,omitempty"`
-	Input     json.RawMessage `json:"input,omitempty"`
-	ToolUseID string          `json:"tool_use_id,omitempty"`
-	Content   interface{}     `json:"content,omitempty"`
+	Type      string           `json:"type"`
+	Text      string           `json:"text,omitempty"`
+	ID        string           `json:"id,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Input     json.RawMessage  `json:"input,omitempty"`
+	ToolUseID string           `json:"tool_use_id,omitempty"`
+	Content   interface{}      `json:"content,omitempty"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Signature string           `json:"signature,omitempty"`
+	Source    *AnthropicSource `json:"source,omitempty"`
+	Title     string           `json:"title,omitempty"`
+}
+
+// AnthropicSource is the source of an image or document content block.
+type AnthropicSource struct {
+	Type      string      `json:"type"`
+	MediaType string      `json:"media_type,omitempty"`
+	Data      string      `json:"data,omitempty"`
+	URL       string      `json:"url,omitempty"`
+	Content   interface{} `json:"content,omitempty"`
 }
 
 type AnthropicTool struct {
@@ -85,14 +278,43 @@ type AnthropicMessageResponse struct {
 }
 
 type AnthropicUsage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+}
+
+// AnthropicStreamEvent is the union of the Anthropic SSE event payloads,
+// decoded when re-encoding a stream for another client API.
+type AnthropicStreamEvent struct {
+	Type         string                    `json:"type"`
+	Index        int                       `json:"index"`
+	Message      *AnthropicMessageResponse `json:"message,omitempty"`
+	ContentBlock *AnthropicContentBlock    `json:"content_block,omitempty"`
+	Delta        AnthropicStreamDelta      `json:"delta"`
+	Usage        *AnthropicUsage           `json:"usage,omitempty"`
+	Error        *AnthropicErrorDetail     `json:"error,omitempty"`
+}
+
+type AnthropicStreamDelta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	PartialJSON string `json:"partial_json,omitempty"`
+	Thinking    string `json:"thinking,omitempty"`
+	Signature   string `json:"signature,omitempty"`
+	StopReason  string `json:"stop_reason,omitempty"`
+}
+
+type AnthropicErrorDetail struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
 }
 
 type CountTokensRequest struct {
 	Model    string             `json:"model"`
 	System   interface{}        `json:"system,omitempty"`
 	Messages []AnthropicMessage `json:"messages"`
+	Tools    []AnthropicTool    `json:"tools,omitempty"`
 }
 
 type CountTokensResponse struct {
@@ -109,17 +331,47 @@ type OpenAIChatRequest struct {
 	ToolChoice    interface{}          `json:"tool_choice,omitempty"`
 }
 
+// ChatCompletionsRequest is an inbound /v1/chat/completions body. Clients send
+// either max_tokens or its newer name max_completion_tokens.
+type ChatCompletionsRequest struct {
+	Model               string               `json:"model"`
+	Messages            []OpenAIMessage      `json:"messages"`
+	Stream              bool                 `json:"stream,omitempty"`
+	StreamOptions       *OpenAIStreamOptions `json:"stream_options,omitempty"`
+	MaxTokens           int                  `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int                  `json:"max_completion_tokens,omitempty"`
+	Tools               []OpenAITool         `json:"tools,omitempty"`
+	ToolChoice          interface{}          `json:"tool_choice,omitempty"`
+}
+
 type OpenAIStreamOptions struct {
 	IncludeUsage bool `json:"include_usage,omitempty"`
 }
 
 type OpenAIMessage struct {
-	Role       string           `json:"role"`
-	Content    string           `json:"content,omitempty"`
+	Role string `json:"role"`
+	// Content is a string, or []OpenAIContentPart for multi-part user content.
+	Content    interface{}      `json:"content,omitempty"`
 	ToolCallID string           `json:"tool_call_id,omitempty"`
 	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
 }
 
+type OpenAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *OpenAIImageURL `json:"image_url,omitempty"`
+	File     *OpenAIFile     `json:"file,omitempty"`
+}
+
+type OpenAIImageURL struct {
+	URL string `json:"url"`
+}
+
+type OpenAIFile struct {
+	Filename string `json:"filename,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+}
+
 type OpenAITool struct {
 	Type     string                   `json:"type"`
 	Function OpenAIFunctionDefinition `json:"function"`
@@ -145,6 +397,8 @@ type OpenAIToolFunction struct {
 
 type OpenAIChatResponse struct {
 	ID      string         `json:"id"`
+	Object  string         `json:"object,omitempty"`
+	Created int64          `json:"created,omitempty"`
 	Model   string         `json:"model"`
 	Choices []OpenAIChoice `json:"choices"`
 	Usage   OpenAIUsage    `json:"usage"`
@@ -159,6 +413,14 @@ type OpenAIChoice struct {
 type OpenAIUsage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens,omitempty"`
+	// PromptTokensDetails counts the prompt tokens served from the cache;
+	// they are included in PromptTokens.
+	PromptTokensDetails *OpenAIPromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+}
+
+type OpenAIPromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
 }
 
 type OpenAIChatStreamChunk struct {
@@ -166,6 +428,13 @@ type OpenAIChatStreamChunk struct {
 	Model   string               `json:"model"`
 	Choices []OpenAIStreamChoice `json:"choices"`
 	Usage   OpenAIUsage          `json:"usage,omitempty"`
+	Error   *OpenAIError         `json:"error,omitempty"`
+}
+
+type OpenAIError struct {
+	Message string      `json:"message"`
+	Type    string      `json:"type,omitempty"`
+	Code    interface{} `json:"code,omitempty"`
 }
 
 type OpenAIStreamChoice struct {
@@ -194,20 +463,53 @@ type ChatGPTResponsesRequest struct {
 	ServiceTier       string               `json:"service_tier,omitempty"`
 }
 
+// ResponsesRequest is an inbound /v1/responses body. Input is either a string
+// or a list of ResponsesInputItem.
+type ResponsesRequest struct {
+	Model           string           `json:"model"`
+	Instructions    string           `json:"instructions,omitempty"`
+	Input           json.RawMessage  `json:"input"`
+	Tools           []ResponsesTool  `json:"tools,omitempty"`
+	ToolChoice      interface{}      `json:"tool_choice,omitempty"`
+	Reasoning       *ReasoningConfig `json:"reasoning,omitempty"`
+	Stream          bool             `json:"stream,omitempty"`
+	MaxOutputTokens int              `json:"max_output_tokens,omitempty"`
+}
+
 type ReasoningConfig struct {
 	Effort  string `json:"effort,omitempty"`
 	Summary string `json:"summary"`
 }
 
 type ResponsesInputItem struct {
-	Type      string `json:"type"`
-	Role      string `json:"role,omitempty"`
-	Content   string `json:"content,omitempty"`
-	ID        string `json:"id,omitempty"`
-	CallID    string `json:"call_id,omitempty"`
-	Name      string `json:"name,omitempty"`
-	Arguments string `json:"arguments,omitempty"`
-	Output    string `json:"output,omitempty"`
+	Type string `json:"type"`
+	Role string `json:"role,omitempty"`
+	// Content is a string, or []ResponsesContentPart for multi-part content.
+	Content   interface{} `json:"content,omitempty"`
+	ID        string      `json:"id,omitempty"`
+	CallID    string      `json:"call_id,omitempty"`
+	Name      string      `json:"name,omitempty"`
+	Arguments string      `json:"arguments,omitempty"`
+	Output    string      `json:"output,omitempty"`
+	// Summary is required on reasoning items, so it holds a (possibly empty)
+	// []ResponsesSummaryPart there and stays nil elsewhere.
+	Summary          interface{} `json:"summary,omitempty"`
+	EncryptedContent string      `json:"encrypted_content,omitempty"`
+}
+
+type ResponsesContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+	FileURL  string `json:"file_url,omitempty"`
+}
+
+type ResponsesSummaryPart struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
 }
 
 type ResponsesTool struct {
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	budgetDaily   = "daily"
+	budgetMonthly = "monthly"
+
+	usageDayFormat = "2006-01-02"
+)
+
+// normalizeUsage validates the pricing of every provider and the budgets.
+func normalizeUsage(cfg *Config) error {
+	for name, provider := range cfg.Providers {
+		for model, price := range provider.Pricing {
+			if price.Input < 0 || price.Output < 0 || (price.CachedInput != nil && *price.CachedInput < 0) {
+				return fmt.Errorf("providers.%s.pricing.%s must be >= 0", name, model)
+			}
+		}
+	}
+
+	cfg.Usage.File = strings.TrimSpace(cfg.Usage.File)
+	seen := map[string]bool{}
+	for i, budget := range cfg.Usage.Budgets {
+		field := fmt.Sprintf("usage.budgets[%d]", i)
+		budget.Name = strings.TrimSpace(budget.Name)
+		budget.Period = strings.TrimSpace(strings.ToLower(budget.Period))
+		budget.Fallback = strings.TrimSpace(budget.Fallback)
+		if budget.Name == "" {
+			return fmt.Errorf("%s.name is required", field)
+		}
+		if seen[budget.Name] {
+			return fmt.Errorf("%s.name %q is used twice", field, budget.Name)
+		}
+		seen[budget.Name] = true
+		if budget.Period != budgetDaily && budget.Period != budgetMonthly {
+			return fmt.Errorf("%s.period must be daily or monthly", field)
+		}
+		if budget.LimitUSD <= 0 {
+			return fmt.Errorf("%s.limit_usd must be > 0", field)
+		}
+		for _, provider := range budget.Providers {
+			if _, ok := cfg.Providers[provider]; !ok {
+				return fmt.Errorf("%s.providers: %q is not defined in providers", field, provider)
+			}
+		}
+		for _, preset := range budget.Presets {
+			if _, ok := cfg.Presets[preset]; !ok {
+				return fmt.Errorf("%s.presets: %q is not defined in presets", field, preset)
+			}
+		}
+		for _, client := range budget.Clients {
+			if _, ok := cfg.Clients[client]; !ok {
+				return fmt.Errorf("%s.clients: %q is not defined in clients", field, client)
+			}
+		}
+		if budget.Fallback != "" {
+			if _, ok := cfg.Providers[budget.Fallback]; !ok {
+				return fmt.Errorf("%s.fallback %q is not defined in providers", field, budget.Fallback)
+			}
+		}
+		cfg.Usage.Budgets[i] = budget
+	}
+	return nil
+}
+
+// price returns the price of model on the provider, falling back to "*".
+func (p ProviderConfig) price(model string) (ModelPrice, bool) {
+	if price, ok := p.Pricing[model]; ok {
+		return price, true
+	}
+	price, ok := p.Pricing["*"]
+	return price, ok
+}
+
+// cost returns the USD cost of usage at this price. Cache writes are billed
+// as input.
+func (p ModelPrice) cost(usage AnthropicUsage) float64 {
+	cached := p.Input
+	if p.CachedInput != nil {
+		cached = *p.CachedInput
+	}
+	total := float64(usage.InputTokens+usage.CacheCreationInputTokens)*p.Input +
+		float64(usage.CacheReadInputTokens)*cached +
+		float64(usage.OutputTokens)*p.Output
+	return total / 1e6
+}
+
+// UsageEntry is the usage of one route, model, preset and client on one day.
+type UsageEntry struct {
+	Day               string  `json:"day"`
+	Route             string  `json:"route"`
+	Model             string  `json:"model,omitempty"`
+	Preset            string  `json:"preset,omitempty"`
+	Client            string  `json:"client,omitempty"`
+	Requests          int64   `json:"requests"`
+	InputTokens       int64   `json:"input_tokens"`
+	CachedInputTokens int64   `json:"cached_input_tokens"`
+	OutputTokens      int64   `json:"output_tokens"`
+	CostUSD           float64 `json:"cost_usd"`
+}
+
+type usageEntryKey struct {
+	day, route, model, preset, client string
+}
+
+// usageFile is the on-disk form of a UsageStore.
+type usageFile struct {
+	Entries []UsageEntry `json:"entries"`
+}
+
+// usageSaveDelay is how long the usage file may lag behind the totals; the
+// requests completed in that time are saved together.
+const usageSaveDelay = 2 * time.Second
+
+// UsageStore accumulates token usage and cost per day and persists the
+// totals to a JSON file. Saves are batched: the first request after a save
+// schedules the next one usageSaveDelay later, and Flush saves at once.
+type UsageStore struct {
+	mu        sync.Mutex
+	path      string
+	entries   map[usageEntryKey]*UsageEntry
+	dirty     bool
+	saveTimer *time.Timer
+	// errorf reports failed background saves.
+	errorf func(format string, args ...interface{})
+
+	// saveMu serializes snapshots and writes of the file; it is taken
+	// before mu and the file is written outside mu.
+	saveMu sync.Mutex
+}
+
+// OpenUsageStore loads the totals saved at path. A missing file starts empty;
+// an empty path keeps the totals in memory only.
+func OpenUsageStore(path string) (*UsageStore, error) {
+	u := &UsageStore{path: path, entries: map[usageEntryKey]*UsageEntry{}}
+	if path == "" {
+		return u, nil
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return u, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file usageFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, entry := range file.Entries {
+		entry := entry
+		u.entries[entry.key()] = &entry
+	}
+	return u, nil
+}
+
+func (e UsageEntry) key() usageEntryKey {
+	return usageEntryKey{e.Day, e.Route, e.Model, e.Preset, e.Client}
+}
+
+// Add adds one request to the totals of its day and schedules a save.
+func (u *UsageStore) Add(entry UsageEntry) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	total, ok := u.entries[entry.key()]
+	if !ok {
+		total = &UsageEntry{Day: entry.Day, Route: entry.Route, Model: entry.Model, Preset: entry.Preset, Client: entry.Client}
+		u.entries[entry.key()] = total
+	}
+	total.add(entry)
+	if u.path == "" || u.dirty {
+		return
+	}
+	u.dirty = true
+	u.saveTimer = time.AfterFunc(usageSaveDelay, func() {
+		if err := u.Flush(); err != nil && u.errorf != nil {
+			u.errorf("usage file write failed: %v", err)
+		}
+	})
+}
+
+// Flush saves the totals now if they changed since the last save.
+func (u *UsageStore) Flush() error {
+	// Snapshot under saveMu, so an older snapshot can never be written
+	// after a newer one.
+	u.saveMu.Lock()
+	defer u.saveMu.Unlock()
+
+	u.mu.Lock()
+	if !u.dirty {
+		u.mu.Unlock()
+		return nil
+	}
+	u.dirty = false
+	u.saveTimer.Stop()
+	entries := u.entriesLocked()
+	u.mu.Unlock()
+
+	return u.save(entries)
+}
+
+// Entries returns a copy of the totals ordered by day, route, model, preset
+// and client.
+func (u *UsageStore) Entries() []UsageEntry {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.entriesLocked()
+}
+
+func (u *UsageStore) entriesLocked() []UsageEntry {
+	out := make([]UsageEntry, 0, len(u.entries))
+	for _, entry := range u.entries {
+		out = append(out, *entry)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].key(), out[j].key()
+		for _, pair := range [][2]string{{a.day, b.day}, {a.route, b.route}, {a.model, b.model}, {a.preset, b.preset}} {
+			if pair[0] != pair[1] {
+				return pair[0] < pair[1]
+			}
+		}
+		return a.client < b.client
+	})
+	return out
+}
+
+// save writes entries to a temporary file and renames it over the store's
+// file, so a crash never leaves it half written.
+func (u *UsageStore) save(entries []UsageEntry) error {
+	raw, err := json.MarshalIndent(usageFile{Entries: entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := u.path + ".tmp"
+	if err := os.WriteFile(tmp, append(raw, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, u.path)
+}
+
+// Spent returns the cost of the entries budget covers in its period at now.
+func (u *UsageStore) Spent(budget BudgetConfig, now time.Time) float64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var spent float64
+	for _, entry := range u.entries {
+		if budget.covers(entry.Route, entry.Preset, entry.Client) && budget.inPeriod(entry.Day, now) {
+			spent += entry.CostUSD
+		}
+	}
+	return spent
+}
+
+func (b BudgetConfig) covers(route, preset, client string) bool {
+	if len(b.Providers) > 0 && !containsString(b.Providers, route) {
+		return false
+	}
+	if len(b.Presets) > 0 && !containsString(b.Presets, preset) {
+		return false
+	}
+	return len(b.Clients) == 0 || containsString(b.Clients, client)
+}
+
+// inPeriod reports whether day falls in the budget's current day or month.
+func (b BudgetConfig) inPeriod(day string, now time.Time) bool {
+	today := now.Format(usageDayFormat)
+	if b.Period == budgetDaily {
+		return day == today
+	}
+	return strings.HasPrefix(day, today[:len("2006-01")])
+}
+
+// budgetExceededError refuses a request whose budget is spent. It maps to
+// 429 so clients back off.
+type budgetExceededError struct {
+	budget BudgetConfig
+	spent  float64
+}
+
+func (e *budgetExceededError) Error() string {
+	return fmt.Sprintf("%s budget %s exceeded: $%.2f spent of $%.2f", e.budget.Period, e.budget.Name, e.spent, e.budget.LimitUSD)
+}
+
+// exceededBudget returns the first budget covering route whose limit has
+// been reached.
+func (u *UsageStore) exceededBudget(budgets []BudgetConfig, route *RouteResolution, client string, now time.Time) *budgetExceededError {
+	for _, budget := range budgets {
+		if !budget.covers(route.ProviderName, route.PresetName, client) {
+			continue
+		}
+		if spent := u.Spent(budget, now); spent >= budget.LimitUSD {
+			return &budgetExceededError{budget: budget, spent: spent}
+		}
+	}
+	return nil
+}
+
+// budgetRoute returns the route the call may use under the configured
+// budgets: its own, or the fallback of a spent budget. Without a usable
+// fallback the call is refused.
+func (s *Server) budgetRoute(call *ProviderCall) (*RouteResolution, error) {
+	if call.Config == nil || len(call.Config.Usage.Budgets) == 0 {
+		return call.Route, nil
+	}
+	budgets := call.Config.Usage.Budgets
+	client := requestClient(call.Inbound)
+	route := call.Route
+	tried := map[string]bool{route.ProviderName: true}
+	for {
+		exceeded := s.usage.exceededBudget(budgets, route, client, time.Now())
+		if exceeded == nil {
+			return route, nil
+		}
+		next := exceeded.budget.Fallback
+		if next == "" || tried[next] {
+			return nil, exceeded
+		}
+		tried[next] = true
+		fallback, err := ResolveFallback(next, route, call.Config)
+		if err != nil {
+			return nil, exceeded
+		}
+		if err := authorizeRoute(call.Config, call.Inbound, fallback); err != nil {
+			return nil, exceeded
+		}
+		s.logger.Warnf("req=%s route=%s: %s, switching to %s", call.RequestID, route.ProviderName, exceeded, next)
+		route = fallback
+	}
+}
+
+// recordUsage adds a successful request's usage and cost to the store.
+func (s *Server) recordUsage(call *ProviderCall, observed *observedWriter) {
+	if s.usage == nil || call.Route == nil || (observed.status != 0 && observed.status >= 400) || observed.streamFailed {
+		return
+	}
+	route := call.Route
+	usage := observed.finalUsage()
+	model := route.Model
+	if model == "" {
+		model = call.Request.Model
+	}
+	entry := UsageEntry{
+		Day:               observed.start.Format(usageDayFormat),
+		Route:             route.ProviderName,
+		Model:             model,
+		Preset:            route.PresetName,
+		Client:            requestClient(call.Inbound),
+		Requests:          1,
+		InputTokens:       int64(usage.InputTokens + usage.CacheCreationInputTokens),
+		CachedInputTokens: int64(usage.CacheReadInputTokens),
+		OutputTokens:      int64(usage.OutputTokens),
+	}
+	if price, ok := route.Provider.price(model); ok {
+		entry.CostUSD = price.cost(usage)
+	}
+	s.usage.Add(entry)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// usageDimensions are the columns `furiwake usage --by` can group on.
+var usageDimensions = []string{"day", "route", "model", "preset", "client"}
+
+// runUsage implements `furiwake usage [--period day|month|all] [--by a,b]`:
+// it prints the token and cost totals kept in the usage file, grouped by the
+// chosen dimensions, followed by the spend of each budget.
+func runUsage(args []string, now time.Time, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("usage", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "furiwake.yaml", "path to config yaml")
+	file := fs.String("file", "", "usage file to read (default: usage.file from the config)")
+	period := fs.String("period", "month", "totals for the current day, month, or all time")
+	by := fs.String("by", "route,model", "comma-separated columns to group by: "+strings.Join(usageDimensions, ","))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: furiwake usage [--period day|month|all] [--by %s] [--file PATH] [--config PATH]", strings.Join(usageDimensions, ","))
+	}
+
+	var prefix string
+	switch *period {
+	case "day":
+		prefix = now.Format(usageDayFormat)
+	case "month":
+		prefix = now.Format("2006-01")
+	case "all":
+	default:
+		return fmt.Errorf("--period must be day, month or all")
+	}
+	var columns []string
+	for _, column := range strings.Split(*by, ",") {
+		column = strings.TrimSpace(column)
+		if !containsString(usageDimensions, column) {
+			return fmt.Errorf("--by: unknown column %q (use %s)", column, strings.Join(usageDimensions, ","))
+		}
+		columns = append(columns, column)
+	}
+
+	// The config is only needed for the file path and budgets, so a missing
+	// one is fine when --file is given.
+	cfg, cfgErr := LoadConfig(*configPath)
+	path := *file
+	if path == "" {
+		if cfgErr != nil {
+			return fmt.Errorf("config error: %w", cfgErr)
+		}
+		path = cfg.Usage.File
+		if path == "" {
+			return fmt.Errorf("usage.file is not set in %s; pass --file", *configPath)
+		}
+	}
+	store, err := OpenUsageStore(path)
+	if err != nil {
+		return err
+	}
+
+	var rows []UsageEntry
+	index := map[string]int{}
+	var total UsageEntry
+	for _, entry := range store.Entries() {
+		if !strings.HasPrefix(entry.Day, prefix) {
+			continue
+		}
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			values[i] = entry.column(column)
+		}
+		key := strings.Join(values, "\x00")
+		i, ok := index[key]
+		if !ok {
+			i = len(rows)
+			index[key] = i
+			rows = append(rows, UsageEntry{})
+			for j, column := range columns {
+				rows[i].setColumn(column, values[j])
+			}
+		}
+		rows[i].add(entry)
+		total.add(entry)
+	}
+
+	label := "all time"
+	if prefix != "" {
+		label = prefix
+	}
+	fmt.Fprintf(stdout, "usage for %s from %s\n\n", label, path)
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "%s\tREQUESTS\tINPUT\tCACHED\tOUTPUT\tCOST_USD\t\n", strings.ToUpper(strings.Join(columns, "\t")))
+	for _, row := range rows {
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			values[i] = logValueOrDash(row.column(column))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t\n", strings.Join(values, "\t"), row.totals())
+	}
+	fmt.Fprintf(tw, "TOTAL%s\t%s\t\n", strings.Repeat("\t", len(columns)-1), total.totals())
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if cfgErr != nil || len(cfg.Usage.Budgets) == 0 {
+		return nil
+	}
+	fmt.Fprintln(stdout)
+	tw = tabwriter.NewWriter(stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "BUDGET\tPERIOD\tSPENT_USD\tLIMIT_USD\t\n")
+	for _, budget := range cfg.Usage.Budgets {
+		fmt.Fprintf(tw, "%s\t%s\t%.4f\t%.2f\t\n", budget.Name, budget.Period, store.Spent(budget, now), budget.LimitUSD)
+	}
+	return tw.Flush()
+}
+
+func (e UsageEntry) column(name string) string {
+	switch name {
+	case "day":
+		return e.Day
+	case "route":
+		return e.Route
+	case "model":
+		return e.Model
+	case "preset":
+		return e.Preset
+	case "client":
+		return e.Client
+	}
+	return ""
+}
+
+func (e *UsageEntry) setColumn(name, value string) {
+	switch name {
+	case "day":
+		e.Day = value
+	case "route":
+		e.Route = value
+	case "model":
+		e.Model = value
+	case "preset":
+		e.Preset = value
+	case "client":
+		e.Client = value
+	}
+}
+
+func (e *UsageEntry) add(other UsageEntry) {
+	e.Requests += other.Requests
+	e.InputTokens += other.InputTokens
+	e.CachedInputTokens += other.CachedInputTokens
+	e.OutputTokens += other.OutputTokens
+	e.CostUSD += other.CostUSD
+}
+
+// totals formats the counters of e as tab-separated report cells.
+func (e UsageEntry) totals() string {
+	return fmt.Sprintf("%d\t%d\t%d\t%d\t%.4f", e.Requests, e.InputTokens, e.CachedInputTokens, e.OutputTokens, e.CostUSD)
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestModelPrice_Cost(t *testing.T) {
+	cached := 0.5
+	provider := ProviderConfig{Pricing: map[string]ModelPrice{
+		"gpt-5":   {Input: 2, Output: 8, CachedInput: &cached},
+		"*":       {Input: 1, Output: 2},
+		"gpt-5.4": {Input: 3, Output: 12},
+	}}
+	usage := AnthropicUsage{InputTokens: 1_000_000, OutputTokens: 500_000, CacheReadInputTokens: 2_000_000}
+
+	price, ok := provider.price("gpt-5")
+	if !ok || !approx(price.cost(usage), 2+4+1) {
+		t.Fatalf("unexpected gpt-5 cost: %v %v", ok, price.cost(usage))
+	}
+	// Without a cached price, cache reads are billed as input.
+	price, ok = provider.price("other")
+	if !ok || !approx(price.cost(usage), 1+1+2) {
+		t.Fatalf("unexpected wildcard cost: %v %v", ok, price.cost(usage))
+	}
+	if _, ok := (ProviderConfig{}).price("gpt-5"); ok {
+		t.Fatal("expected no price without a pricing table")
+	}
+}
+
+func newUsageTestServer(t *testing.T, usage UsageConfig) (*Server, *int) {
+	t.Helper()
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		var req OpenAIChatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		_ = json.NewEncoder(w).Encode(OpenAIChatResponse{
+			Choices: []OpenAIChoice{{Message: OpenAIMessage{Role: "assistant", Content: "from " + req.Model}, FinishReason: "stop"}},
+			Usage:   OpenAIUsage{PromptTokens: 1000, CompletionTokens: 500},
+		})
+	}))
+	t.Cleanup(upstream.Close)
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "openai",
+		Providers: map[string]ProviderConfig{
+			"openai": {Type: ProviderTypeOpenAI, URL: upstream.URL, Model: "gpt-5", Pricing: map[string]ModelPrice{"gpt-5": {Input: 1000, Output: 4000}}},
+			"ollama": {Type: ProviderTypeOpenAI, URL: upstream.URL, Model: "qwen"},
+		},
+		Clients: map[string]ClientConfig{"laptop": {}},
+		Usage:   usage,
+	}
+	return NewServer(cfg, NewLogger()), &calls
+}
+
+func sendUsageTestRequest(s *Server) *httptest.ResponseRecorder {
+	body := []byte(`{"model":"claude","messages":[{"role":"user","content":"hi"}]}`)
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader(body))
+	req = req.WithContext(context.WithValue(req.Context(), clientKey{}, "laptop"))
+	rr := httptest.NewRecorder()
+	s.handleMessages(rr, req)
+	return rr
+}
+
+func TestUsageStore_RecordsAndPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	s, _ := newUsageTestServer(t, UsageConfig{File: path})
+	for i := 0; i < 2; i++ {
+		if rr := sendUsageTestRequest(s); rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	// Saves are batched, and shutdown writes what is pending.
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected the first save to be deferred, got %v", err)
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	reopened, err := OpenUsageStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	entries := reopened.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected one entry, got %+v", entries)
+	}
+	got := entries[0]
+	if got.Day != time.Now().Format(usageDayFormat) || got.Route != "openai" || got.Model != "gpt-5" || got.Client != "laptop" {
+		t.Fatalf("unexpected entry key: %+v", got)
+	}
+	if got.Requests != 2 || got.InputTokens != 2000 || got.OutputTokens != 1000 || !approx(got.CostUSD, 2*(1+2)) {
+		t.Fatalf("unexpected totals: %+v", got)
+	}
+}
+
+func TestBudget_RejectsOnceSpent(t *testing.T) {
+	s, calls := newUsageTestServer(t, UsageConfig{Budgets: []BudgetConfig{
+		{Name: "openai-daily", Period: budgetDaily, LimitUSD: 2, Providers: []string{"openai"}},
+	}})
+	if rr := sendUsageTestRequest(s); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rr.Code, rr.Body.String())
+	}
+	rr := sendUsageTestRequest(s)
+	if rr.Code != http.StatusTooManyRequests || !strings.Contains(rr.Body.String(), "rate_limit_error") || !strings.Contains(rr.Body.String(), "openai-daily") {
+		t.Fatalf("expected budget 429, got %d %s", rr.Code, rr.Body.String())
+	}
+	if *calls != 1 {
+		t.Fatalf("expected the refused request not to reach upstream, got %d calls", *calls)
+	}
+}
+
+func TestBudget_SwitchesToFallback(t *testing.T) {
+	s, _ := newUsageTestServer(t, UsageConfig{Budgets: []BudgetConfig{
+		{Name: "laptop-openai", Period: budgetMonthly, LimitUSD: 1, Providers: []string{"openai"}, Clients: []string{"laptop"}, Fallback: "ollama"},
+	}})
+	for i, want := range []string{"from gpt-5", "from qwen", "from qwen"} {
+		rr := sendUsageTestRequest(s)
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), want) {
+			t.Fatalf("request %d: expected %q, got %d %s", i, want, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestBudgetConfig_InPeriod(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local)
+	daily := BudgetConfig{Period: budgetDaily}
+	monthly := BudgetConfig{Period: budgetMonthly}
+	if !daily.inPeriod("2026-10-16", now) || daily.inPeriod("2026-10-15", now) {
+		t.Fatal("unexpected daily period")
+	}
+	if !monthly.inPeriod("2026-10-01", now) || monthly.inPeriod("2026-09-30", now) {
+		t.Fatal("unexpected monthly period")
+	}
+}
+
+func TestLoadConfig_ValidatesUsage(t *testing.T) {
+	base := `
+listen: ":0"
+spoof_model: "claude"
+default_provider: "openai"
+timeout_seconds: 60
+providers:
+  openai:
+    type: openai
+    url: "http://example.com"
+    model: "gpt-5"
+    pricing:
+      "*": {input: 1, output: 4, cached_input: 0.1}
+`
+	cfg, err := LoadConfig(writeTempConfig(t, base+`
+usage:
+  file: usage.json
+  budgets:
+    - name: daily
+      period: Daily
+      limit_usd: 5
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Usage.Budgets[0].Period != budgetDaily || *cfg.Providers["openai"].Pricing["*"].CachedInput != 0.1 {
+		t.Fatalf("unexpected usage config: %+v", cfg.Usage)
+	}
+
+	for _, tc := range []struct{ usage, want string }{
+		{"  budgets:\n    - name: x\n      period: weekly\n      limit_usd: 1\n", "period must be daily or monthly"},
+		{"  budgets:\n    - name: x\n      period: daily\n", "limit_usd must be > 0"},
+		{"  budgets:\n    - name: x\n      period: daily\n      limit_usd: 1\n      fallback: nope\n", `fallback "nope" is not defined`},
+		{"  budgets:\n    - period: daily\n      limit_usd: 1\n", "name is required"},
+	} {
+		_, err := LoadConfig(writeTempConfig(t, base+"usage:\n"+tc.usage))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("expected %q, got %v", tc.want, err)
+		}
+	}
+}
+
+func TestRunUsage_Report(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "usage.json")
+	store, err := OpenUsageStore(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for _, entry := range []UsageEntry{
+		{Day: "2026-10-16", Route: "openai", Model: "gpt-5", Client: "laptop", Requests: 2, InputTokens: 100, OutputTokens: 50, CostUSD: 0.5},
+		{Day: "2026-10-01", Route: "openai", Model: "gpt-5", Client: "ci", Requests: 1, InputTokens: 10, OutputTokens: 5, CostUSD: 0.25},
+		{Day: "2026-09-30", Route: "codex", Model: "gpt-5.4", Requests: 7, CostUSD: 9},
+	} {
+		store.Add(entry)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	configPath := writeTempConfig(t, `
+listen: ":0"
+spoof_model: "claude"
+default_provider: "openai"
+timeout_seconds: 60
+providers:
+  openai:
+    type: openai
+    url: "http://example.com"
+    model: "gpt-5"
+usage:
+  file: `+path+`
+  budgets:
+    - name: openai-monthly
+      period: monthly
+      limit_usd: 10
+      providers: [openai]
+`)
+
+	var out, errOut bytes.Buffer
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local)
+	if err := runUsage([]string{"--config", configPath}, now, &out, &errOut); err != nil {
+		t.Fatalf("runUsage: %v (%s)", err, errOut.String())
+	}
+	report := squashSpaces(out.String())
+	for _, want := range []string{"usage for 2026-10", "openai gpt-5 3 110 0 55 0.7500", "openai-monthly monthly 0.7500 10.00"} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("expected %q in report:\n%s", want, report)
+		}
+	}
+	if strings.Contains(report, "codex") {
+		t.Fatalf("expected last month's usage to be excluded:\n%s", report)
+	}
+
+	out.Reset()
+	if err := runUsage([]string{"--config", configPath, "--period", "all", "--by", "client"}, now, &out, &errOut); err != nil {
+		t.Fatalf("runUsage: %v", err)
+	}
+	for _, want := range []string{"ci 1 10 0 5 0.2500", "laptop 2 100", "- 7 0 0 0 9.0000", "TOTAL 10"} {
+		if !strings.Contains(squashSpaces(out.String()), want) {
+			t.Fatalf("expected %q in report:\n%s", want, out.String())
+		}
+	}
+	if err := runUsage([]string{"--config", configPath, "--by", "provider"}, now, &out, &errOut); err == nil {
+		t.Fatal("expected an unknown column to be rejected")
+	}
+}
+
+// squashSpaces collapses the column padding of a report, line by line.
+func squashSpaces(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestUsageStore_RecordsCompressedRelayResponses(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := `{"id":"m1","type":"message","role":"assistant","content":[],"usage":{"input_tokens":100,"output_tokens":20}}`
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			_, _ = zw.Write([]byte(body))
+			_ = zw.Close()
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer upstream.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "anthropic",
+		Providers: map[string]ProviderConfig{
+			"anthropic": {Type: ProviderTypePassthrough, URL: upstream.URL, Pricing: map[string]ModelPrice{"*": {Input: 1000, Output: 1000}}},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	rr := httptest.NewRecorder()
+	s.handleMessages(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("expected a decoded 200, got %d %v", rr.Code, rr.Header())
+	}
+
+	entries := s.usage.Entries()
+	if len(entries) != 1 || entries[0].InputTokens != 100 || entries[0].OutputTokens != 20 || !approx(entries[0].CostUSD, 0.12) {
+		t.Fatalf("expected usage from the compressed response, got %+v", entries)
+	}
+}
+
+func TestUsage_SkipsStreamsEndingInError(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":100}}}\n\n"+
+			"event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n")
+	}))
+	defer upstream.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "anthropic",
+		Providers: map[string]ProviderConfig{
+			"anthropic": {Type: ProviderTypePassthrough, URL: upstream.URL},
+		},
+	}
+	s := NewServer(cfg, NewLogger())
+	rr := httptest.NewRecorder()
+	s.handleMessages(rr, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude","stream":true,"messages":[{"role":"user","content":"hi"}]}`)))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "event: error") {
+		t.Fatalf("expected the error event to be relayed, got %d %s", rr.Code, rr.Body.String())
+	}
+	if entries := s.usage.Entries(); len(entries) != 0 {
+		t.Fatalf("expected a failed stream not to count as a request, got %+v", entries)
+	}
+}
+
+func TestUsage_NativeResponsesRecordsAndEnforcesBudget(t *testing.T) {
+	codexCalls := 0
+	codex := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		codexCalls++
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "event: response.output_text.delta\n"+`data: {"type":"response.output_text.delta","delta":"native"}`+"\n\n")
+		_, _ = io.WriteString(w, "event: response.completed\n"+`data: {"type":"response.completed","response":{"usage":{"input_tokens":1000,"input_tokens_details":{"cached_tokens":400},"output_tokens":100}}}`+"\n\n")
+	}))
+	defer codex.Close()
+	openai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(OpenAIChatResponse{
+			Choices: []OpenAIChoice{{Message: OpenAIMessage{Role: "assistant", Content: "from openai"}, FinishReason: "stop"}},
+		})
+	}))
+	defer openai.Close()
+
+	cfg := &Config{
+		Listen:          ":0",
+		SpoofModel:      "claude-spoof",
+		DefaultProvider: "codex",
+		Providers: map[string]ProviderConfig{
+			"codex":  {Type: ProviderTypeChatGPT, URL: codex.URL, Model: "gpt-5-codex", Pricing: map[string]ModelPrice{"*": {Input: 1000, Output: 1000}}},
+			"openai": {Type: ProviderTypeOpenAI, URL: openai.URL, Model: "gpt-5-mini"},
+		},
+		Usage: UsageConfig{Budgets: []BudgetConfig{
+			{Name: "codex-daily", Period: budgetDaily, LimitUSD: 1, Providers: []string{"codex"}, Fallback: "openai"},
+		}},
+	}
+	s := NewServer(cfg, NewLogger())
+	send := func(stream bool) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"model":"gpt-5-codex","input":"hi","stream":%t}`, stream)
+		rr := httptest.NewRecorder()
+		s.handleResponses(rr, httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(body)))
+		return rr
+	}
+
+	if rr := send(true); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"delta":"native"`) {
+		t.Fatalf("expected the native stream, got %d %s", rr.Code, rr.Body.String())
+	}
+	entries := s.usage.Entries()
+	if len(entries) != 1 || entries[0].Route != "codex" || entries[0].InputTokens != 600 || entries[0].CachedInputTokens != 400 || entries[0].OutputTokens != 100 || !approx(entries[0].CostUSD, 1.1) {
+		t.Fatalf("expected native usage to be recorded, got %+v", entries)
+	}
+
+	if rr := send(false); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "from openai") {
+		t.Fatalf("expected the spent budget to move the request to openai, got %d %s", rr.Code, rr.Body.String())
+	}
+	if codexCalls != 1 {
+		t.Fatalf("expected codex to be skipped once the budget was spent, got %d calls", codexCalls)
+	}
+}